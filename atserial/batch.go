@@ -0,0 +1,231 @@
+package atserial
+
+import (
+	"log"
+	"sync"
+	"time"
+	"context"
+	"strings"
+)
+
+const (
+	// batchCommandTimeout is the timeout of a prefetched command, command
+	// policies with a longer MaxDuration extend it
+	batchCommandTimeout = 2 * time.Second
+	// maxChainedCommands keeps chained lines well below the module's
+	// command line limit
+	maxChainedCommands = 5
+)
+
+// CommandDeclarer is implemented by info providers that declare the query
+// commands their Fetch sends, e.g. `AT+QENG="servingcell"`. FetchMultipleInfo
+// sends the commands of all requested keys once and answers every provider
+// that asked for them from that batch.
+type CommandDeclarer interface {
+	Commands() []string
+}
+
+type batchResult struct {
+	rsp SerialResponse
+	err error
+}
+
+// commandBatch holds the responses of prefetched commands. It is carried by
+// a context, so only the requests made on behalf of one fetch share it.
+type commandBatch struct {
+	mu      sync.Mutex
+	results map[string]batchResult
+}
+
+type commandBatchKey struct{}
+
+func commandBatchFrom(ctx context.Context) *commandBatch {
+
+	batch, _ := ctx.Value(commandBatchKey{}).(*commandBatch)
+	return batch
+}
+
+func (b *commandBatch) lookup(cmd string) (batchResult, bool) {
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	result, ok := b.results[strings.TrimSpace(cmd)]
+	return result, ok
+}
+
+func (b *commandBatch) store(cmd string, result batchResult) {
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.results[strings.TrimSpace(cmd)] = result
+}
+
+// missing returns the commands of cmds without a response yet, each once.
+func (b *commandBatch) missing(cmds []string) []string {
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var pending []string
+	for _, cmd := range cmds {
+		cmd = strings.TrimSpace(cmd)
+		if _, ok := b.results[cmd]; ok || cmd == "" || containsString(pending, cmd) {
+			continue
+		}
+		pending = append(pending, cmd)
+	}
+	return pending
+}
+
+// infoCommands collects the commands declared by the providers of keys.
+func (nri *NRInterface) infoCommands(keys []string) []string {
+
+	var cmds []string
+	for _, key := range keys {
+		provider, ok := nri.infoRegistry.Get(key)
+		if !ok {
+			continue
+		}
+		if declarer, ok := provider.(CommandDeclarer); ok {
+			cmds = append(cmds, declarer.Commands()...)
+		}
+	}
+	return cmds
+}
+
+// withCommandBatch sends the commands of cmds that were not answered yet and
+// returns a context whose requests for them are answered from the batch
+// instead of the port. Nested calls share the batch of ctx.
+func (nri *NRInterface) withCommandBatch(ctx context.Context, cmds []string) context.Context {
+
+	batch := commandBatchFrom(ctx)
+	if batch == nil {
+		batch = &commandBatch{results: make(map[string]batchResult)}
+		ctx = context.WithValue(ctx, commandBatchKey{}, batch)
+	}
+
+	for _, group := range chainGroups(batch.missing(cmds), nri.ChainCommands) {
+		if ctx.Err() != nil {
+			break
+		}
+		if len(group) == 1 {
+			nri.runBatchCommand(ctx, batch, group[0])
+		} else {
+			nri.runChainedCommands(ctx, batch, group)
+		}
+	}
+	return ctx
+}
+
+func (nri *NRInterface) runBatchCommand(ctx context.Context, batch *commandBatch, cmd string) {
+
+	rsp, err := nri.query(ctx, SerialRequest{
+		Data:    []byte(cmd + "\r\n"),
+		Timeout: batchCommandTimeout,
+	})
+	if ctx.Err() != nil {
+		return
+	}
+	batch.store(cmd, batchResult{rsp: rsp, err: err})
+}
+
+// runChainedCommands sends cmds as one line such as `AT+QSPN;+CGCONTRDP` and
+// splits the answer by response prefix. A failing line is sent again command
+// by command, as the module stops at the first failing command.
+func (nri *NRInterface) runChainedCommands(ctx context.Context, batch *commandBatch, cmds []string) {
+
+	line := cmds[0]
+	for _, cmd := range cmds[1:] {
+		line += ";" + strings.TrimPrefix(cmd, "AT")
+	}
+
+	rsp, err := nri.query(ctx, SerialRequest{
+		Data:    []byte(line + "\r\n"),
+		Timeout: batchCommandTimeout * time.Duration(len(cmds)),
+	})
+	var parsed *ATResponse
+	if err == nil {
+		parsed, err = rsp.ATResponse()
+	}
+	if ctx.Err() != nil {
+		return
+	}
+	if err != nil {
+		log.Printf("[NRInterface] chained %s failed, sending the commands one by one: %v", line, err)
+		for _, cmd := range cmds {
+			nri.runBatchCommand(ctx, batch, cmd)
+		}
+		return
+	}
+
+	for _, cmd := range cmds {
+		var data strings.Builder
+		for _, info := range parsed.Lines {
+			if strings.HasPrefix(info, responsePrefix(cmd)) {
+				data.WriteString("\r\n" + info)
+			}
+		}
+		data.WriteString("\r\n\r\nOK\r\n")
+		batch.store(cmd, batchResult{rsp: SerialResponse{ID: rsp.ID, Data: []byte(data.String())}})
+	}
+}
+
+// chainGroups splits cmds into command lines. With chain unset every command
+// gets its own line. Otherwise commands are chained when their answers can be
+// told apart: they need a response prefix not shared with another command of
+// the line, and mutating or preemptible commands always run alone.
+func chainGroups(cmds []string, chain bool) [][]string {
+
+	var groups [][]string
+	var chained []int
+	for _, cmd := range cmds {
+		prefix := responsePrefix(cmd)
+		policy := LookupCommandPolicy(cmd)
+		if !chain || prefix == "" || policy.Mutates || policy.Preemptible {
+			groups = append(groups, []string{cmd})
+			continue
+		}
+
+		placed := false
+		for _, i := range chained {
+			if len(groups[i]) >= maxChainedCommands || hasResponsePrefix(groups[i], prefix) {
+				continue
+			}
+			groups[i] = append(groups[i], cmd)
+			placed = true
+			break
+		}
+		if !placed {
+			chained = append(chained, len(groups))
+			groups = append(groups, []string{cmd})
+		}
+	}
+	return groups
+}
+
+func hasResponsePrefix(cmds []string, prefix string) bool {
+
+	for _, cmd := range cmds {
+		if responsePrefix(cmd) == prefix {
+			return true
+		}
+	}
+	return false
+}
+
+// responsePrefix is the prefix of the information lines answering cmd, e.g.
+// "+QENG:" for `AT+QENG="servingcell"`. Basic commands such as ATI have none.
+func responsePrefix(cmd string) string {
+
+	cmd = strings.ToUpper(strings.TrimSpace(cmd))
+	if !strings.HasPrefix(cmd, "AT+") {
+		return ""
+	}
+	name := strings.TrimPrefix(cmd, "AT")
+	if i := strings.IndexAny(name, "=?"); i >= 0 {
+		name = name[:i]
+	}
+	return name + ":"
+}
@@ -0,0 +1,286 @@
+package atserial
+
+import (
+	"os"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+	"bufio"
+	"errors"
+	"context"
+	"strings"
+	"encoding/json"
+)
+
+const (
+	CaptureCommand = "at"
+	CaptureURC     = "urc"
+)
+
+// CaptureRecord is one line of a capture file: either a command with the raw
+// response the modem gave, or an unsolicited result code.
+type CaptureRecord struct {
+	Time     time.Time `json:"time"`
+	Kind     string    `json:"kind"`
+	Command  string    `json:"command,omitempty"`
+	Payload  string    `json:"payload,omitempty"`
+	Response string    `json:"response,omitempty"`
+	Error    string    `json:"error,omitempty"`
+	Duration int64     `json:"duration_ms"`
+}
+
+// CaptureRecorder appends every exchange of a PortDaemon to a JSON lines
+// file, so a session from the field can be replayed with ReplayTransport.
+type CaptureRecorder struct {
+	mu   sync.Mutex
+	file *os.File
+	enc  *json.Encoder
+}
+
+func NewCaptureRecorder(path string) (*CaptureRecorder, error) {
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	return &CaptureRecorder{file: file, enc: json.NewEncoder(file)}, nil
+}
+
+func (r *CaptureRecorder) record(rec CaptureRecord) {
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.file == nil {
+		return
+	}
+	if err := r.enc.Encode(rec); err != nil {
+		log.Println("[Capture] write failed:", err)
+	}
+}
+
+func (r *CaptureRecorder) recordCommand(req SerialRequest, rsp SerialResponse, start time.Time) {
+
+	rec := CaptureRecord{
+		Time:     start,
+		Kind:     CaptureCommand,
+		Command:  strings.TrimSpace(string(req.Data)),
+		Payload:  string(req.Payload),
+		Response: string(rsp.Data),
+		Duration: time.Since(start).Milliseconds(),
+	}
+	if rsp.Err != nil {
+		rec.Error = rsp.Err.Error()
+	}
+
+	r.record(rec)
+}
+
+func (r *CaptureRecorder) recordURC(ev URCEvent) {
+
+	r.record(CaptureRecord{Time: ev.Time, Kind: CaptureURC, Response: ev.Raw})
+}
+
+func (r *CaptureRecorder) Close() error {
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.file == nil {
+		return nil
+	}
+	err := r.file.Close()
+	r.file = nil
+
+	return err
+}
+
+// LoadCapture reads a capture file written by CaptureRecorder.
+func LoadCapture(path string) ([]CaptureRecord, error) {
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var records []CaptureRecord
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		var rec CaptureRecord
+		if err := json.Unmarshal([]byte(text), &rec); err != nil {
+			return nil, fmt.Errorf("capture line %d: %v", line, err)
+		}
+		records = append(records, rec)
+	}
+
+	return records, scanner.Err()
+}
+
+// ReplayTransport answers requests from a capture. Every command is answered
+// with its recorded responses in order; once they are used up the last one
+// is repeated, so polling loops keep working.
+type ReplayTransport struct {
+	mu       sync.Mutex
+	answers  map[string][]CaptureRecord
+	next     map[string]int
+	urcs     []CaptureRecord
+	missing  []string
+	realtime bool
+	closed   bool
+	bus      *URCBus
+}
+
+func NewReplayTransport(records []CaptureRecord) *ReplayTransport {
+
+	t := &ReplayTransport{
+		answers: make(map[string][]CaptureRecord),
+		next:    make(map[string]int),
+		bus:     NewURCBus(),
+	}
+
+	for _, rec := range records {
+		switch rec.Kind {
+		case CaptureURC:
+			t.urcs = append(t.urcs, rec)
+		default:
+			t.answers[rec.Command] = append(t.answers[rec.Command], rec)
+		}
+	}
+
+	return t
+}
+
+func OpenReplayTransport(path string) (*ReplayTransport, error) {
+
+	records, err := LoadCapture(path)
+	if err != nil {
+		return nil, err
+	}
+	return NewReplayTransport(records), nil
+}
+
+// SetRealtime makes every answer take as long as it did when recorded.
+func (t *ReplayTransport) SetRealtime(realtime bool) {
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.realtime = realtime
+}
+
+// ReplayURCs publishes the recorded unsolicited result codes in order.
+func (t *ReplayTransport) ReplayURCs() {
+
+	t.mu.Lock()
+	urcs := append([]CaptureRecord(nil), t.urcs...)
+	t.mu.Unlock()
+
+	for _, rec := range urcs {
+		line, body, _ := strings.Cut(rec.Response, "\r\n")
+		spec, ok := matchURC(line)
+		if !ok {
+			continue
+		}
+		ev := newURCEvent(spec, line)
+		ev.Body = body
+		ev.Raw = rec.Response
+		t.bus.Publish(ev)
+	}
+}
+
+// Missing returns the commands that were requested but are not in the
+// capture.
+func (t *ReplayTransport) Missing() []string {
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return append([]string(nil), t.missing...)
+}
+
+func (t *ReplayTransport) Query(ctx context.Context, req SerialRequest) (SerialResponse, error) {
+
+	if err := ctx.Err(); err != nil {
+		return SerialResponse{}, err
+	}
+	cmd := strings.TrimSpace(string(req.Data))
+
+	t.mu.Lock()
+	if t.closed {
+		t.mu.Unlock()
+		return SerialResponse{}, errTransportClosed
+	}
+	answers := t.answers[cmd]
+	if len(answers) == 0 {
+		if !containsString(t.missing, cmd) {
+			t.missing = append(t.missing, cmd)
+		}
+		t.mu.Unlock()
+		log.Printf("[Replay] command not in capture: %s", cmd)
+		return SerialResponse{ID: req.ID, Err: errReadTimeout}, nil
+	}
+	idx := t.next[cmd]
+	if idx < len(answers)-1 {
+		t.next[cmd] = idx + 1
+	}
+	rec := answers[idx]
+	realtime := t.realtime
+	t.mu.Unlock()
+
+	if realtime && rec.Duration > 0 {
+		select {
+		case <-time.After(time.Duration(rec.Duration) * time.Millisecond):
+		case <-ctx.Done():
+			return SerialResponse{}, ctx.Err()
+		}
+	}
+
+	rsp := SerialResponse{ID: req.ID, Data: []byte(rec.Response)}
+	if rec.Error != "" {
+		rsp.Err = errors.New(rec.Error)
+	}
+	return rsp, nil
+}
+
+func (t *ReplayTransport) Health() error {
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.closed {
+		return errTransportClosed
+	}
+	return nil
+}
+
+func (t *ReplayTransport) Close() error {
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.closed = true
+	return nil
+}
+
+func (t *ReplayTransport) URCBus() *URCBus {
+	return t.bus
+}
+
+func containsString(list []string, s string) bool {
+
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
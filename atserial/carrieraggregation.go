@@ -0,0 +1,153 @@
+package atserial
+
+import (
+	"fmt"
+	"time"
+	"context"
+	"strings"
+)
+
+// CarrierComponent is one +QCAINFO line. Signal values the module does not
+// report for a carrier, e.g. an NR SCC anchored on LTE, are left at zero.
+type CarrierComponent struct {
+	Role         string  `json:"role"`
+	RAT          string  `json:"rat"`
+	ARFCN        int     `json:"arfcn"`
+	Band         int     `json:"band"`
+	BandwidthMHz float64 `json:"bandwidth_mhz"`
+	PCI          int     `json:"pci"`
+	RSRP         int     `json:"rsrp_dbm"`
+	RSRQ         int     `json:"rsrq_db"`
+	RSSI         int     `json:"rssi_dbm"`
+	SINR         int     `json:"sinr_db"`
+}
+
+// CarrierAggregation lists the primary (PCC) and secondary (SCC) component
+// carriers in use. Without aggregation only the PCC is reported.
+type CarrierAggregation struct {
+	Carriers []CarrierComponent
+}
+
+var lteBandwidthRB = map[int]float64{6: 1.4, 15: 3, 25: 5, 50: 10, 75: 15, 100: 20}
+
+func ParseCarrierAggregation(raw string) (*CarrierAggregation, error) {
+
+	rsp, err := parseOKResponse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("fetch carrier aggregation failed: %w", err)
+	}
+	return parseCarrierAggregation(rsp), nil
+}
+
+func parseCarrierAggregation(rsp *ATResponse) *CarrierAggregation {
+
+	ca := &CarrierAggregation{}
+
+	for _, line := range rsp.Lines {
+		if !strings.HasPrefix(line, "+QCAINFO:") {
+			continue
+		}
+
+		p := splitATParams(strings.TrimPrefix(line, "+QCAINFO:"))
+		if len(p) < 5 {
+			continue
+		}
+
+		cc := CarrierComponent{Role: p[0], ARFCN: atoiField(p[1])}
+		band := strings.Fields(p[3])
+		if len(band) > 0 {
+			cc.Band = atoiField(band[len(band)-1])
+		}
+
+		if strings.HasPrefix(p[3], "NR") {
+			// "NR5G BAND 78": <ARFCN>,<bw>,<band>,<PCI>[,<RSRP>,<RSRQ>,<SNR>]
+			cc.RAT = "NR"
+			cc.BandwidthMHz = lookupFloat(nrBandwidthMHz, p[2])
+			cc.PCI = atoiField(p[4])
+			if len(p) >= 8 {
+				cc.RSRP = atoiField(p[5])
+				cc.RSRQ = atoiField(p[6])
+				cc.SINR = atoiField(p[7])
+			}
+		} else {
+			// "LTE BAND 3": <EARFCN>,<RBs>,<band>,<state>,<PCI>,<RSRP>,<RSRQ>,<RSSI>,<RSSNR>
+			cc.RAT = "LTE"
+			cc.BandwidthMHz = lteBandwidthRB[atoiField(p[2])]
+			if len(p) >= 6 {
+				cc.PCI = atoiField(p[5])
+			}
+			if len(p) >= 10 {
+				cc.RSRP = atoiField(p[6])
+				cc.RSRQ = atoiField(p[7])
+				cc.RSSI = atoiField(p[8])
+				cc.SINR = atoiField(p[9])
+			}
+		}
+
+		ca.Carriers = append(ca.Carriers, cc)
+	}
+
+	return ca
+}
+
+// Secondary returns the number of active secondary carriers.
+func (ca *CarrierAggregation) Secondary() int {
+
+	n := 0
+	for _, cc := range ca.Carriers {
+		if cc.Role == "SCC" {
+			n++
+		}
+	}
+	return n
+}
+
+// TotalBandwidthMHz is the aggregated downlink bandwidth.
+func (ca *CarrierAggregation) TotalBandwidthMHz() float64 {
+
+	total := 0.0
+	for _, cc := range ca.Carriers {
+		total += cc.BandwidthMHz
+	}
+	return total
+}
+
+func (ca *CarrierAggregation) String() string {
+
+	if len(ca.Carriers) == 0 {
+		return "no carriers reported"
+	}
+
+	lines := make([]string, 0, len(ca.Carriers)+1)
+	for _, cc := range ca.Carriers {
+		band := fmt.Sprintf("B%d", cc.Band)
+		if cc.RAT == "NR" {
+			band = fmt.Sprintf("n%d", cc.Band)
+		}
+		line := fmt.Sprintf("%s %s %gMHz PCI %d", cc.Role, band, cc.BandwidthMHz, cc.PCI)
+		if cc.RSRP != 0 {
+			line += fmt.Sprintf(" RSRP %d SINR %d", cc.RSRP, cc.SINR)
+		}
+		lines = append(lines, line)
+	}
+	if ca.Secondary() == 0 {
+		lines = append(lines, "no carrier aggregation")
+	} else {
+		lines = append(lines, fmt.Sprintf("%d carriers, %gMHz total", len(ca.Carriers), ca.TotalBandwidthMHz()))
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+func (nri *NRInterface) FetchCarrierAggregation() (*CarrierAggregation, error) {
+	return nri.FetchCarrierAggregationContext(context.Background())
+}
+
+func (nri *NRInterface) FetchCarrierAggregationContext(ctx context.Context) (*CarrierAggregation, error) {
+
+	rsp, err := nri.ExecuteContext(ctx, cmdCarrierAggregation+"\r\n", time.Second)
+	if err != nil {
+		return nil, fmt.Errorf("fetch carrier aggregation failed: %w", err)
+	}
+	return parseCarrierAggregation(rsp), nil
+}
@@ -0,0 +1,390 @@
+package atserial
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+	"errors"
+	"context"
+	"strconv"
+	"strings"
+)
+
+// Lock targets of AT+QNWLOCK.
+const (
+	CellLock4G = "common/4g"
+	CellLock5G = "common/5g"
+)
+
+const (
+	maxLTECellLocks        = 10
+	defaultLockRevertAfter = 10 * time.Minute
+)
+
+// LTECellLock pins the module to PCI on EARFCN.
+type LTECellLock struct {
+	EARFCN int
+	PCI    int
+}
+
+// NRCellLock pins the module to an NR cell.
+type NRCellLock struct {
+	PCI    int
+	ARFCN  int
+	SCSkHz int
+	Band   int
+}
+
+func (l NRCellLock) String() string {
+	return fmt.Sprintf("PCI %d ARFCN %d SCS %dkHz n%d", l.PCI, l.ARFCN, l.SCSkHz, l.Band)
+}
+
+func (l LTECellLock) String() string {
+	return fmt.Sprintf("EARFCN %d PCI %d", l.EARFCN, l.PCI)
+}
+
+func (nri *NRInterface) queryCellLock(ctx context.Context, target string) ([]string, error) {
+
+	rsp, err := nri.ExecuteContext(ctx, fmt.Sprintf("AT+QNWLOCK=\"%s\"\r\n", target), 2*time.Second)
+	if err != nil {
+		return nil, fmt.Errorf("query %s lock failed: %w", target, err)
+	}
+
+	lines := rsp.Prefixed("+QNWLOCK:")
+	if len(lines) == 0 {
+		return nil, fmt.Errorf("%s lock not found", target)
+	}
+	return splitATParams(lines[0])[1:], nil
+}
+
+func (nri *NRInterface) setCellLock(ctx context.Context, target string, params []int) error {
+
+	values := make([]string, len(params))
+	for i, v := range params {
+		values[i] = strconv.Itoa(v)
+	}
+
+	cmd := fmt.Sprintf("AT+QNWLOCK=\"%s\",%s\r\n", target, strings.Join(values, ","))
+	if _, err := nri.ExecuteContext(ctx, cmd, 3*time.Second); err != nil {
+		return fmt.Errorf("set %s lock failed: %w", target, err)
+	}
+
+	log.Printf("[NRInterface] %s lock set to %s", target, strings.Join(values, ","))
+	return nil
+}
+
+// GetLTECellLock returns the locked LTE cells, none when unlocked.
+func (nri *NRInterface) GetLTECellLock() ([]LTECellLock, error) {
+	return nri.GetLTECellLockContext(context.Background())
+}
+
+func (nri *NRInterface) GetLTECellLockContext(ctx context.Context) ([]LTECellLock, error) {
+
+	params, err := nri.queryCellLock(ctx, CellLock4G)
+	if err != nil {
+		return nil, err
+	}
+	if len(params) == 0 || atoiField(params[0]) == 0 {
+		return nil, nil
+	}
+
+	var locks []LTECellLock
+	for i := 1; i+1 < len(params); i += 2 {
+		locks = append(locks, LTECellLock{EARFCN: atoiField(params[i]), PCI: atoiField(params[i+1])})
+	}
+	return locks, nil
+}
+
+func (nri *NRInterface) SetLTECellLock(cells []LTECellLock) error {
+	return nri.SetLTECellLockContext(context.Background(), cells)
+}
+
+func (nri *NRInterface) SetLTECellLockContext(ctx context.Context, cells []LTECellLock) error {
+
+	if len(cells) == 0 || len(cells) > maxLTECellLocks {
+		return fmt.Errorf("between 1 and %d cells can be locked", maxLTECellLocks)
+	}
+
+	params := []int{len(cells)}
+	for _, cell := range cells {
+		if cell.EARFCN < 0 || cell.PCI < 0 || cell.PCI > 503 {
+			return fmt.Errorf("invalid LTE cell %s", cell)
+		}
+		params = append(params, cell.EARFCN, cell.PCI)
+	}
+
+	return nri.setCellLock(ctx, CellLock4G, params)
+}
+
+func (nri *NRInterface) ClearLTECellLock() error {
+	return nri.ClearLTECellLockContext(context.Background())
+}
+
+func (nri *NRInterface) ClearLTECellLockContext(ctx context.Context) error {
+	return nri.setCellLock(ctx, CellLock4G, []int{0})
+}
+
+// GetNRCellLock returns the locked NR cell, nil when unlocked.
+func (nri *NRInterface) GetNRCellLock() (*NRCellLock, error) {
+	return nri.GetNRCellLockContext(context.Background())
+}
+
+func (nri *NRInterface) GetNRCellLockContext(ctx context.Context) (*NRCellLock, error) {
+
+	params, err := nri.queryCellLock(ctx, CellLock5G)
+	if err != nil {
+		return nil, err
+	}
+	if len(params) < 4 {
+		return nil, nil
+	}
+
+	return &NRCellLock{
+		PCI:    atoiField(params[0]),
+		ARFCN:  atoiField(params[1]),
+		SCSkHz: atoiField(params[2]),
+		Band:   atoiField(params[3]),
+	}, nil
+}
+
+func (nri *NRInterface) SetNRCellLock(lock NRCellLock) error {
+	return nri.SetNRCellLockContext(context.Background(), lock)
+}
+
+func (nri *NRInterface) SetNRCellLockContext(ctx context.Context, lock NRCellLock) error {
+
+	if lock.PCI < 0 || lock.PCI > 1007 {
+		return fmt.Errorf("invalid NR PCI %d", lock.PCI)
+	}
+	if lookupIndex(nrSCSkHz, lock.SCSkHz) < 0 {
+		return fmt.Errorf("invalid SCS %dkHz", lock.SCSkHz)
+	}
+	if lock.ARFCN <= 0 || lock.Band <= 0 {
+		return errors.New("ARFCN and band are required")
+	}
+
+	return nri.setCellLock(ctx, CellLock5G, []int{lock.PCI, lock.ARFCN, lock.SCSkHz, lock.Band})
+}
+
+func (nri *NRInterface) ClearNRCellLock() error {
+	return nri.ClearNRCellLockContext(context.Background())
+}
+
+func (nri *NRInterface) ClearNRCellLockContext(ctx context.Context) error {
+	return nri.setCellLock(ctx, CellLock5G, []int{0})
+}
+
+func (nri *NRInterface) clearCellLock(ctx context.Context, target string) error {
+
+	if target == CellLock5G {
+		return nri.ClearNRCellLockContext(ctx)
+	}
+	return nri.ClearLTECellLockContext(ctx)
+}
+
+func lookupIndex(table []int, v int) int {
+
+	for i, item := range table {
+		if item == v {
+			return i
+		}
+	}
+	return -1
+}
+
+// Registered reports whether the module is registered (home or roaming) on
+// LTE or NR. It only fails when neither registration status could be read.
+func (nri *NRInterface) Registered() (bool, error) {
+	return nri.RegisteredContext(context.Background())
+}
+
+func (nri *NRInterface) RegisteredContext(ctx context.Context) (bool, error) {
+
+	var lastErr error
+	answered := false
+	for _, cmd := range []string{"+CEREG", "+C5GREG"} {
+		rsp, err := nri.ExecuteContext(ctx, "AT"+cmd+"?\r\n", time.Second)
+		if err != nil {
+			lastErr = fmt.Errorf("query %s failed: %w", cmd, err)
+			continue
+		}
+		answered = true
+		for _, line := range rsp.Prefixed(cmd + ":") {
+			params := splitATParams(line)
+			if len(params) >= 2 && (params[1] == "1" || params[1] == "5") {
+				return true, nil
+			}
+		}
+	}
+
+	if answered {
+		return false, nil
+	}
+	return false, lastErr
+}
+
+// CellLockGuard reverts a cell lock when the module stays unregistered for
+// longer than timeout after it was set, so a bad lock can't leave a remote
+// site offline.
+type CellLockGuard struct {
+	nri      *NRInterface
+	timeout  time.Duration
+	interval time.Duration
+
+	// ctx is cancelled by Stop and aborts queries the watchers have running
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu       sync.Mutex
+	watches  map[string]chan struct{}
+	onRevert func(target string, err error)
+}
+
+func NewCellLockGuard(nri *NRInterface, timeout time.Duration) *CellLockGuard {
+
+	if timeout <= 0 {
+		timeout = defaultLockRevertAfter
+	}
+	interval := timeout / 10
+	if interval < 5*time.Second {
+		interval = 5 * time.Second
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	return &CellLockGuard{
+		nri:      nri,
+		timeout:  timeout,
+		interval: interval,
+		ctx:      ctx,
+		cancel:   cancel,
+		watches:  make(map[string]chan struct{}),
+	}
+}
+
+func (g *CellLockGuard) Timeout() time.Duration {
+	return g.timeout
+}
+
+// OnRevert is called after the guard cleared a lock, err is set when
+// clearing failed.
+func (g *CellLockGuard) OnRevert(fn func(target string, err error)) {
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.onRevert = fn
+}
+
+// Watch starts guarding the lock on target (CellLock4G or CellLock5G).
+func (g *CellLockGuard) Watch(target string) {
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if stop, ok := g.watches[target]; ok {
+		close(stop)
+	}
+	stop := make(chan struct{})
+	g.watches[target] = stop
+
+	go g.watch(target, stop)
+}
+
+// Release stops guarding target, e.g. after the lock was cleared by hand.
+func (g *CellLockGuard) Release(target string) {
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if stop, ok := g.watches[target]; ok {
+		close(stop)
+		delete(g.watches, target)
+	}
+}
+
+// WatchActive guards the locks that are already set, e.g. after a restart.
+// The queries are aborted by Stop.
+func (g *CellLockGuard) WatchActive() {
+
+	if locks, err := g.nri.GetLTECellLockContext(g.ctx); err == nil && len(locks) > 0 {
+		g.Watch(CellLock4G)
+	}
+	if lock, err := g.nri.GetNRCellLockContext(g.ctx); err == nil && lock != nil {
+		g.Watch(CellLock5G)
+	}
+}
+
+// Stop ends all watches and aborts a registration query or lock clear that
+// is still running.
+func (g *CellLockGuard) Stop() {
+
+	g.cancel()
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	for target, stop := range g.watches {
+		close(stop)
+		delete(g.watches, target)
+	}
+}
+
+func (g *CellLockGuard) watch(target string, stop chan struct{}) {
+
+	ticker := time.NewTicker(g.interval)
+	defer ticker.Stop()
+
+	var lostSince time.Time
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-g.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		registered, err := g.nri.RegisteredContext(g.ctx)
+		if g.ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			// a failed query, e.g. while the port restarts, is no sign of
+			// the lock keeping the module off the network
+			log.Printf("[CellLockGuard] check registration with %s lock failed: %v", target, err)
+			continue
+		}
+		if registered {
+			lostSince = time.Time{}
+			continue
+		}
+		if lostSince.IsZero() {
+			log.Printf("[CellLockGuard] not registered with %s lock", target)
+			lostSince = time.Now()
+		}
+		if time.Since(lostSince) < g.timeout {
+			continue
+		}
+
+		log.Printf("[CellLockGuard] unregistered for %v, reverting %s lock", g.timeout, target)
+		err = g.nri.clearCellLock(g.ctx, target)
+		if g.ctx.Err() != nil {
+			log.Printf("[CellLockGuard] reverting %s lock interrupted by shutdown", target)
+			return
+		}
+
+		g.mu.Lock()
+		if g.watches[target] == stop {
+			delete(g.watches, target)
+		}
+		onRevert := g.onRevert
+		g.mu.Unlock()
+
+		if onRevert != nil {
+			onRevert(target, err)
+		}
+		return
+	}
+}
@@ -0,0 +1,51 @@
+package atserial
+
+import (
+	"time"
+	"testing"
+)
+
+func TestRegistered(t *testing.T) {
+
+	tests := []struct {
+		name       string
+		cereg      string
+		c5greg     string
+		registered bool
+		fails      bool
+	}{
+		{"LTE home", "\r\n+CEREG: 0,1\r\n\r\nOK\r\n", "\r\n+C5GREG: 0,0\r\n\r\nOK\r\n", true, false},
+		{"NR roaming", "\r\n+CEREG: 0,2\r\n\r\nOK\r\n", "\r\n+C5GREG: 0,5\r\n\r\nOK\r\n", true, false},
+		{"searching", "\r\n+CEREG: 0,2\r\n\r\nOK\r\n", "\r\n+C5GREG: 0,2\r\n\r\nOK\r\n", false, false},
+		// one answer is enough to tell the module is not registered
+		{"one query failed", "\r\n+CEREG: 0,3\r\n\r\nOK\r\n", "\r\nERROR\r\n", false, false},
+		{"both queries failed", "\r\n+CME ERROR: 14\r\n", "\r\nERROR\r\n", false, true},
+	}
+
+	for _, tt := range tests {
+		fake := NewFakeTransport()
+		fake.SetResponse("AT+CEREG?", tt.cereg)
+		fake.SetResponse("AT+C5GREG?", tt.c5greg)
+		nri := NewNRInterfaceWithTransport(fake)
+
+		registered, err := nri.Registered()
+		if registered != tt.registered || (err != nil) != tt.fails {
+			t.Errorf("%s: got %v, %v", tt.name, registered, err)
+		}
+	}
+}
+
+func TestCellLockGuardStopAbortsQueries(t *testing.T) {
+
+	fake := NewFakeTransport()
+	fake.SetResponse(`AT+QNWLOCK="common/4g"`, "\r\n+QNWLOCK: \"common/4g\",1,1850,123\r\n\r\nOK\r\n")
+	nri := NewNRInterfaceWithTransport(fake)
+
+	guard := NewCellLockGuard(nri, time.Minute)
+	guard.Stop()
+	guard.WatchActive()
+
+	if reqs := fake.Requests(); len(reqs) != 0 {
+		t.Fatalf("stopped guard sent %d requests, first %q", len(reqs), reqs[0].Data)
+	}
+}
@@ -0,0 +1,250 @@
+package atserial
+
+import (
+	"sync"
+	"time"
+	"strings"
+)
+
+// CommandPolicy tells the daemon how to run a command and whether its answer
+// may be cached. Zero fields take the value of defaultCommandPolicy, negative
+// durations switch the limit off.
+type CommandPolicy struct {
+	// Prefix selects the commands the policy applies to, e.g. `AT+CMGL` or
+	// `AT+QENG="servingcell"`; the longest matching prefix wins
+	Prefix string
+	// Final lists the final result codes that complete a response. Codes
+	// ending in ':' such as "+CME ERROR:" match the start of a line.
+	Final []string
+	// Prompt is an intermediate prompt such as "> " after which the
+	// request Payload is written
+	Prompt string
+	// MaxDuration is how long the command may take on the module; shorter
+	// request timeouts are extended to it
+	MaxDuration time.Duration
+	// SilenceLimit is how long the module may stay silent before the port
+	// is reported unresponsive
+	SilenceLimit time.Duration
+	// TTL is how long the response is cached
+	TTL time.Duration
+	// Mutates marks commands that change the module state. They are never
+	// cached and drop the cache once they ran.
+	Mutates bool
+	// SetOnly limits Mutates to set forms with a value after the first
+	// parameter, e.g. `AT+QNWLOCK="common/4g",1,...`, so reads such as
+	// `AT+QNWLOCK="common/4g"` keep the cache
+	SetOnly bool
+	// Preemptible commands are aborted when another request is queued,
+	// see SerialRequest.Preemptible
+	Preemptible bool
+}
+
+var defaultCommandPolicy = CommandPolicy{
+	Final:        []string{"OK", "ERROR", "+CME ERROR:", "+CMS ERROR:", "CONNECT", "NO CARRIER"},
+	SilenceLimit: 2 * time.Second,
+	TTL:          60 * time.Second,
+}
+
+var (
+	policyMu        sync.RWMutex
+	commandPolicies = map[string]CommandPolicy{}
+)
+
+func init() {
+
+	for _, p := range []CommandPolicy{
+		{Prefix: "AT+CMGS=", Prompt: "> ", SilenceLimit: 30 * time.Second, TTL: -1},
+		{Prefix: "AT+CMGL", MaxDuration: 30 * time.Second, TTL: -1},
+		{Prefix: "AT+CMGR=", TTL: -1},
+		{Prefix: "AT+CMGD=", MaxDuration: 5 * time.Second, TTL: -1, Mutates: true},
+		{Prefix: "AT+CSMS", TTL: -1},
+		{Prefix: "AT+CNMI", TTL: -1},
+		{Prefix: "AT+CNMA", TTL: -1},
+		{Prefix: "AT+QGDCNT?", TTL: -1},
+		{Prefix: "AT+QGDNRCNT?", TTL: -1},
+		{Prefix: "AT+QNWPREFCFG", TTL: -1, Mutates: true, SetOnly: true},
+		{Prefix: "AT+QNWLOCK", TTL: -1, Mutates: true, SetOnly: true},
+		{Prefix: "AT+COPS=?", MaxDuration: scanTimeout, SilenceLimit: -1, TTL: -1, Preemptible: true},
+		{Prefix: "AT+QSCAN", MaxDuration: scanTimeout, SilenceLimit: -1, TTL: -1, Preemptible: true},
+		{Prefix: `AT+QENG="servingcell"`, TTL: 200 * time.Millisecond},
+		{Prefix: `AT+QENG="neighbourcell"`, TTL: time.Second},
+		{Prefix: "AT+QCAINFO", TTL: time.Second},
+		{Prefix: "AT+CREG?", TTL: time.Second},
+		{Prefix: "AT+CEREG?", TTL: time.Second},
+		{Prefix: "AT+C5GREG?", TTL: time.Second},
+		{Prefix: "AT+QSIMSTAT?", TTL: 30 * time.Second},
+		{Prefix: "AT+QMAP=", TTL: 30 * time.Second},
+		{Prefix: "AT+QSPN", TTL: 90 * time.Second},
+		{Prefix: "AT+CGCONTRDP", TTL: 90 * time.Second},
+	} {
+		RegisterCommandPolicy(p)
+	}
+}
+
+// RegisterCommandPolicy adds p or replaces the policy with the same prefix.
+func RegisterCommandPolicy(p CommandPolicy) {
+
+	policyMu.Lock()
+	defer policyMu.Unlock()
+
+	p.Prefix = strings.ToUpper(strings.TrimSpace(p.Prefix))
+	commandPolicies[p.Prefix] = p
+}
+
+// LookupCommandPolicy returns the policy of a command line. The commands of a
+// chained line such as `AT+CMGF=0;+CMGL=4` are looked up one by one and
+// combined: their durations add up, the most lenient silence limit and the
+// shortest TTL win.
+func LookupCommandPolicy(line string) CommandPolicy {
+
+	var merged CommandPolicy
+	for i, cmd := range splitCommandLine(line) {
+		p := lookupSingleCommandPolicy(cmd)
+		if i == 0 {
+			merged = p
+			continue
+		}
+
+		merged.Prefix += ";" + p.Prefix
+		merged.Final = mergeFinalCodes(merged.Final, p.Final)
+		if merged.Prompt == "" {
+			merged.Prompt = p.Prompt
+		}
+		merged.MaxDuration += p.MaxDuration
+		if merged.SilenceLimit > 0 && (p.SilenceLimit < 0 || p.SilenceLimit > merged.SilenceLimit) {
+			merged.SilenceLimit = p.SilenceLimit
+		}
+		if merged.TTL > 0 && (p.TTL < 0 || p.TTL < merged.TTL) {
+			merged.TTL = p.TTL
+		}
+		merged.Mutates = merged.Mutates || p.Mutates
+		merged.Preemptible = merged.Preemptible || p.Preemptible
+	}
+
+	if merged.Mutates {
+		merged.TTL = -1
+	}
+	return merged
+}
+
+func lookupSingleCommandPolicy(cmd string) CommandPolicy {
+
+	upper := strings.ToUpper(cmd)
+
+	policyMu.RLock()
+	var p CommandPolicy
+	for prefix, candidate := range commandPolicies {
+		if strings.HasPrefix(upper, prefix) && len(prefix) > len(p.Prefix) {
+			p = candidate
+		}
+	}
+	policyMu.RUnlock()
+
+	if p.Prefix == "" {
+		p.Prefix = upper
+	}
+	if p.Mutates && p.SetOnly && !isSetCommand(cmd) {
+		p.Mutates = false
+	}
+	if len(p.Final) == 0 {
+		p.Final = defaultCommandPolicy.Final
+	}
+	if p.SilenceLimit == 0 {
+		p.SilenceLimit = defaultCommandPolicy.SilenceLimit
+	}
+	if p.TTL == 0 {
+		p.TTL = defaultCommandPolicy.TTL
+	}
+	return p
+}
+
+func mergeFinalCodes(a []string, b []string) []string {
+
+	merged := append([]string(nil), a...)
+	for _, code := range b {
+		if !containsString(merged, code) {
+			merged = append(merged, code)
+		}
+	}
+	return merged
+}
+
+// splitCommandLine turns `AT+CMGF=0;+CMGL=4` into `AT+CMGF=0` and
+// `AT+CMGL=4`, leaving semicolons inside quotes alone.
+func splitCommandLine(line string) []string {
+
+	line = strings.TrimSpace(line)
+
+	var cmds []string
+	var cur strings.Builder
+	inQuote := false
+	for _, r := range line {
+		switch {
+		case r == '"':
+			inQuote = !inQuote
+			cur.WriteRune(r)
+		case r == ';' && !inQuote:
+			cmds = append(cmds, cur.String())
+			cur.Reset()
+		default:
+			cur.WriteRune(r)
+		}
+	}
+	cmds = append(cmds, cur.String())
+
+	for i, cmd := range cmds {
+		cmd = strings.TrimSpace(cmd)
+		if i > 0 && !strings.HasPrefix(strings.ToUpper(cmd), "AT") {
+			cmd = "AT" + cmd
+		}
+		cmds[i] = cmd
+	}
+	return cmds
+}
+
+// isSetCommand reports whether cmd passes more than one parameter, such as
+// `AT+QNWPREFCFG="mode_pref",NR5G` unlike the read `AT+QNWPREFCFG="mode_pref"`
+// or the test command `AT+QNWPREFCFG=?`.
+func isSetCommand(cmd string) bool {
+
+	_, args, ok := strings.Cut(cmd, "=")
+	return ok && len(splitATParams(args)) > 1
+}
+
+// timeout is the time a request with the given timeout gets on the port.
+func (p CommandPolicy) timeout(requested time.Duration) time.Duration {
+
+	if p.MaxDuration > requested {
+		return p.MaxDuration
+	}
+	return requested
+}
+
+// complete reports whether the last non-empty line of response is one of
+// the final result codes. The daemon checks after every line it reads, so a
+// text mode SMS line reading just "OK" ends the response early; PDU mode is
+// not affected.
+func (p CommandPolicy) complete(response []byte) bool {
+
+	lines := strings.Split(string(response), "\n")
+	for i := len(lines) - 1; i >= 0; i-- {
+		line := strings.TrimSpace(lines[i])
+		if line == "" {
+			continue
+		}
+		for _, code := range p.Final {
+			if line == code || (strings.HasSuffix(code, ":") && strings.HasPrefix(line, code)) {
+				return true
+			}
+		}
+		return false
+	}
+	return false
+}
+
+// promptReceived reports whether data starts with the intermediate prompt.
+func (p CommandPolicy) promptReceived(data []byte) bool {
+
+	prompt := strings.TrimSpace(p.Prompt)
+	return prompt != "" && strings.HasPrefix(strings.TrimLeft(string(data), "\r\n"), prompt)
+}
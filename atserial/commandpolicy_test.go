@@ -0,0 +1,57 @@
+package atserial
+
+import "testing"
+
+func TestLookupCommandPolicyMutates(t *testing.T) {
+
+	tests := []struct {
+		line    string
+		mutates bool
+	}{
+		{`AT+QNWPREFCFG="mode_pref"`, false},
+		{`AT+QNWPREFCFG="mode_pref",NR5G:LTE`, true},
+		{`AT+QNWPREFCFG=?`, false},
+		{`AT+QNWLOCK="common/4g"`, false},
+		{`AT+QNWLOCK="common/4g",1,1850,123`, true},
+		{`AT+QNWLOCK="common/5g",0`, true},
+		{`AT+CMGD=3`, true},
+		{`AT+QENG="servingcell"`, false},
+		// a chained line mutates when one of its commands does
+		{`AT+QNWPREFCFG="mode_pref";+QNWPREFCFG="nr5g_band"`, false},
+		{`AT+QNWPREFCFG="mode_pref",AUTO;+QNWPREFCFG="nr5g_band"`, true},
+	}
+
+	for _, tt := range tests {
+		p := LookupCommandPolicy(tt.line)
+		if p.Mutates != tt.mutates {
+			t.Errorf("%s: got mutates %v", tt.line, p.Mutates)
+		}
+		if p.Mutates && p.TTL >= 0 {
+			t.Errorf("%s: mutating command cached for %v", tt.line, p.TTL)
+		}
+	}
+}
+
+func TestCommandPolicyComplete(t *testing.T) {
+
+	p := LookupCommandPolicy("AT+CMGL=4")
+
+	tests := []struct {
+		response string
+		complete bool
+	}{
+		{"\r\n+CMGL: 0,1,,24\r\n", false},
+		{"\r\n+CMGL: 0,1,,24\r\n0891683108100005F0\r\n\r\nOK\r\n", true},
+		{"\r\n+CME ERROR: 14\r\n", true},
+		{"\r\n+CMS ERROR: 321\r\n", true},
+		// a final result code followed by more lines is not the end
+		{"\r\nOK\r\n+CMGL: 1,1,,24\r\n", false},
+		{"\r\nOKAY\r\n", false},
+	}
+
+	for _, tt := range tests {
+		if got := p.complete([]byte(tt.response)); got != tt.complete {
+			t.Errorf("%q: got %v", tt.response, got)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package atserial
+
+import (
+	"sync"
+	"errors"
+	"context"
+	"strings"
+)
+
+// FakeHandler answers one request of a FakeTransport. Returning ok=false
+// falls through to the canned responses.
+type FakeHandler func(req SerialRequest) (rsp string, ok bool, err error)
+
+// FakeTransport is an in-memory Transport answering from canned responses
+// keyed by the trimmed command, so NRInterface can run without hardware.
+type FakeTransport struct {
+	mu        sync.Mutex
+	responses map[string]string
+	handler   FakeHandler
+	requests  []SerialRequest
+	healthErr error
+	closed    bool
+	bus       *URCBus
+}
+
+var errTransportClosed = errors.New("transport closed")
+
+func NewFakeTransport() *FakeTransport {
+
+	return &FakeTransport{
+		responses: make(map[string]string),
+		bus:       NewURCBus(),
+	}
+}
+
+// SetResponse makes cmd answer with rsp, e.g. "\r\nOK\r\n".
+func (t *FakeTransport) SetResponse(cmd string, rsp string) {
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.responses[strings.TrimSpace(cmd)] = rsp
+}
+
+func (t *FakeTransport) SetHandler(handler FakeHandler) {
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.handler = handler
+}
+
+func (t *FakeTransport) SetHealth(err error) {
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.healthErr = err
+}
+
+// Requests returns every request seen so far.
+func (t *FakeTransport) Requests() []SerialRequest {
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return append([]SerialRequest(nil), t.requests...)
+}
+
+// InjectURC publishes line as if the modem had sent it unsolicited. body is
+// the second line of two-line URCs such as +CMT and +CDS.
+func (t *FakeTransport) InjectURC(line string, body string) error {
+
+	spec, ok := matchURC(line)
+	if !ok {
+		return errors.New("not a known urc: " + line)
+	}
+
+	ev := newURCEvent(spec, line)
+	ev.Body = body
+	t.bus.Publish(ev)
+
+	return nil
+}
+
+func (t *FakeTransport) Query(ctx context.Context, req SerialRequest) (SerialResponse, error) {
+
+	if err := ctx.Err(); err != nil {
+		return SerialResponse{}, err
+	}
+
+	t.mu.Lock()
+	if t.closed {
+		t.mu.Unlock()
+		return SerialResponse{}, errTransportClosed
+	}
+	t.requests = append(t.requests, req)
+	handler := t.handler
+	t.mu.Unlock()
+
+	if handler != nil {
+		rsp, ok, err := handler(req)
+		if ok || err != nil {
+			return SerialResponse{ID: req.ID, Data: []byte(rsp), Err: err}, nil
+		}
+	}
+
+	t.mu.Lock()
+	rsp, ok := t.responses[strings.TrimSpace(string(req.Data))]
+	t.mu.Unlock()
+
+	if !ok {
+		return SerialResponse{ID: req.ID, Err: errReadTimeout}, nil
+	}
+	return SerialResponse{ID: req.ID, Data: []byte(rsp)}, nil
+}
+
+func (t *FakeTransport) Health() error {
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.closed {
+		return errTransportClosed
+	}
+	return t.healthErr
+}
+
+func (t *FakeTransport) Close() error {
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.closed = true
+	return nil
+}
+
+func (t *FakeTransport) URCBus() *URCBus {
+	return t.bus
+}
@@ -1,45 +1,37 @@
 package atserial
 
 import (
+	"fmt"
 	"math"
 	"time"
 	"errors"
+	"context"
 	"strconv"
 	"strings"
 )
 
+// Query commands sent by the info fetchers, the providers declare them with
+// Commands.
+const (
+	cmdModuleName         = "ATI"
+	cmdCPUTemp            = "AT+QTEMP"
+	cmdSIMStatus          = "AT+QSIMSTAT?"
+	cmdSIMSlot            = "AT+QUIMSLOT?"
+	cmdAPN                = "AT+CGCONTRDP"
+	cmdWWAN               = `AT+QMAP="WWAN"`
+	cmdMCCMNC             = "AT+QSPN"
+	cmdLTEDataCounter     = "AT+QGDCNT?"
+	cmdNRDataCounter      = "AT+QGDNRCNT?"
+	cmdServingCell        = `AT+QENG="servingcell"`
+	cmdNeighbourCells     = `AT+QENG="neighbourcell"`
+	cmdCarrierAggregation = "AT+QCAINFO"
+)
+
+// InfoProvider fetches one value by key. Fetch passes ctx on to the commands
+// it sends, so an abandoned request stops holding up the port.
 type InfoProvider interface {
 	GetKey() string
-	Fetch(nri *NRInterface) (interface{}, error)
-}
-
-type InfoRegistry struct {
-	providers map[string]InfoProvider
-}
-
-func NewInfoRegistry() *InfoRegistry {
-	return &InfoRegistry{
-		providers: make(map[string]InfoProvider),
-	}
-}
-
-func (r *InfoRegistry) Register(provider InfoProvider) {
-	r.providers[provider.GetKey()] = provider
-}
-
-func (r *InfoRegistry) Get(key string) (InfoProvider, bool) {
-	provider, ok := r.providers[key]
-	return provider, ok
-}
-
-func (r *InfoRegistry) GetAllKeys() []string {
-	keys := make([]string, 0, len(r.providers))
-
-	for k := range r.providers {
-		keys = append(keys, k)
-	}
-
-	return keys
+	Fetch(ctx context.Context, nri *NRInterface) (interface{}, error)
 }
 
 func bytesToSize(bytes float64) string {
@@ -55,36 +47,26 @@ func bytesToSize(bytes float64) string {
 	return strconv.FormatFloat(result, 'f', 4, 64) + sizes[tmp]
 }
 
-type ModuleNameProvider struct{}
-
-func (p *ModuleNameProvider) GetKey() string { return "ModuleName" }
-func (p *ModuleNameProvider) Fetch(nri *NRInterface) (interface{}, error) {
-
-	rawdata := nri.FetchRawData("ATI\r\n", time.Second)
+func (nri *NRInterface) fetchModuleName(ctx context.Context) (string, error) {
 
-	if !strings.Contains(rawdata, "OK") {
-		return "", errors.New("fetch module name failed")
+	rsp, err := nri.ExecuteContext(ctx, cmdModuleName+"\r\n", time.Second)
+	if err != nil {
+		return "", fmt.Errorf("fetch module name failed: %w", err)
 	}
-	infodata := strings.Split(rawdata, "\r\n")
-	if len(infodata) > 2 {
-		return infodata[1] + infodata[2], nil
+	if len(rsp.Lines) > 1 {
+		return rsp.Lines[0] + rsp.Lines[1], nil
 	}
 
 	return "", errors.New("invalid response length")
 }
 
-type ModuleCPUTempProvider struct{}
-
-func (p *ModuleCPUTempProvider) GetKey() string { return "ModuleCPUTemp" }
-func (p *ModuleCPUTempProvider) Fetch(nri *NRInterface) (interface{}, error) {
-
-	rawdata := nri.FetchRawData("AT+QTEMP\r\n", time.Second)
+func (nri *NRInterface) fetchCPUTemp(ctx context.Context) (int, error) {
 
-	if !strings.Contains(rawdata, "OK") {
-		return 0, errors.New("fetch CPU temp failed")
+	rsp, err := nri.ExecuteContext(ctx, cmdCPUTemp+"\r\n", time.Second)
+	if err != nil {
+		return 0, fmt.Errorf("fetch CPU temp failed: %w", err)
 	}
-	infodata := strings.Split(rawdata, "\r\n")
-	for _, line := range infodata {
+	for _, line := range rsp.Lines {
 		if strings.Contains(line, "cpu0") {
 			parts := strings.Split(line, ",")
 			if len(parts) == 2 {
@@ -96,18 +78,13 @@ func (p *ModuleCPUTempProvider) Fetch(nri *NRInterface) (interface{}, error) {
 	return 0, errors.New("CPU temp not found")
 }
 
-type SimStatusProvider struct{}
-
-func (p *SimStatusProvider) GetKey() string { return "SimStatus" }
-func (p *SimStatusProvider) Fetch(nri *NRInterface) (interface{}, error) {
-
-	rawdata := nri.FetchRawData("AT+QSIMSTAT?\r\n", time.Second)
+func (nri *NRInterface) fetchSIMInserted(ctx context.Context) (bool, error) {
 
-	if !strings.Contains(rawdata, "OK") {
-		return false, errors.New("fetch SIM status failed")
+	rsp, err := nri.ExecuteContext(ctx, cmdSIMStatus+"\r\n", time.Second)
+	if err != nil {
+		return false, fmt.Errorf("fetch SIM status failed: %w", err)
 	}
-	infodata := strings.Split(rawdata, "\r\n")
-	for _, line := range infodata {
+	for _, line := range rsp.Lines {
 		if strings.Contains(line, "+QSIMSTAT") {
 			parts := strings.Split(line, ",")
 			if len(parts) == 2 {
@@ -119,18 +96,13 @@ func (p *SimStatusProvider) Fetch(nri *NRInterface) (interface{}, error) {
 	return false, errors.New("SIM status not found")
 }
 
-type SimActiveProvider struct{}
+func (nri *NRInterface) fetchSIMSlot(ctx context.Context) (int, error) {
 
-func (p *SimActiveProvider) GetKey() string { return "SimActive" }
-func (p *SimActiveProvider) Fetch(nri *NRInterface) (interface{}, error) {
-
-	rawdata := nri.FetchRawData("AT+QUIMSLOT?\r\n", time.Second)
-
-	if !strings.Contains(rawdata, "OK") {
-		return 0, errors.New("fetch SIM active slot failed")
+	rsp, err := nri.ExecuteContext(ctx, cmdSIMSlot+"\r\n", time.Second)
+	if err != nil {
+		return 0, fmt.Errorf("fetch SIM active slot failed: %w", err)
 	}
-	infodata := strings.Split(rawdata, "\r\n")
-	for _, line := range infodata {
+	for _, line := range rsp.Lines {
 		if strings.Contains(line, "+QUIMSLOT:") {
 			line = strings.ReplaceAll(line, "\r", "")
 			if len(line) > 0 {
@@ -142,18 +114,13 @@ func (p *SimActiveProvider) Fetch(nri *NRInterface) (interface{}, error) {
 	return 0, errors.New("SIM active slot not found")
 }
 
-type APNProvider struct{}
-
-func (p *APNProvider) GetKey() string { return "APN" }
-func (p *APNProvider) Fetch(nri *NRInterface) (interface{}, error) {
-
-	rawdata := nri.FetchRawData("AT+CGCONTRDP\r\n", time.Second)
+func (nri *NRInterface) fetchAPN(ctx context.Context) (string, error) {
 
-	if !strings.Contains(rawdata, "OK") {
-		return "", errors.New("fetch APN failed")
+	rsp, err := nri.ExecuteContext(ctx, cmdAPN+"\r\n", time.Second)
+	if err != nil {
+		return "", fmt.Errorf("fetch APN failed: %w", err)
 	}
-	infodata := strings.Split(rawdata, "\r\n")
-	for _, line := range infodata {
+	for _, line := range rsp.Lines {
 		if strings.Contains(line, "+CGCONTRDP: 1") {
 			parts := strings.Split(line, ",")
 			if len(parts) >= 3 {
@@ -165,19 +132,18 @@ func (p *APNProvider) Fetch(nri *NRInterface) (interface{}, error) {
 	return "", errors.New("APN not found")
 }
 
-type IPV4Provider struct{}
-
-func (p *IPV4Provider) GetKey() string { return "IPV4" }
-func (p *IPV4Provider) Fetch(nri *NRInterface) (interface{}, error) {
+// fetchWWANAddress returns the address of family ("IPV4" or "IPV6") from
+// AT+QMAP="WWAN".
+func (nri *NRInterface) fetchWWANAddress(ctx context.Context, family string) (string, error) {
 
-	rawdata := nri.FetchRawData("AT+QMAP=\"WWAN\"\r\n", time.Second)
+	name := strings.Replace(family, "IPV", "IPv", 1)
 
-	if !strings.Contains(rawdata, "OK") {
-		return "", errors.New("fetch IPv4 failed")
+	rsp, err := nri.ExecuteContext(ctx, cmdWWAN+"\r\n", time.Second)
+	if err != nil {
+		return "", fmt.Errorf("fetch %s failed: %w", name, err)
 	}
-	infodata := strings.Split(rawdata, "\r\n")
-	for _, line := range infodata {
-		if strings.Contains(line, "IPV4") {
+	for _, line := range rsp.Lines {
+		if strings.Contains(line, family) {
 			parts := strings.Split(line, ",")
 			if len(parts) >= 5 {
 				return strings.ReplaceAll(parts[4], "\"", ""), nil
@@ -185,22 +151,19 @@ func (p *IPV4Provider) Fetch(nri *NRInterface) (interface{}, error) {
 		}
 	}
 
-	return "", errors.New("IPv4 not found")
+	return "", errors.New(name + " not found")
 }
 
-type IPV6Provider struct{}
-
-func (p *IPV6Provider) GetKey() string { return "IPV6" }
-func (p *IPV6Provider) Fetch(nri *NRInterface) (interface{}, error) {
+// fetchMCCMNC returns the MCC and MNC of the registered network as reported,
+// keeping leading zeros of the MNC.
+func (nri *NRInterface) fetchMCCMNC(ctx context.Context) (string, error) {
 
-	rawdata := nri.FetchRawData("AT+QMAP=\"WWAN\"\r\n", time.Second)
-
-	if !strings.Contains(rawdata, "OK") {
-		return "", errors.New("fetch IPv6 failed")
+	rsp, err := nri.ExecuteContext(ctx, cmdMCCMNC+"\r\n", time.Second)
+	if err != nil {
+		return "", fmt.Errorf("fetch MCCMNC failed: %w", err)
 	}
-	infodata := strings.Split(rawdata, "\r\n")
-	for _, line := range infodata {
-		if strings.Contains(line, "IPV6") {
+	for _, line := range rsp.Lines {
+		if strings.Contains(line, "+QSPN") {
 			parts := strings.Split(line, ",")
 			if len(parts) >= 5 {
 				return strings.ReplaceAll(parts[4], "\"", ""), nil
@@ -208,50 +171,183 @@ func (p *IPV6Provider) Fetch(nri *NRInterface) (interface{}, error) {
 		}
 	}
 
-	return "", errors.New("IPv6 not found")
+	return "", errors.New("MCCMNC not found")
 }
 
-type MCCMNCProvider struct{}
-
-func (p *MCCMNCProvider) GetKey() string { return "MCCMNC" }
-func (p *MCCMNCProvider) Fetch(nri *NRInterface) (interface{}, error) {
-
-	rawdata := nri.FetchRawData("AT+QSPN\r\n", time.Second)
+// fetchDataCounters sums the LTE (+QGDCNT) and NR (+QGDNRCNT) data counters.
+// It only fails when neither counter could be read.
+func (nri *NRInterface) fetchDataCounters(ctx context.Context) (upload int64, download int64, err error) {
 
-	if !strings.Contains(rawdata, "OK") {
-		return 0, errors.New("fetch MCCMNC failed")
-	}
-	infodata := strings.Split(rawdata, "\r\n")
-	for _, line := range infodata {
-		if strings.Contains(line, "+QSPN") {
+	var errs []error
+	for _, cmd := range []string{cmdLTEDataCounter, cmdNRDataCounter} {
+		rsp, queryErr := nri.ExecuteContext(ctx, cmd+"\r\n", time.Second)
+		if queryErr != nil {
+			errs = append(errs, queryErr)
+			continue
+		}
+		for _, line := range rsp.Prefixed(responsePrefix(cmd)) {
 			parts := strings.Split(line, ",")
-			if len(parts) >= 5 {
-				return strconv.Atoi(strings.ReplaceAll(parts[4], "\"", ""))
+			if len(parts) >= 2 {
+				received, _ := strconv.ParseInt(strings.TrimSpace(parts[0]), 10, 64)
+				sent, _ := strconv.ParseInt(strings.TrimSpace(parts[1]), 10, 64)
+				download += received
+				upload += sent
 			}
 		}
 	}
 
-	return 0, errors.New("MCCMNC not found")
+	if len(errs) == 2 {
+		return 0, 0, fmt.Errorf("fetch data counters failed: %w", errors.Join(errs...))
+	}
+	return upload, download, nil
+}
+
+type ModuleNameProvider struct{}
+
+func (p *ModuleNameProvider) GetKey() string { return "ModuleName" }
+func (p *ModuleNameProvider) Commands() []string { return []string{cmdModuleName} }
+func (p *ModuleNameProvider) Metadata() InfoMetadata {
+	return InfoMetadata{
+		Category:    InfoCategoryModule,
+		ValueType:   "string",
+		Description: "Module model name",
+	}
+}
+func (p *ModuleNameProvider) Fetch(ctx context.Context, nri *NRInterface) (interface{}, error) {
+	return nri.fetchModuleName(ctx)
+}
+
+type ModuleCPUTempProvider struct{}
+
+func (p *ModuleCPUTempProvider) GetKey() string { return "ModuleCPUTemp" }
+func (p *ModuleCPUTempProvider) Commands() []string { return []string{cmdCPUTemp} }
+func (p *ModuleCPUTempProvider) Metadata() InfoMetadata {
+	return InfoMetadata{
+		Category:    InfoCategoryModule,
+		Unit:        "°C",
+		ValueType:   "int",
+		Description: "Module CPU temperature",
+	}
+}
+func (p *ModuleCPUTempProvider) Fetch(ctx context.Context, nri *NRInterface) (interface{}, error) {
+	return nri.fetchCPUTemp(ctx)
+}
+
+type SimStatusProvider struct{}
+
+func (p *SimStatusProvider) GetKey() string { return "SimStatus" }
+func (p *SimStatusProvider) Commands() []string { return []string{cmdSIMStatus} }
+func (p *SimStatusProvider) Metadata() InfoMetadata {
+	return InfoMetadata{
+		Category:    InfoCategoryModule,
+		ValueType:   "bool",
+		Description: "Whether a SIM is inserted",
+	}
+}
+func (p *SimStatusProvider) Fetch(ctx context.Context, nri *NRInterface) (interface{}, error) {
+	return nri.fetchSIMInserted(ctx)
+}
+
+type SimActiveProvider struct{}
+
+func (p *SimActiveProvider) GetKey() string { return "SimActive" }
+func (p *SimActiveProvider) Commands() []string { return []string{cmdSIMSlot} }
+func (p *SimActiveProvider) Metadata() InfoMetadata {
+	return InfoMetadata{
+		Category:    InfoCategoryModule,
+		ValueType:   "int",
+		Description: "Active SIM slot",
+	}
+}
+func (p *SimActiveProvider) Fetch(ctx context.Context, nri *NRInterface) (interface{}, error) {
+	return nri.fetchSIMSlot(ctx)
+}
+
+type APNProvider struct{}
+
+func (p *APNProvider) GetKey() string { return "APN" }
+func (p *APNProvider) Commands() []string { return []string{cmdAPN} }
+func (p *APNProvider) Metadata() InfoMetadata {
+	return InfoMetadata{
+		Category:    InfoCategoryNetwork,
+		ValueType:   "string",
+		Description: "APN of the data session",
+	}
+}
+func (p *APNProvider) Fetch(ctx context.Context, nri *NRInterface) (interface{}, error) {
+	return nri.fetchAPN(ctx)
+}
+
+type IPV4Provider struct{}
+
+func (p *IPV4Provider) GetKey() string { return "IPV4" }
+func (p *IPV4Provider) Commands() []string { return []string{cmdWWAN} }
+func (p *IPV4Provider) Metadata() InfoMetadata {
+	return InfoMetadata{
+		Category:    InfoCategoryNetwork,
+		ValueType:   "string",
+		Description: "IPv4 address of the WWAN interface",
+	}
+}
+func (p *IPV4Provider) Fetch(ctx context.Context, nri *NRInterface) (interface{}, error) {
+	return nri.fetchWWANAddress(ctx, "IPV4")
+}
+
+type IPV6Provider struct{}
+
+func (p *IPV6Provider) GetKey() string { return "IPV6" }
+func (p *IPV6Provider) Commands() []string { return []string{cmdWWAN} }
+func (p *IPV6Provider) Metadata() InfoMetadata {
+	return InfoMetadata{
+		Category:    InfoCategoryNetwork,
+		ValueType:   "string",
+		Description: "IPv6 address of the WWAN interface",
+	}
+}
+func (p *IPV6Provider) Fetch(ctx context.Context, nri *NRInterface) (interface{}, error) {
+	return nri.fetchWWANAddress(ctx, "IPV6")
+}
+
+type MCCMNCProvider struct{}
+
+func (p *MCCMNCProvider) GetKey() string { return "MCCMNC" }
+func (p *MCCMNCProvider) Commands() []string { return []string{cmdMCCMNC} }
+func (p *MCCMNCProvider) Metadata() InfoMetadata {
+	return InfoMetadata{
+		Category:    InfoCategoryNetwork,
+		ValueType:   "int",
+		Description: "MCC and MNC of the registered network",
+	}
+}
+func (p *MCCMNCProvider) Fetch(ctx context.Context, nri *NRInterface) (interface{}, error) {
+
+	mccmnc, err := nri.fetchMCCMNC(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(mccmnc)
 }
 
 type NetworkModeProvider struct{}
 
 func (p *NetworkModeProvider) GetKey() string { return "NetworkMode" }
-func (p *NetworkModeProvider) Fetch(nri *NRInterface) (interface{}, error) {
-
-	rawdata := nri.FetchRawData("AT+QENG=\"servingcell\"\r\n", time.Second)
+func (p *NetworkModeProvider) Commands() []string { return []string{cmdServingCell} }
+func (p *NetworkModeProvider) Metadata() InfoMetadata {
+	return InfoMetadata{
+		Category:    InfoCategoryNetwork,
+		ValueType:   "string",
+		Description: "Serving RAT, e.g. LTE, NR5G-SA or LTE+NR5G-NSA",
+		DependsOn:   []string{"ServingCell"},
+	}
+}
+func (p *NetworkModeProvider) Fetch(ctx context.Context, nri *NRInterface) (interface{}, error) {
 
-	if !strings.Contains(rawdata, "OK") {
-		return "", errors.New("fetch network mode failed")
+	cell, err := nri.FetchServingCellContext(ctx)
+	if err != nil {
+		return "", err
 	}
-	infodata := strings.Split(rawdata, "\r\n")
-	for _, line := range infodata {
-		if strings.Contains(line, "servingcell") {
-			parts := strings.Split(line, ",")
-			if len(parts) >= 4 {
-				return strings.ReplaceAll(parts[2], "\"", ""), nil
-			}
-		}
+	if mode := cell.NetworkMode(); mode != "" {
+		return mode, nil
 	}
 
 	return "", errors.New("Network mode not found")
@@ -260,21 +356,23 @@ func (p *NetworkModeProvider) Fetch(nri *NRInterface) (interface{}, error) {
 type DuplexModeProvider struct{}
 
 func (p *DuplexModeProvider) GetKey() string { return "DuplexMode" }
-func (p *DuplexModeProvider) Fetch(nri *NRInterface) (interface{}, error) {
-
-	rawdata := nri.FetchRawData("AT+QENG=\"servingcell\"\r\n", time.Second)
+func (p *DuplexModeProvider) Commands() []string { return []string{cmdServingCell} }
+func (p *DuplexModeProvider) Metadata() InfoMetadata {
+	return InfoMetadata{
+		Category:    InfoCategoryNetwork,
+		ValueType:   "string",
+		Description: "Duplex mode of the serving cell (FDD/TDD)",
+		DependsOn:   []string{"ServingCell"},
+	}
+}
+func (p *DuplexModeProvider) Fetch(ctx context.Context, nri *NRInterface) (interface{}, error) {
 
-	if !strings.Contains(rawdata, "OK") {
-		return "", errors.New("fetch duplex mode failed")
+	cell, err := nri.FetchServingCellContext(ctx)
+	if err != nil {
+		return "", err
 	}
-	infodata := strings.Split(rawdata, "\r\n")
-	for _, line := range infodata {
-		if strings.Contains(line, "servingcell") {
-			parts := strings.Split(line, ",")
-			if len(parts) >= 4 {
-				return strings.ReplaceAll(parts[3], "\"", ""), nil
-			}
-		}
+	if duplex := cell.Duplex(); duplex != "" {
+		return duplex, nil
 	}
 
 	return "", errors.New("Duplex mode not found")
@@ -283,301 +381,271 @@ func (p *DuplexModeProvider) Fetch(nri *NRInterface) (interface{}, error) {
 type CellIDProvider struct{}
 
 func (p *CellIDProvider) GetKey() string { return "CellID" }
-func (p *CellIDProvider) Fetch(nri *NRInterface) (interface{}, error) {
-
-	rawdata := nri.FetchRawData("AT+QENG=\"servingcell\"\r\n", time.Second)
+func (p *CellIDProvider) Commands() []string { return []string{cmdServingCell} }
+func (p *CellIDProvider) Metadata() InfoMetadata {
+	return InfoMetadata{
+		Category:    InfoCategoryNetwork,
+		ValueType:   "string",
+		Description: "Cell ID of the serving cell",
+		DependsOn:   []string{"ServingCell"},
+	}
+}
+func (p *CellIDProvider) Fetch(ctx context.Context, nri *NRInterface) (interface{}, error) {
 
-	if !strings.Contains(rawdata, "OK") {
-		return "", errors.New("fetch cell ID failed")
+	cell, err := nri.FetchServingCellContext(ctx)
+	if err != nil {
+		return "", err
 	}
-	infodata := strings.Split(rawdata, "\r\n")
-	for _, line := range infodata {
-		if strings.Contains(line, "servingcell") {
-			parts := strings.Split(line, ",")
-			if len(parts) >= 7 {
-				return strings.ReplaceAll(parts[6], "\"", ""), nil
-			}
-		}
+	if id := cell.CellID(); id != "" {
+		return id, nil
 	}
 
 	return "", errors.New("Cell ID not found")
 }
 
-type DownloadSizeProvider struct{}
+type ServingCellProvider struct{}
 
-func (p *DownloadSizeProvider) GetKey() string { return "DownloadSize" }
-func (p *DownloadSizeProvider) Fetch(nri *NRInterface) (interface{}, error) {
+func (p *ServingCellProvider) GetKey() string { return "ServingCell" }
+func (p *ServingCellProvider) Commands() []string { return []string{cmdServingCell} }
+func (p *ServingCellProvider) Metadata() InfoMetadata {
+	return InfoMetadata{
+		Category:    InfoCategoryNetwork,
+		ValueType:   "*ServingCell",
+		Description: `Parsed AT+QENG="servingcell"`,
+	}
+}
+func (p *ServingCellProvider) Fetch(ctx context.Context, nri *NRInterface) (interface{}, error) {
+	return nri.FetchServingCellContext(ctx)
+}
 
-	var totalDownload int
+type CarrierAggregationProvider struct{}
+
+func (p *CarrierAggregationProvider) GetKey() string { return "CarrierAggregation" }
+func (p *CarrierAggregationProvider) Commands() []string { return []string{cmdCarrierAggregation} }
+func (p *CarrierAggregationProvider) Metadata() InfoMetadata {
+	return InfoMetadata{
+		Category:    InfoCategorySignal,
+		ValueType:   "*CarrierAggregation",
+		Description: "Component carriers in use",
+	}
+}
+func (p *CarrierAggregationProvider) Fetch(ctx context.Context, nri *NRInterface) (interface{}, error) {
+	return nri.FetchCarrierAggregationContext(ctx)
+}
 
-	rawdata := nri.FetchRawData("AT+QGDCNT?\r\n", time.Second)
+type NeighbourCellsProvider struct{}
 
-	if strings.Contains(rawdata, "OK") {
-		infodata := strings.Split(rawdata, "\r\n")
-		for _, line := range infodata {
-			if strings.Contains(line, "+QGDCNT") {
-				parts := strings.Split(line, ",")
-				if len(parts) >= 2 {
-					download, _ := strconv.Atoi(strings.ReplaceAll(parts[0], "+QGDCNT: ", ""))
-					totalDownload += download
-				}
-			}
-		}
+func (p *NeighbourCellsProvider) GetKey() string { return "NeighbourCells" }
+func (p *NeighbourCellsProvider) Commands() []string { return []string{cmdNeighbourCells} }
+func (p *NeighbourCellsProvider) Metadata() InfoMetadata {
+	return InfoMetadata{
+		Category:    InfoCategorySignal,
+		ValueType:   "[]NeighbourCell",
+		Description: "LTE and NR neighbour cells, strongest first",
 	}
+}
+func (p *NeighbourCellsProvider) Fetch(ctx context.Context, nri *NRInterface) (interface{}, error) {
+	return nri.FetchNeighbourCellsContext(ctx)
+}
 
-	rawdata = nri.FetchRawData("AT+QGDNRCNT?\r\n", time.Second)
+type DownloadSizeProvider struct{}
 
-	if strings.Contains(rawdata, "OK") {
-		infodata := strings.Split(rawdata, "\r\n")
-		for _, line := range infodata {
-			if strings.Contains(line, "+QGDNRCNT") {
-				parts := strings.Split(line, ",")
-				if len(parts) >= 2 {
-					download, _ := strconv.Atoi(strings.ReplaceAll(parts[0], "+QGDNRCNT: ", ""))
-					totalDownload += download
-				}
-			}
-		}
+func (p *DownloadSizeProvider) GetKey() string { return "DownloadSize" }
+func (p *DownloadSizeProvider) Commands() []string { return []string{cmdLTEDataCounter, cmdNRDataCounter} }
+func (p *DownloadSizeProvider) Metadata() InfoMetadata {
+	return InfoMetadata{
+		Category:    InfoCategoryNetwork,
+		ValueType:   "string",
+		Description: "Downloaded data since the counters were reset",
 	}
+}
+func (p *DownloadSizeProvider) Fetch(ctx context.Context, nri *NRInterface) (interface{}, error) {
 
-	return bytesToSize(float64(totalDownload)), nil
+	_, download, err := nri.fetchDataCounters(ctx)
+	if err != nil {
+		return "", err
+	}
+	return bytesToSize(float64(download)), nil
 }
 
 type UploadSizeProvider struct{}
 
 func (p *UploadSizeProvider) GetKey() string { return "UploadSize" }
-func (p *UploadSizeProvider) Fetch(nri *NRInterface) (interface{}, error) {
-	var totalUpload int
-
-	rawdata := nri.FetchRawData("AT+QGDCNT?\r\n", time.Second)
-
-	if strings.Contains(rawdata, "OK") {
-		infodata := strings.Split(rawdata, "\r\n")
-		for _, line := range infodata {
-			if strings.Contains(line, "+QGDCNT") {
-				parts := strings.Split(line, ",")
-				if len(parts) >= 2 {
-					upload, _ := strconv.Atoi(parts[1])
-					totalUpload += upload
-				}
-			}
-		}
+func (p *UploadSizeProvider) Commands() []string { return []string{cmdLTEDataCounter, cmdNRDataCounter} }
+func (p *UploadSizeProvider) Metadata() InfoMetadata {
+	return InfoMetadata{
+		Category:    InfoCategoryNetwork,
+		ValueType:   "string",
+		Description: "Uploaded data since the counters were reset",
 	}
+}
+func (p *UploadSizeProvider) Fetch(ctx context.Context, nri *NRInterface) (interface{}, error) {
 
-	rawdata = nri.FetchRawData("AT+QGDNRCNT?\r\n", time.Second)
-
-	if strings.Contains(rawdata, "OK") {
-		infodata := strings.Split(rawdata, "\r\n")
-		for _, line := range infodata {
-			if strings.Contains(line, "+QGDNRCNT") {
-				parts := strings.Split(line, ",")
-				if len(parts) >= 2 {
-					upload, _ := strconv.Atoi(parts[1])
-					totalUpload += upload
-				}
-			}
-		}
+	upload, _, err := nri.fetchDataCounters(ctx)
+	if err != nil {
+		return "", err
 	}
-
-	return bytesToSize(float64(totalUpload)), nil
+	return bytesToSize(float64(upload)), nil
 }
 
-type LTERSRPProvider struct{}
-
-func (p *LTERSRPProvider) GetKey() string { return "LTE_RSRP" }
-func (p *LTERSRPProvider) Fetch(nri *NRInterface) (interface{}, error) {
-
-	networkMode, err := nri.GetInfo("NetworkMode")
+func fetchLTECell(ctx context.Context, nri *NRInterface) (*LTECellInfo, error) {
 
+	cell, err := nri.FetchServingCellContext(ctx)
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
-
-	mode, ok := networkMode.(string)
-	if !ok || !strings.Contains(mode, "LTE") {
-		return 0, errors.New("not in LTE mode")
+	if cell.LTE == nil {
+		return nil, errors.New("not in LTE mode")
 	}
+	return cell.LTE, nil
+}
 
-	rawdata := nri.FetchRawData("AT+QENG=\"servingcell\"\r\n", time.Second)
+func fetchNRCell(ctx context.Context, nri *NRInterface) (*NRCellInfo, error) {
 
-	if !strings.Contains(rawdata, "OK") {
-		return 0, errors.New("fetch LTE RSRP failed")
+	cell, err := nri.FetchServingCellContext(ctx)
+	if err != nil {
+		return nil, err
 	}
-	infodata := strings.Split(rawdata, "\r\n")
-	for _, line := range infodata {
-		if strings.Contains(line, "servingcell") {
-			parts := strings.Split(line, ",")
-			if len(parts) >= 15 {
-				return strconv.Atoi(strings.ReplaceAll(parts[12], "\"", ""))
-			}
-		}
+	if cell.NR == nil {
+		return nil, errors.New("not in 5G mode")
 	}
-	return 0, errors.New("LTE RSRP not found")
+	return cell.NR, nil
 }
 
-type LTERSQProvider struct{}
-
-func (p *LTERSQProvider) GetKey() string { return "LTE_RSRQ" }
-func (p *LTERSQProvider) Fetch(nri *NRInterface) (interface{}, error) {
+type LTERSRPProvider struct{}
 
-	networkMode, err := nri.GetInfo("NetworkMode")
+func (p *LTERSRPProvider) GetKey() string { return "LTE_RSRP" }
+func (p *LTERSRPProvider) Commands() []string { return []string{cmdServingCell} }
+func (p *LTERSRPProvider) Metadata() InfoMetadata {
+	return InfoMetadata{
+		Category:    InfoCategorySignal,
+		Unit:        "dBm",
+		ValueType:   "int",
+		Description: "RSRP of the LTE serving cell",
+		RATs:        []string{RATLTE},
+		DependsOn:   []string{"ServingCell"},
+	}
+}
+func (p *LTERSRPProvider) Fetch(ctx context.Context, nri *NRInterface) (interface{}, error) {
 
+	lte, err := fetchLTECell(ctx, nri)
 	if err != nil {
 		return 0, err
 	}
+	return lte.RSRP, nil
+}
 
-	mode, ok := networkMode.(string)
-	if !ok || !strings.Contains(mode, "LTE") {
-		return 0, errors.New("not in LTE mode")
-	}
-
-	rawdata := nri.FetchRawData("AT+QENG=\"servingcell\"\r\n", time.Second)
+type LTERSQProvider struct{}
 
-	if !strings.Contains(rawdata, "OK") {
-		return 0, errors.New("fetch LTE RSRQ failed")
-	}
-	infodata := strings.Split(rawdata, "\r\n")
-	for _, line := range infodata {
-		if strings.Contains(line, "servingcell") {
-			parts := strings.Split(line, ",")
-			if len(parts) >= 15 {
-				return strconv.Atoi(strings.ReplaceAll(parts[13], "\"", ""))
-			}
-		}
+func (p *LTERSQProvider) GetKey() string { return "LTE_RSRQ" }
+func (p *LTERSQProvider) Commands() []string { return []string{cmdServingCell} }
+func (p *LTERSQProvider) Metadata() InfoMetadata {
+	return InfoMetadata{
+		Category:    InfoCategorySignal,
+		Unit:        "dB",
+		ValueType:   "int",
+		Description: "RSRQ of the LTE serving cell",
+		RATs:        []string{RATLTE},
+		DependsOn:   []string{"ServingCell"},
 	}
-	return 0, errors.New("LTE RSRQ not found")
 }
+func (p *LTERSQProvider) Fetch(ctx context.Context, nri *NRInterface) (interface{}, error) {
 
-type LTESINRProvider struct{}
-
-func (p *LTESINRProvider) GetKey() string { return "LTE_SINR" }
-func (p *LTESINRProvider) Fetch(nri *NRInterface) (interface{}, error) {
-
-	networkMode, err := nri.GetInfo("NetworkMode")
-
+	lte, err := fetchLTECell(ctx, nri)
 	if err != nil {
 		return 0, err
 	}
+	return lte.RSRQ, nil
+}
 
-	mode, ok := networkMode.(string)
+type LTESINRProvider struct{}
 
-	if !ok || !strings.Contains(mode, "LTE") {
-		return 0, errors.New("not in LTE mode")
+func (p *LTESINRProvider) GetKey() string { return "LTE_SINR" }
+func (p *LTESINRProvider) Commands() []string { return []string{cmdServingCell} }
+func (p *LTESINRProvider) Metadata() InfoMetadata {
+	return InfoMetadata{
+		Category:    InfoCategorySignal,
+		Unit:        "dB",
+		ValueType:   "int",
+		Description: "SINR of the LTE serving cell",
+		RATs:        []string{RATLTE},
+		DependsOn:   []string{"ServingCell"},
 	}
+}
+func (p *LTESINRProvider) Fetch(ctx context.Context, nri *NRInterface) (interface{}, error) {
 
-	rawdata := nri.FetchRawData("AT+QENG=\"servingcell\"\r\n", time.Second)
-
-	if !strings.Contains(rawdata, "OK") {
-		return 0, errors.New("fetch LTE SINR failed")
-	}
-	infodata := strings.Split(rawdata, "\r\n")
-	for _, line := range infodata {
-		if strings.Contains(line, "servingcell") {
-			parts := strings.Split(line, ",")
-			if len(parts) >= 15 {
-				return strconv.Atoi(strings.ReplaceAll(parts[14], "\"", ""))
-			}
-		}
+	lte, err := fetchLTECell(ctx, nri)
+	if err != nil {
+		return 0, err
 	}
-
-	return 0, errors.New("LTE SINR not found")
+	return lte.SINR, nil
 }
 
 type NRRSRPProvider struct{}
 
 func (p *NRRSRPProvider) GetKey() string { return "NR_RSRP" }
-func (p *NRRSRPProvider) Fetch(nri *NRInterface) (interface{}, error) {
-
-	networkMode, err := nri.GetInfo("NetworkMode")
+func (p *NRRSRPProvider) Commands() []string { return []string{cmdServingCell} }
+func (p *NRRSRPProvider) Metadata() InfoMetadata {
+	return InfoMetadata{
+		Category:    InfoCategorySignal,
+		Unit:        "dBm",
+		ValueType:   "int",
+		Description: "RSRP of the NR serving cell",
+		RATs:        []string{RATNR},
+		DependsOn:   []string{"ServingCell"},
+	}
+}
+func (p *NRRSRPProvider) Fetch(ctx context.Context, nri *NRInterface) (interface{}, error) {
 
+	nr, err := fetchNRCell(ctx, nri)
 	if err != nil {
 		return 0, err
 	}
-
-	mode, ok := networkMode.(string)
-	if !ok || !strings.Contains(mode, "5G") {
-		return 0, errors.New("not in 5G mode")
-	}
-
-	rawdata := nri.FetchRawData("AT+QENG=\"servingcell\"\r\n", time.Second)
-
-	if !strings.Contains(rawdata, "OK") {
-		return 0, errors.New("fetch NR RSRP failed")
-	}
-	infodata := strings.Split(rawdata, "\r\n")
-	for _, line := range infodata {
-		if strings.Contains(line, "servingcell") {
-			parts := strings.Split(line, ",")
-			if len(parts) >= 15 {
-				return strconv.Atoi(strings.ReplaceAll(parts[12], "\"", ""))
-			}
-		}
-	}
-	return 0, errors.New("NR RSRP not found")
+	return nr.RSRP, nil
 }
 
 type NRRSQProvider struct{}
 
 func (p *NRRSQProvider) GetKey() string { return "NR_RSRQ" }
-func (p *NRRSQProvider) Fetch(nri *NRInterface) (interface{}, error) {
-
-	networkMode, err := nri.GetInfo("NetworkMode")
+func (p *NRRSQProvider) Commands() []string { return []string{cmdServingCell} }
+func (p *NRRSQProvider) Metadata() InfoMetadata {
+	return InfoMetadata{
+		Category:    InfoCategorySignal,
+		Unit:        "dB",
+		ValueType:   "int",
+		Description: "RSRQ of the NR serving cell",
+		RATs:        []string{RATNR},
+		DependsOn:   []string{"ServingCell"},
+	}
+}
+func (p *NRRSQProvider) Fetch(ctx context.Context, nri *NRInterface) (interface{}, error) {
 
+	nr, err := fetchNRCell(ctx, nri)
 	if err != nil {
 		return 0, err
 	}
-
-	mode, ok := networkMode.(string)
-	if !ok || !strings.Contains(mode, "5G") {
-		return 0, errors.New("not in 5G mode")
-	}
-
-	rawdata := nri.FetchRawData("AT+QENG=\"servingcell\"\r\n", time.Second)
-
-	if !strings.Contains(rawdata, "OK") {
-		return 0, errors.New("fetch NR RSRQ failed")
-	}
-	infodata := strings.Split(rawdata, "\r\n")
-	for _, line := range infodata {
-		if strings.Contains(line, "servingcell") {
-			parts := strings.Split(line, ",")
-			if len(parts) >= 15 {
-				return strconv.Atoi(strings.ReplaceAll(parts[13], "\"", ""))
-			}
-		}
-	}
-	return 0, errors.New("NR RSRQ not found")
+	return nr.RSRQ, nil
 }
 
 type NRSINRProvider struct{}
 
 func (p *NRSINRProvider) GetKey() string { return "NR_SINR" }
-func (p *NRSINRProvider) Fetch(nri *NRInterface) (interface{}, error) {
-
-	networkMode, err := nri.GetInfo("NetworkMode")
+func (p *NRSINRProvider) Commands() []string { return []string{cmdServingCell} }
+func (p *NRSINRProvider) Metadata() InfoMetadata {
+	return InfoMetadata{
+		Category:    InfoCategorySignal,
+		Unit:        "dB",
+		ValueType:   "int",
+		Description: "SINR of the NR serving cell",
+		RATs:        []string{RATNR},
+		DependsOn:   []string{"ServingCell"},
+	}
+}
+func (p *NRSINRProvider) Fetch(ctx context.Context, nri *NRInterface) (interface{}, error) {
 
+	nr, err := fetchNRCell(ctx, nri)
 	if err != nil {
 		return 0, err
 	}
-
-	mode, ok := networkMode.(string)
-	if !ok || !strings.Contains(mode, "5G") {
-		return 0, errors.New("not in 5G mode")
-	}
-
-	rawdata := nri.FetchRawData("AT+QENG=\"servingcell\"\r\n", time.Second)
-
-	if !strings.Contains(rawdata, "OK") {
-		return 0, errors.New("fetch NR SINR failed")
-	}
-	infodata := strings.Split(rawdata, "\r\n")
-	for _, line := range infodata {
-		if strings.Contains(line, "servingcell") {
-			parts := strings.Split(line, ",")
-			if len(parts) >= 15 {
-				return strconv.Atoi(strings.ReplaceAll(parts[14], "\"", ""))
-			}
-		}
-	}
-	return 0, errors.New("NR SINR not found")
+	return nr.SINR, nil
 }
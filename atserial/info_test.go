@@ -0,0 +1,165 @@
+package atserial
+
+import (
+	"errors"
+	"context"
+	"testing"
+)
+
+const fakeServingCellLTE = "\r\n+QENG: \"servingcell\",\"NOCONN\",\"LTE\",\"FDD\",460,01,5F1A2B3,123,1850,3,5,5,1A2B,-95,-10,-65,12,10,20,40\r\n\r\nOK\r\n"
+
+func newFakeInterface() (*NRInterface, *FakeTransport) {
+
+	fake := NewFakeTransport()
+	fake.SetResponse(cmdModuleName, "\r\nQuectel\r\nRM520N-GL\r\nRevision: RM520NGLAAR01A07M4G\r\n\r\nOK\r\n")
+	fake.SetResponse(cmdCPUTemp, "\r\n+QTEMP: \"cpu0-a7-usr\",\"45\"\r\n+QTEMP: \"modem-ambient-usr\",\"41\"\r\n\r\nOK\r\n")
+	fake.SetResponse(cmdMCCMNC, "\r\n+QSPN: \"CMCC\",\"CMCC\",\"\",0,\"46000\"\r\n\r\nOK\r\n")
+	fake.SetResponse(cmdServingCell, fakeServingCellLTE)
+
+	return NewNRInterfaceWithTransport(fake), fake
+}
+
+func countRequests(fake *FakeTransport, cmd string) int {
+
+	n := 0
+	for _, req := range fake.Requests() {
+		if string(req.Data) == cmd+"\r\n" {
+			n++
+		}
+	}
+	return n
+}
+
+func TestGetInfo(t *testing.T) {
+
+	nri, _ := newFakeInterface()
+
+	tests := []struct {
+		key  string
+		want interface{}
+	}{
+		{"ModuleName", "QuectelRM520N-GL"},
+		{"ModuleCPUTemp", 45},
+		{"MCCMNC", 46000},
+		{"NetworkMode", "LTE"},
+		{"LTE_RSRP", -95},
+		{"LTE_RSRQ", -10},
+	}
+	for _, tt := range tests {
+		got, err := nri.GetInfo(tt.key)
+		if err != nil {
+			t.Errorf("%s: %v", tt.key, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s: got %v (%T), want %v", tt.key, got, got, tt.want)
+		}
+	}
+}
+
+func TestGetInfoNoResponse(t *testing.T) {
+
+	nri, fake := newFakeInterface()
+	fake.SetResponse(cmdMCCMNC, "\r\nERROR\r\n")
+
+	if got, err := nri.GetInfo("MCCMNC"); err == nil {
+		t.Fatalf("got %v without an error", got)
+	}
+}
+
+func TestGetInfoNotApplicable(t *testing.T) {
+
+	nri, _ := newFakeInterface()
+
+	if _, err := nri.GetInfo("NR_RSRP"); !errors.Is(err, ErrInfoNotApplicable) {
+		t.Fatalf("got %v, want ErrInfoNotApplicable", err)
+	}
+
+	info, err := nri.FetchMultipleInfo([]string{"NR_RSRP", "LTE_RSRP"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := info["NR_RSRP"]; ok || info["LTE_RSRP"] != -95 {
+		t.Fatalf("got %v", info)
+	}
+}
+
+func TestGetInfoCMEError(t *testing.T) {
+
+	nri, fake := newFakeInterface()
+	fake.SetResponse(cmdMCCMNC, "\r\n+CME ERROR: 10\r\n")
+
+	_, err := nri.GetInfo("MCCMNC")
+	var cme *CMEError
+	if !errors.As(err, &cme) || cme.Code != 10 {
+		t.Fatalf("got %v, want +CME ERROR: 10", err)
+	}
+}
+
+func TestGetInfoDependencyFailure(t *testing.T) {
+
+	nri, fake := newFakeInterface()
+	fake.SetResponse(cmdServingCell, "\r\nERROR\r\n")
+
+	if _, err := nri.GetInfo("CellID"); err == nil {
+		t.Fatal("expected CellID to fail with its ServingCell dependency")
+	}
+}
+
+func TestFetchMultipleInfoSendsCommandsOnce(t *testing.T) {
+
+	nri, fake := newFakeInterface()
+
+	keys := []string{"NetworkMode", "DuplexMode", "CellID", "LTE_RSRP", "LTE_RSRQ", "LTE_SINR", "ModuleName"}
+	info, err := nri.FetchMultipleInfo(keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(info) != len(keys) {
+		t.Fatalf("got %d values: %v", len(info), info)
+	}
+	if n := countRequests(fake, cmdServingCell); n != 1 {
+		t.Fatalf("serving cell queried %d times, want 1", n)
+	}
+}
+
+func TestFetchMultipleInfoUnknownKey(t *testing.T) {
+
+	nri, _ := newFakeInterface()
+
+	info, err := nri.FetchMultipleInfo([]string{"ModuleName", "NoSuchKey"})
+	if err == nil {
+		t.Fatal("expected an error for an unknown key")
+	}
+	if info["ModuleName"] != "QuectelRM520N-GL" {
+		t.Fatalf("got %v", info)
+	}
+}
+
+func TestGetInfoServingCellCMEError(t *testing.T) {
+
+	nri, fake := newFakeInterface()
+	fake.SetResponse(cmdServingCell, "\r\n+CME ERROR: 30\r\n")
+
+	providers := []InfoProvider{&NetworkModeProvider{}, &DuplexModeProvider{}, &CellIDProvider{}}
+	for _, p := range providers {
+		_, err := p.Fetch(context.Background(), nri)
+		var cme *CMEError
+		if !errors.As(err, &cme) || cme.Code != 30 {
+			t.Errorf("%s: got %v, want +CME ERROR: 30", p.GetKey(), err)
+		}
+	}
+}
+
+func TestGetInfoDataCountersFailure(t *testing.T) {
+
+	nri, fake := newFakeInterface()
+	fake.SetResponse(cmdLTEDataCounter, "\r\nERROR\r\n")
+	fake.SetResponse(cmdNRDataCounter, "\r\nERROR\r\n")
+
+	for _, key := range []string{"DownloadSize", "UploadSize"} {
+		if got, err := nri.GetInfo(key); err == nil {
+			t.Errorf("%s: got %v without an error", key, got)
+		}
+	}
+}
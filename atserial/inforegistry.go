@@ -0,0 +1,200 @@
+package atserial
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"errors"
+	"strings"
+)
+
+// Info categories, matching the sections of !info.
+const (
+	InfoCategoryModule  = "module"
+	InfoCategoryNetwork = "network"
+	InfoCategorySignal  = "signal"
+	InfoCategoryOther   = "other"
+)
+
+// Radio access technologies an info value can be limited to.
+const (
+	RATLTE = "LTE"
+	RATNR  = "NR"
+)
+
+// ErrInfoNotApplicable is returned by GetInfo for a key whose RATs do not
+// include the serving cell, e.g. LTE_RSRP on NR5G-SA. FetchMultipleInfo skips
+// such keys without an error.
+var ErrInfoNotApplicable = errors.New("not applicable to the serving cell")
+
+// InfoMetadata describes the value of a provider. ValueType is the Go type
+// Fetch returns. RATs limits the value to serving cells of these RATs, empty
+// means any. The keys in DependsOn are fetched first; when one of them fails
+// or does not apply, the provider is not fetched.
+type InfoMetadata struct {
+	Key         string   `json:"key"`
+	Category    string   `json:"category"`
+	Unit        string   `json:"unit,omitempty"`
+	ValueType   string   `json:"value_type"`
+	Description string   `json:"description"`
+	RATs        []string `json:"rats,omitempty"`
+	DependsOn   []string `json:"depends_on,omitempty"`
+}
+
+// MetadataProvider is implemented by info providers that describe their
+// value. Providers without it are listed in InfoCategoryOther.
+type MetadataProvider interface {
+	Metadata() InfoMetadata
+}
+
+// InfoRegistry maps keys to providers. It is safe for concurrent use, so
+// providers can be registered while info is being fetched.
+type InfoRegistry struct {
+	mu        sync.RWMutex
+	providers map[string]InfoProvider
+}
+
+func NewInfoRegistry() *InfoRegistry {
+	return &InfoRegistry{
+		providers: make(map[string]InfoProvider),
+	}
+}
+
+// Register adds provider or replaces the provider with the same key.
+func (r *InfoRegistry) Register(provider InfoProvider) {
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.providers[provider.GetKey()] = provider
+}
+
+func (r *InfoRegistry) Get(key string) (InfoProvider, bool) {
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	provider, ok := r.providers[key]
+	return provider, ok
+}
+
+// GetAllKeys returns the registered keys in alphabetical order.
+func (r *InfoRegistry) GetAllKeys() []string {
+
+	r.mu.RLock()
+	keys := make([]string, 0, len(r.providers))
+	for k := range r.providers {
+		keys = append(keys, k)
+	}
+	r.mu.RUnlock()
+
+	sort.Strings(keys)
+	return keys
+}
+
+func (r *InfoRegistry) Metadata(key string) (InfoMetadata, bool) {
+
+	provider, ok := r.Get(key)
+	if !ok {
+		return InfoMetadata{}, false
+	}
+	return providerMetadata(provider), true
+}
+
+// AllMetadata describes every registered key, sorted by category and key.
+func (r *InfoRegistry) AllMetadata() []InfoMetadata {
+
+	r.mu.RLock()
+	all := make([]InfoMetadata, 0, len(r.providers))
+	for _, provider := range r.providers {
+		all = append(all, providerMetadata(provider))
+	}
+	r.mu.RUnlock()
+
+	sort.Slice(all, func(i, j int) bool {
+		if all[i].Category != all[j].Category {
+			return all[i].Category < all[j].Category
+		}
+		return all[i].Key < all[j].Key
+	})
+	return all
+}
+
+// Resolve returns keys and the keys they depend on, each after its
+// dependencies. It fails for unknown keys and dependency cycles.
+func (r *InfoRegistry) Resolve(keys []string) ([]string, error) {
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	const (
+		visiting = 1
+		resolved = 2
+	)
+	state := make(map[string]int)
+	var order []string
+
+	var visit func(key string, path []string) error
+	visit = func(key string, path []string) error {
+
+		switch state[key] {
+		case resolved:
+			return nil
+		case visiting:
+			return fmt.Errorf("info dependency cycle: %s", strings.Join(append(path, key), " -> "))
+		}
+
+		provider, ok := r.providers[key]
+		if !ok {
+			if len(path) == 0 {
+				return fmt.Errorf("provider not found for key: %s", key)
+			}
+			return fmt.Errorf("%s depends on unknown key %s", path[len(path)-1], key)
+		}
+
+		state[key] = visiting
+		for _, dep := range providerMetadata(provider).DependsOn {
+			if err := visit(dep, append(path, key)); err != nil {
+				return err
+			}
+		}
+		state[key] = resolved
+		order = append(order, key)
+		return nil
+	}
+
+	for _, key := range keys {
+		if err := visit(key, nil); err != nil {
+			return nil, err
+		}
+	}
+	return order, nil
+}
+
+func providerMetadata(provider InfoProvider) InfoMetadata {
+
+	var meta InfoMetadata
+	if described, ok := provider.(MetadataProvider); ok {
+		meta = described.Metadata()
+	}
+	meta.Key = provider.GetKey()
+	if meta.Category == "" {
+		meta.Category = InfoCategoryOther
+	}
+	return meta
+}
+
+// appliesTo reports whether the value exists for a serving cell of rats. An
+// unknown serving cell (nil rats) does not rule anything out.
+func (meta InfoMetadata) appliesTo(rats []string) bool {
+
+	if len(meta.RATs) == 0 || rats == nil {
+		return true
+	}
+	for _, rat := range meta.RATs {
+		if containsString(rats, rat) {
+			return true
+		}
+	}
+	return false
+}
@@ -6,6 +6,7 @@ import (
 	"sync"
 	"time"
 	"errors"
+	"context"
 	"strings"
 )
 
@@ -13,6 +14,8 @@ type NRInterfacePort struct {
 	LocalBaudRate int
 	LocalPort     string
 	RemoteAPI     string
+	RemoteToken   string
+	CaptureFile   string
 }
 
 type NRInterface struct {
@@ -20,12 +23,21 @@ type NRInterface struct {
 	LocalSerial     string
 	LocalSerialBaud int
 	RemoteSerial    string
+	SMSPDUMode      bool
+	// ChainCommands sends the batched commands of FetchMultipleInfo and the
+	// Fetch*Info methods as chained lines such as `AT+QSPN;+CGCONTRDP`
+	ChainCommands   bool
 
-	mu         sync.Mutex
-	supervisor *SerialSupervisor
-	reqID      uint32
+	mu        sync.Mutex
+	transport Transport
+	reqID     uint32
+
+	urcBus *URCBus
 
 	infoRegistry *InfoRegistry
+
+	scanMu sync.Mutex
+	scan   *NetworkScan
 }
 
 func (nri *NRInterface) registerDefaultInfoProviders() {
@@ -42,6 +54,9 @@ func (nri *NRInterface) registerDefaultInfoProviders() {
 	nri.infoRegistry.Register(&NetworkModeProvider{})
 	nri.infoRegistry.Register(&DuplexModeProvider{})
 	nri.infoRegistry.Register(&CellIDProvider{})
+	nri.infoRegistry.Register(&ServingCellProvider{})
+	nri.infoRegistry.Register(&NeighbourCellsProvider{})
+	nri.infoRegistry.Register(&CarrierAggregationProvider{})
 	nri.infoRegistry.Register(&DownloadSizeProvider{})
 	nri.infoRegistry.Register(&UploadSizeProvider{})
 
@@ -55,19 +70,49 @@ func (nri *NRInterface) registerDefaultInfoProviders() {
 
 func NewNRInterface(port NRInterfacePort, isLocal bool) *NRInterface {
 
+	var transport Transport
+	if isLocal {
+		log.Println("[NRInterface] create local serial daemon on", port.LocalPort)
+		local := NewLocalTransport(port.LocalPort, port.LocalBaudRate)
+		if port.CaptureFile != "" {
+			if recorder, err := NewCaptureRecorder(port.CaptureFile); err != nil {
+				log.Println("[NRInterface] open capture file failed:", err)
+			} else {
+				log.Println("[NRInterface] recording serial session to", port.CaptureFile)
+				local.Supervisor().SetRecorder(recorder)
+			}
+		}
+		transport = local
+	} else {
+		if port.CaptureFile != "" {
+			log.Println("[NRInterface] capture_file is ignored for a remote serial, set it on the serving side")
+		}
+		log.Println("[NRInterface] create remote serial via", port.RemoteAPI)
+		transport = NewRemoteTransport(port.RemoteAPI, port.RemoteToken)
+	}
+
+	nri := NewNRInterfaceWithTransport(transport)
+	nri.IsLocal = isLocal
+	nri.LocalSerial = port.LocalPort
+	nri.LocalSerialBaud = port.LocalBaudRate
+	nri.RemoteSerial = port.RemoteAPI
+
+	return nri
+}
+
+// NewNRInterfaceWithTransport builds an interface on any Transport, such as a
+// FakeTransport in tests or a custom bridge.
+func NewNRInterfaceWithTransport(transport Transport) *NRInterface {
+
 	nri := &NRInterface{
-		IsLocal:         isLocal,
-		LocalSerial:     port.LocalPort,
-		LocalSerialBaud: port.LocalBaudRate,
-		RemoteSerial:    port.RemoteAPI,
-		infoRegistry:    NewInfoRegistry(),
+		transport:    transport,
+		infoRegistry: NewInfoRegistry(),
 	}
 
-	if isLocal {
-		log.Println("[NRInterface] create local serial daemon on", nri.LocalSerial)
-		nri.supervisor = NewSupervisor(nri.LocalSerial, nri.LocalSerialBaud)
+	if source, ok := transport.(URCSource); ok {
+		nri.urcBus = source.URCBus()
 	} else {
-		log.Println("[NRInterface] create remote serial via", nri.RemoteSerial)
+		nri.urcBus = NewURCBus()
 	}
 
 	nri.registerDefaultInfoProviders()
@@ -75,19 +120,40 @@ func NewNRInterface(port NRInterfacePort, isLocal bool) *NRInterface {
 	return nri
 }
 
+func (nri *NRInterface) Transport() Transport {
+	return nri.transport
+}
+
+func (nri *NRInterface) Health() error {
+	return nri.transport.Health()
+}
+
+func (nri *NRInterface) SubscribeURC(types ...URCType) (<-chan URCEvent, func()) {
+
+	return nri.urcBus.Subscribe(types...)
+}
+
 func (nri *NRInterface) RegisterInfoProvider(provider InfoProvider) {
 
 	nri.infoRegistry.Register(provider)
 }
 
 func (nri *NRInterface) GetInfo(key string) (interface{}, error) {
+	return nri.GetInfoContext(context.Background(), key)
+}
 
-	provider, exists := nri.infoRegistry.Get(key)
-	if !exists {
-		return nil, errors.New("info provider not found for key: " + key)
-	}
+// GetInfoContext fetches key after its dependencies. A key that does not
+// apply to the serving cell fails with ErrInfoNotApplicable.
+func (nri *NRInterface) GetInfoContext(ctx context.Context, key string) (interface{}, error) {
 
-	return provider.Fetch(nri)
+	values, errs, err := nri.fetchInfo(ctx, []string{key})
+	if err != nil {
+		return nil, err
+	}
+	if err := errs[key]; err != nil {
+		return nil, err
+	}
+	return values[key], nil
 }
 
 func (nri *NRInterface) GetAllInfoKeys() []string {
@@ -95,136 +161,217 @@ func (nri *NRInterface) GetAllInfoKeys() []string {
 	return nri.infoRegistry.GetAllKeys()
 }
 
+// InfoMetadata describes the value of key, false for unknown keys.
+func (nri *NRInterface) InfoMetadata(key string) (InfoMetadata, bool) {
+
+	return nri.infoRegistry.Metadata(key)
+}
+
+// ListInfo describes every registered key, sorted by category and key.
+func (nri *NRInterface) ListInfo() []InfoMetadata {
+
+	return nri.infoRegistry.AllMetadata()
+}
+
 func (nri *NRInterface) FetchAllInfo() (map[string]interface{}, error) {
+	return nri.FetchAllInfoContext(context.Background())
+}
 
-	result := make(map[string]interface{})
-	errors := make([]string, 0)
+func (nri *NRInterface) FetchAllInfoContext(ctx context.Context) (map[string]interface{}, error) {
 
-	keys := nri.infoRegistry.GetAllKeys()
+	return nri.FetchMultipleInfoContext(ctx, nri.infoRegistry.GetAllKeys())
+}
 
+func (nri *NRInterface) FetchMultipleInfo(keys []string) (map[string]interface{}, error) {
+	return nri.FetchMultipleInfoContext(context.Background(), keys)
+}
+
+// FetchMultipleInfoContext sends the commands of the providers of keys as one
+// batch first and then resolves the providers in dependency order from the
+// batched answers, see fetchInfo. Once ctx is done it stops with the values
+// fetched so far. Keys that do not apply to the serving cell are left out
+// without an error.
+func (nri *NRInterface) FetchMultipleInfoContext(ctx context.Context, keys []string) (map[string]interface{}, error) {
+
+	failures := make([]string, 0)
+
+	known := make([]string, 0, len(keys))
 	for _, key := range keys {
-		provider, exists := nri.infoRegistry.Get(key)
-		if !exists {
-			errors = append(errors, fmt.Sprintf("provider not found for key: %s", key))
+		if _, exists := nri.infoRegistry.Get(key); !exists {
+			failures = append(failures, fmt.Sprintf("provider not found for key: %s", key))
 			continue
 		}
+		known = append(known, key)
+	}
 
-		info, err := provider.Fetch(nri)
-		if err != nil {
-			errors = append(errors, fmt.Sprintf("error fetching %s: %v", key, err))
-			continue
+	result, errs, err := nri.fetchInfo(ctx, known)
+	if err != nil {
+		return result, err
+	}
+	for _, key := range known {
+		if err := errs[key]; err != nil && !errors.Is(err, ErrInfoNotApplicable) {
+			failures = append(failures, fmt.Sprintf("error fetching %s: %v", key, err))
 		}
-		result[key] = info
 	}
 
-	if len(errors) > 0 {
-		return result, fmt.Errorf("encountered %d errors: %s", len(errors), strings.Join(errors, "; "))
+	if len(failures) > 0 {
+		return result, fmt.Errorf("encountered %d errors: %s", len(failures), strings.Join(failures, "; "))
 	}
 
 	return result, nil
 }
 
-func (nri *NRInterface) FetchMultipleInfo(keys []string) (map[string]interface{}, error) {
+// fetchInfo fetches keys and their dependencies in dependency order and
+// returns the values and errors of keys. The commands declared by the
+// providers (see CommandDeclarer) are sent once up front, so providers
+// reading the same command share one round-trip. The error is only set when
+// the keys cannot be resolved or ctx is done.
+func (nri *NRInterface) fetchInfo(ctx context.Context, keys []string) (map[string]interface{}, map[string]error, error) {
 
-	result := make(map[string]interface{})
-	errors := make([]string, 0)
+	values := make(map[string]interface{})
+	errs := make(map[string]error)
+
+	order, err := nri.infoRegistry.Resolve(keys)
+	if err != nil {
+		return values, errs, err
+	}
+	ctx = nri.withCommandBatch(ctx, nri.infoCommands(order))
+
+	fetched := make(map[string]interface{})
+	failed := make(map[string]error)
+	var rats []string
+	ratsKnown := false
+
+	for _, key := range order {
+		if err := ctx.Err(); err != nil {
+			return values, errs, err
+		}
 
-	for _, key := range keys {
 		provider, exists := nri.infoRegistry.Get(key)
 		if !exists {
-			errors = append(errors, fmt.Sprintf("provider not found for key: %s", key))
+			failed[key] = fmt.Errorf("provider not found for key: %s", key)
+			continue
+		}
+		meta := providerMetadata(provider)
+
+		var depErr error
+		for _, dep := range meta.DependsOn {
+			if err, ok := failed[dep]; ok {
+				depErr = fmt.Errorf("depends on %s: %w", dep, err)
+				break
+			}
+		}
+		if depErr != nil {
+			failed[key] = depErr
 			continue
 		}
 
-		info, err := provider.Fetch(nri)
-		if err != nil {
-			errors = append(errors, fmt.Sprintf("error fetching %s: %v", key, err))
+		if len(meta.RATs) > 0 && !ratsKnown {
+			rats = nri.servingRATs(ctx)
+			ratsKnown = true
+		}
+		if !meta.appliesTo(rats) {
+			serving := strings.Join(rats, "+")
+			if serving == "" {
+				serving = "none"
+			}
+			failed[key] = fmt.Errorf("%s needs %s: %w (serving %s)", key, strings.Join(meta.RATs, "/"), ErrInfoNotApplicable, serving)
 			continue
 		}
 
-		result[key] = info
+		info, err := provider.Fetch(ctx, nri)
+		if err != nil {
+			failed[key] = err
+			continue
+		}
+		fetched[key] = info
 	}
 
-	if len(errors) > 0 {
-		return result, fmt.Errorf("encountered %d errors: %s", len(errors), strings.Join(errors, "; "))
+	for _, key := range keys {
+		if err, ok := failed[key]; ok {
+			errs[key] = err
+		} else if info, ok := fetched[key]; ok {
+			values[key] = info
+		}
 	}
-
-	return result, nil
+	return values, errs, nil
 }
 
-func (nri *NRInterface) FetchModuleInfo() (map[string]interface{}, error) {
+// servingRATs returns the RATs of the serving cell, nil when it is unknown.
+func (nri *NRInterface) servingRATs(ctx context.Context) []string {
 
-	keys := []string{
-		"ModuleName",
-		"ModuleCPUTemp",
-		"SimStatus",
-		"SimActive",
+	cell, err := nri.FetchServingCellContext(ctx)
+	if err != nil {
+		return nil
 	}
 
-	return nri.FetchMultipleInfo(keys)
+	rats := []string{}
+	if cell.LTE != nil {
+		rats = append(rats, RATLTE)
+	}
+	if cell.NR != nil {
+		rats = append(rats, RATNR)
+	}
+	return rats
 }
 
-func (nri *NRInterface) FetchNetworkInfo() (map[string]interface{}, error) {
+func (nri *NRInterface) FetchRawData(atcommand string, timeout time.Duration) string {
+	return nri.FetchRawDataContext(context.Background(), atcommand, timeout)
+}
 
-	isActive, _ := nri.GetInfo("SimStatus")
-	if isActive.(bool) {
-		keys := []string{
-			"NetworkMode",
-			"DuplexMode",
-			"MCCMNC",
-			"APN",
-			"CellID",
-			"IPV4",
-			"IPV6",
-			"UploadSize",
-			"DownloadSize",
-		}
+func (nri *NRInterface) FetchRawDataContext(ctx context.Context, atcommand string, timeout time.Duration) string {
 
-		return nri.FetchMultipleInfo(keys)
-	} else {
-		return nil, errors.New("network inactivity")
-	}
+	return nri.fetchRawData(ctx, SerialRequest{
+		Data:    []byte(atcommand),
+		Timeout: timeout,
+	})
 }
-func (nri *NRInterface) FetchSignalInfo(mode string) (map[string]interface{}, error) {
 
-	if strings.Contains(mode, "NR") {
-		keys := []string{
-			"NR_RSRP",
-			"NR_RSRQ",
-			"NR_SINR",
-		}
-		return nri.FetchMultipleInfo(keys)
-	} else if strings.Contains(mode, "LTE") {
-		keys := []string{
-			"LTE_RSRP",
-			"LTE_RSRQ",
-			"LTE_SINR",
+func (nri *NRInterface) query(ctx context.Context, req SerialRequest) (SerialResponse, error) {
+
+	if batch := commandBatchFrom(ctx); batch != nil && len(req.Payload) == 0 && !req.Preemptible {
+		if result, ok := batch.lookup(string(req.Data)); ok {
+			return result.rsp, result.err
 		}
-		return nri.FetchMultipleInfo(keys)
 	}
 
-	return nil, errors.New("network mode not recognized")
-}
-
-func (nri *NRInterface) FetchRawData(atcommand string, timeout time.Duration) string {
+	nri.mu.Lock()
+	nri.reqID++
+	req.ID = nri.reqID
+	nri.mu.Unlock()
 
-	if nri.IsLocal {
-		return nri.fetchRawDataLocal(atcommand, timeout)
-	}
+	return nri.transport.Query(ctx, req)
+}
 
-	return nri.fetchRawDataRemote(atcommand)
+// Execute sends atcommand and parses the answer. A final result code other
+// than OK is returned as *CMEError, *CMSError or ErrCommandFailed together
+// with the response.
+func (nri *NRInterface) Execute(atcommand string, timeout time.Duration) (*ATResponse, error) {
+	return nri.ExecuteContext(context.Background(), atcommand, timeout)
 }
 
-func (nri *NRInterface) fetchRawDataLocal(atcommand string, timeout time.Duration) string {
+// ExecuteContext is Execute with a context, see Transport for how
+// cancellation is handled.
+func (nri *NRInterface) ExecuteContext(ctx context.Context, atcommand string, timeout time.Duration) (*ATResponse, error) {
 
-	nri.reqID++
-	req := SerialRequest{
-		ID:      nri.reqID,
+	return nri.execute(ctx, SerialRequest{
 		Data:    []byte(atcommand),
 		Timeout: timeout,
+	})
+}
+
+func (nri *NRInterface) execute(ctx context.Context, req SerialRequest) (*ATResponse, error) {
+
+	rsp, err := nri.query(ctx, req)
+	if err != nil {
+		return nil, err
 	}
+	return rsp.ATResponse()
+}
+
+func (nri *NRInterface) fetchRawData(ctx context.Context, req SerialRequest) string {
 
-	rsp, err := nri.supervisor.Query(req)
+	rsp, err := nri.query(ctx, req)
 	if err != nil {
 		log.Println("[NRInterface] serial query error:", err)
 		return ""
@@ -235,15 +382,9 @@ func (nri *NRInterface) fetchRawDataLocal(atcommand string, timeout time.Duratio
 	return string(rsp.Data)
 }
 
-func (nri *NRInterface) fetchRawDataRemote(atcommand string) string {
-
-	log.Println("[NRInterface] http api not implemented yet")
-	return ""
-}
-
 func (nri *NRInterface) Close() {
 
-	if nri.supervisor != nil && nri.IsLocal {
-		nri.supervisor = nil
+	if err := nri.transport.Close(); err != nil {
+		log.Println("[NRInterface] close transport failed:", err)
 	}
 }
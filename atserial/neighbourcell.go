@@ -0,0 +1,104 @@
+package atserial
+
+import (
+	"fmt"
+	"sort"
+	"time"
+	"context"
+	"strings"
+)
+
+// NeighbourCell is one line of AT+QENG="neighbourcell". ARFCN is the EARFCN
+// for LTE cells; RSSI is only reported for LTE.
+type NeighbourCell struct {
+	RAT   string
+	Scope string
+	ARFCN int
+	PCI   int
+	RSRP  int
+	RSRQ  int
+	RSSI  int
+	SINR  int
+}
+
+const (
+	NeighbourIntra = "intra"
+	NeighbourInter = "inter"
+)
+
+// ParseNeighbourCells parses the LTE and NR entries of
+// AT+QENG="neighbourcell", strongest RSRP first. Other RATs are skipped.
+func ParseNeighbourCells(raw string) ([]NeighbourCell, error) {
+
+	rsp, err := parseOKResponse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("fetch neighbour cells failed: %w", err)
+	}
+	return parseNeighbourCells(rsp), nil
+}
+
+func parseNeighbourCells(rsp *ATResponse) []NeighbourCell {
+
+	var cells []NeighbourCell
+
+	for _, line := range rsp.Lines {
+		if !strings.HasPrefix(line, "+QENG:") {
+			continue
+		}
+
+		p := splitATParams(strings.TrimPrefix(line, "+QENG:"))
+		if len(p) < 2 || !strings.HasPrefix(p[0], "neighbourcell") {
+			continue
+		}
+		scope := strings.TrimSpace(strings.TrimPrefix(p[0], "neighbourcell"))
+
+		switch p[1] {
+		case "LTE":
+			// "LTE",<earfcn>,<PCID>,<RSRQ>,<RSRP>,<RSSI>,<SINR>,...
+			if len(p) < 8 {
+				continue
+			}
+			cells = append(cells, NeighbourCell{
+				RAT:   "LTE",
+				Scope: scope,
+				ARFCN: atoiField(p[2]),
+				PCI:   atoiField(p[3]),
+				RSRQ:  atoiField(p[4]),
+				RSRP:  atoiField(p[5]),
+				RSSI:  atoiField(p[6]),
+				SINR:  atoiField(p[7]),
+			})
+		case "NR":
+			// "NR",<ARFCN>,<PCID>,<RSRP>,<RSRQ>,<SINR>,...
+			if len(p) < 7 {
+				continue
+			}
+			cells = append(cells, NeighbourCell{
+				RAT:   "NR",
+				Scope: scope,
+				ARFCN: atoiField(p[2]),
+				PCI:   atoiField(p[3]),
+				RSRP:  atoiField(p[4]),
+				RSRQ:  atoiField(p[5]),
+				SINR:  atoiField(p[6]),
+			})
+		}
+	}
+
+	sort.SliceStable(cells, func(i, j int) bool { return cells[i].RSRP > cells[j].RSRP })
+
+	return cells
+}
+
+func (nri *NRInterface) FetchNeighbourCells() ([]NeighbourCell, error) {
+	return nri.FetchNeighbourCellsContext(context.Background())
+}
+
+func (nri *NRInterface) FetchNeighbourCellsContext(ctx context.Context) ([]NeighbourCell, error) {
+
+	rsp, err := nri.ExecuteContext(ctx, cmdNeighbourCells+"\r\n", 2*time.Second)
+	if err != nil {
+		return nil, fmt.Errorf("fetch neighbour cells failed: %w", err)
+	}
+	return parseNeighbourCells(rsp), nil
+}
@@ -0,0 +1,953 @@
+package atserial
+
+import (
+	"fmt"
+	"time"
+	"errors"
+	"strings"
+	"encoding/hex"
+	"unicode/utf16"
+)
+
+type SMSPDUType int
+
+const (
+	SMSDeliver SMSPDUType = iota
+	SMSSubmit
+	SMSStatusReport
+)
+
+type SMSEncoding int
+
+const (
+	EncodingGSM7 SMSEncoding = iota
+	Encoding8Bit
+	EncodingUCS2
+)
+
+func (e SMSEncoding) String() string {
+
+	switch e {
+	case EncodingGSM7:
+		return "GSM7"
+	case Encoding8Bit:
+		return "8bit"
+	case EncodingUCS2:
+		return "UCS2"
+	default:
+		return "unknown"
+	}
+}
+
+const (
+	TONUnknown         = 0
+	TONInternational   = 1
+	TONNational        = 2
+	TONNetworkSpecific = 3
+	TONSubscriber      = 4
+	TONAlphanumeric    = 5
+	TONAbbreviated     = 6
+)
+
+type SMSAddress struct {
+	Number string
+	TON    int
+	NPI    int
+}
+
+func (a SMSAddress) String() string {
+
+	if a.TON == TONInternational && a.Number != "" {
+		return "+" + a.Number
+	}
+	return a.Number
+}
+
+func (a SMSAddress) TypeName() string {
+
+	switch a.TON {
+	case TONInternational:
+		return "international"
+	case TONNational:
+		return "national"
+	case TONNetworkSpecific:
+		return "network"
+	case TONSubscriber:
+		return "subscriber"
+	case TONAlphanumeric:
+		return "alphanumeric"
+	case TONAbbreviated:
+		return "abbreviated"
+	default:
+		return "unknown"
+	}
+}
+
+// NewSMSAddress builds a numeric address, "+" marks an international number.
+func NewSMSAddress(number string) SMSAddress {
+
+	number = strings.TrimSpace(number)
+	if strings.HasPrefix(number, "+") {
+		return SMSAddress{Number: number[1:], TON: TONInternational, NPI: 1}
+	}
+	return SMSAddress{Number: number, TON: TONUnknown, NPI: 1}
+}
+
+type UDHElement struct {
+	ID   byte
+	Data []byte
+}
+
+const (
+	udhConcat8Bit  = 0x00
+	udhConcat16Bit = 0x08
+)
+
+// SMSConcat is the concatenation info of one part of a multipart message.
+type SMSConcat struct {
+	Ref   int
+	Total int
+	Seq   int
+}
+
+// SMSReportStatus is the TP-Status of an SMS-STATUS-REPORT (3GPP TS 23.040
+// 9.2.3.15).
+type SMSReportStatus byte
+
+// Delivered reports whether the message reached the recipient.
+func (s SMSReportStatus) Delivered() bool {
+	return s < 0x20
+}
+
+// Final reports whether the service centre stopped trying, either because
+// the message was delivered or because it gave up.
+func (s SMSReportStatus) Final() bool {
+	return s < 0x20 || s >= 0x40
+}
+
+func (s SMSReportStatus) String() string {
+
+	switch {
+	case s == 0x00:
+		return "delivered"
+	case s == 0x01:
+		return "forwarded, delivery unconfirmed"
+	case s == 0x02:
+		return "replaced"
+	case s < 0x20:
+		return fmt.Sprintf("delivered (0x%02X)", byte(s))
+	case s == 0x20:
+		return "pending, congestion"
+	case s == 0x21:
+		return "pending, recipient busy"
+	case s == 0x22:
+		return "pending, no response from recipient"
+	case s == 0x23:
+		return "pending, service rejected"
+	case s < 0x40:
+		return fmt.Sprintf("pending (0x%02X)", byte(s))
+	case s == 0x41:
+		return "failed, incompatible destination"
+	case s == 0x42:
+		return "failed, connection rejected"
+	case s == 0x45:
+		return "failed, quality of service not available"
+	case s == 0x46:
+		return "failed, validity period expired"
+	case s == 0x47:
+		return "failed, deleted by originator"
+	case s == 0x48:
+		return "failed, deleted by service centre"
+	case s == 0x49:
+		return "failed, message does not exist"
+	case s < 0x60:
+		return fmt.Sprintf("failed (0x%02X)", byte(s))
+	default:
+		return fmt.Sprintf("failed after retries (0x%02X)", byte(s))
+	}
+}
+
+type SMSPDU struct {
+	Type SMSPDUType
+	SMSC SMSAddress
+
+	// Address is the originator of a DELIVER or the destination of a SUBMIT
+	Address SMSAddress
+
+	MessageRef          int
+	PID                 byte
+	DCS                 byte
+	Encoding            SMSEncoding
+	Timestamp           time.Time
+	ValidityPeriod      byte
+	StatusReportRequest bool
+	MoreMessages        bool
+
+	// DischargeTime and ReportStatus are only set on an SMS-STATUS-REPORT,
+	// whose Timestamp is the time the reported message reached the SMSC
+	DischargeTime time.Time
+	ReportStatus  SMSReportStatus
+
+	UDH  []UDHElement
+	Data []byte
+	Text string
+}
+
+var gsm7Basic = []rune("@£$¥èéùìòÇ\nØø\rÅåΔ_ΦΓΛΩΠΨΣΘΞ\x1bÆæßÉ !\"#¤%&'()*+,-./0123456789:;<=>?¡ABCDEFGHIJKLMNOPQRSTUVWXYZÄÖÑÜ§¿abcdefghijklmnopqrstuvwxyzäöñüà")
+
+var gsm7Extension = map[byte]rune{
+	0x0A: '\f',
+	0x14: '^',
+	0x28: '{',
+	0x29: '}',
+	0x2F: '\\',
+	0x3C: '[',
+	0x3D: '~',
+	0x3E: ']',
+	0x40: '|',
+	0x65: '€',
+}
+
+const gsm7Escape = 0x1B
+
+var (
+	gsm7BasicReverse     = make(map[rune]byte)
+	gsm7ExtensionReverse = make(map[rune]byte)
+)
+
+func init() {
+
+	for i, r := range gsm7Basic {
+		if i != gsm7Escape {
+			gsm7BasicReverse[r] = byte(i)
+		}
+	}
+	for b, r := range gsm7Extension {
+		gsm7ExtensionReverse[r] = b
+	}
+}
+
+func decodeGSM7Septets(septets []byte) string {
+
+	var sb strings.Builder
+
+	for i := 0; i < len(septets); i++ {
+		s := septets[i] & 0x7F
+		if s == gsm7Escape && i+1 < len(septets) {
+			i++
+			if r, ok := gsm7Extension[septets[i]&0x7F]; ok {
+				sb.WriteRune(r)
+			} else {
+				sb.WriteRune(' ')
+			}
+			continue
+		}
+		sb.WriteRune(gsm7Basic[s])
+	}
+
+	return sb.String()
+}
+
+// encodeGSM7Septets maps text onto the default alphabet, ok is false when a
+// character has no GSM 03.38 representation.
+func encodeGSM7Septets(text string) ([]byte, bool) {
+
+	septets := make([]byte, 0, len(text))
+
+	for _, r := range text {
+		if b, ok := gsm7BasicReverse[r]; ok {
+			septets = append(septets, b)
+		} else if b, ok := gsm7ExtensionReverse[r]; ok {
+			septets = append(septets, gsm7Escape, b)
+		} else {
+			return nil, false
+		}
+	}
+
+	return septets, true
+}
+
+func packSeptets(septets []byte, fillBits int) []byte {
+
+	totalBits := fillBits + len(septets)*7
+	out := make([]byte, (totalBits+7)/8)
+
+	bit := fillBits
+	for _, s := range septets {
+		for i := 0; i < 7; i++ {
+			if s&(1<<uint(i)) != 0 {
+				out[bit/8] |= 1 << uint(bit%8)
+			}
+			bit++
+		}
+	}
+
+	return out
+}
+
+func unpackSeptets(data []byte, count int, fillBits int) []byte {
+
+	septets := make([]byte, 0, count)
+
+	bit := fillBits
+	for len(septets) < count && bit+7 <= len(data)*8 {
+		var s byte
+		for i := 0; i < 7; i++ {
+			if data[bit/8]&(1<<uint(bit%8)) != 0 {
+				s |= 1 << uint(i)
+			}
+			bit++
+		}
+		septets = append(septets, s)
+	}
+
+	return septets
+}
+
+func decodeUCS2(data []byte) (string, error) {
+
+	if len(data)%2 != 0 {
+		return "", errors.New("invalid UCS2 length")
+	}
+
+	uints := make([]uint16, len(data)/2)
+	for i := range uints {
+		uints[i] = uint16(data[i*2])<<8 | uint16(data[i*2+1])
+	}
+
+	return string(utf16.Decode(uints)), nil
+}
+
+func encodeUCS2(text string) []byte {
+	return stringToUCS2Hex(text)
+}
+
+func dcsEncoding(dcs byte) SMSEncoding {
+
+	switch {
+	case dcs&0xC0 == 0x00 || dcs&0xC0 == 0x40:
+		switch (dcs >> 2) & 0x03 {
+		case 0x01:
+			return Encoding8Bit
+		case 0x02:
+			return EncodingUCS2
+		default:
+			return EncodingGSM7
+		}
+	case dcs&0xF0 == 0xF0:
+		if dcs&0x04 != 0 {
+			return Encoding8Bit
+		}
+		return EncodingGSM7
+	case dcs&0xF0 == 0xE0:
+		return EncodingUCS2
+	default:
+		return EncodingGSM7
+	}
+}
+
+func encodingDCS(enc SMSEncoding) byte {
+
+	switch enc {
+	case Encoding8Bit:
+		return 0x04
+	case EncodingUCS2:
+		return 0x08
+	default:
+		return 0x00
+	}
+}
+
+func swapBCD(b byte) int {
+	return int(b&0x0F)*10 + int(b>>4)
+}
+
+func decodeBCDDigits(data []byte, digits int) string {
+
+	const bcdChars = "0123456789*#abc"
+
+	var sb strings.Builder
+	for i := 0; i < digits; i++ {
+		b := data[i/2]
+		nibble := b & 0x0F
+		if i%2 == 1 {
+			nibble = b >> 4
+		}
+		if nibble == 0x0F {
+			break
+		}
+		sb.WriteByte(bcdChars[nibble])
+	}
+
+	return sb.String()
+}
+
+func encodeBCDDigits(number string) ([]byte, error) {
+
+	out := make([]byte, (len(number)+1)/2)
+
+	for i, c := range number {
+		var nibble byte
+		switch {
+		case c >= '0' && c <= '9':
+			nibble = byte(c - '0')
+		case c == '*':
+			nibble = 0x0A
+		case c == '#':
+			nibble = 0x0B
+		default:
+			return nil, fmt.Errorf("invalid address digit %q", c)
+		}
+		if i%2 == 0 {
+			out[i/2] = nibble | 0xF0
+		} else {
+			out[i/2] = out[i/2]&0x0F | nibble<<4
+		}
+	}
+
+	return out, nil
+}
+
+func decodeAddressType(toa byte) (int, int) {
+	return int(toa>>4) & 0x07, int(toa & 0x0F)
+}
+
+func encodeAddressType(addr SMSAddress) byte {
+	return 0x80 | byte(addr.TON&0x07)<<4 | byte(addr.NPI&0x0F)
+}
+
+// decodeSMSTimestamp reads a 7 octet TP-SCTS, including its quarter-hour zone.
+func decodeSMSTimestamp(data []byte) (time.Time, error) {
+
+	if len(data) < 7 {
+		return time.Time{}, errors.New("short timestamp")
+	}
+
+	tz := data[6]
+	quarters := int(tz&0x07)*10 + int(tz>>4)
+	offset := quarters * 15 * 60
+	if tz&0x08 != 0 {
+		offset = -offset
+	}
+
+	year := 2000 + swapBCD(data[0])
+	loc := time.FixedZone(formatZone(offset), offset)
+
+	return time.Date(year, time.Month(swapBCD(data[1])), swapBCD(data[2]),
+		swapBCD(data[3]), swapBCD(data[4]), swapBCD(data[5]), 0, loc), nil
+}
+
+func encodeSMSTimestamp(t time.Time) []byte {
+
+	bcd := func(v int) byte {
+		return byte(v%10)<<4 | byte(v/10%10)
+	}
+
+	_, offset := t.Zone()
+	sign := byte(0)
+	if offset < 0 {
+		sign = 0x08
+		offset = -offset
+	}
+	quarters := offset / 900
+
+	return []byte{
+		bcd(t.Year() % 100), bcd(int(t.Month())), bcd(t.Day()),
+		bcd(t.Hour()), bcd(t.Minute()), bcd(t.Second()),
+		bcd(quarters) | sign,
+	}
+}
+
+func formatZone(offset int) string {
+
+	sign := "+"
+	if offset < 0 {
+		sign = "-"
+		offset = -offset
+	}
+	return fmt.Sprintf("UTC%s%02d:%02d", sign, offset/3600, offset%3600/60)
+}
+
+// Concat returns the 8-bit or 16-bit reference concatenation header, or nil
+// for a single part message.
+func (p *SMSPDU) Concat() *SMSConcat {
+
+	for _, el := range p.UDH {
+		switch {
+		case el.ID == udhConcat8Bit && len(el.Data) == 3:
+			if el.Data[1] == 0 || el.Data[2] == 0 {
+				continue
+			}
+			return &SMSConcat{Ref: int(el.Data[0]), Total: int(el.Data[1]), Seq: int(el.Data[2])}
+		case el.ID == udhConcat16Bit && len(el.Data) == 4:
+			if el.Data[2] == 0 || el.Data[3] == 0 {
+				continue
+			}
+			return &SMSConcat{Ref: int(el.Data[0])<<8 | int(el.Data[1]), Total: int(el.Data[2]), Seq: int(el.Data[3])}
+		}
+	}
+
+	return nil
+}
+
+type pduReader struct {
+	data []byte
+	pos  int
+}
+
+func (r *pduReader) byte() (byte, error) {
+
+	if r.pos >= len(r.data) {
+		return 0, errors.New("pdu too short")
+	}
+	b := r.data[r.pos]
+	r.pos++
+	return b, nil
+}
+
+func (r *pduReader) bytes(n int) ([]byte, error) {
+
+	if n < 0 || r.pos+n > len(r.data) {
+		return nil, errors.New("pdu too short")
+	}
+	b := r.data[r.pos : r.pos+n]
+	r.pos += n
+	return b, nil
+}
+
+func (r *pduReader) smsc() (SMSAddress, error) {
+
+	length, err := r.byte()
+	if err != nil || length == 0 {
+		return SMSAddress{}, err
+	}
+
+	raw, err := r.bytes(int(length))
+	if err != nil {
+		return SMSAddress{}, err
+	}
+
+	ton, npi := decodeAddressType(raw[0])
+	return SMSAddress{
+		Number: decodeBCDDigits(raw[1:], (len(raw)-1)*2),
+		TON:    ton,
+		NPI:    npi,
+	}, nil
+}
+
+func (r *pduReader) address() (SMSAddress, error) {
+
+	digits, err := r.byte()
+	if err != nil {
+		return SMSAddress{}, err
+	}
+	toa, err := r.byte()
+	if err != nil {
+		return SMSAddress{}, err
+	}
+	raw, err := r.bytes((int(digits) + 1) / 2)
+	if err != nil {
+		return SMSAddress{}, err
+	}
+
+	ton, npi := decodeAddressType(toa)
+	addr := SMSAddress{TON: ton, NPI: npi}
+
+	if ton == TONAlphanumeric {
+		addr.Number = decodeGSM7Septets(unpackSeptets(raw, int(digits)*4/7, 0))
+	} else {
+		addr.Number = decodeBCDDigits(raw, int(digits))
+	}
+
+	return addr, nil
+}
+
+func parseUDH(header []byte) ([]UDHElement, error) {
+
+	var elements []UDHElement
+
+	for i := 0; i < len(header); {
+		if i+2 > len(header) {
+			return elements, errors.New("truncated user data header")
+		}
+		id := header[i]
+		length := int(header[i+1])
+		if i+2+length > len(header) {
+			return elements, errors.New("truncated user data header element")
+		}
+		elements = append(elements, UDHElement{ID: id, Data: header[i+2 : i+2+length]})
+		i += 2 + length
+	}
+
+	return elements, nil
+}
+
+func encodeUDH(elements []UDHElement) []byte {
+
+	if len(elements) == 0 {
+		return nil
+	}
+
+	var body []byte
+	for _, el := range elements {
+		body = append(body, el.ID, byte(len(el.Data)))
+		body = append(body, el.Data...)
+	}
+
+	return append([]byte{byte(len(body))}, body...)
+}
+
+func (r *pduReader) userData(p *SMSPDU, hasUDH bool) error {
+
+	udl, err := r.byte()
+	if err != nil {
+		return err
+	}
+	ud := r.data[r.pos:]
+
+	headerLen := 0
+	if hasUDH && len(ud) > 0 {
+		headerLen = int(ud[0]) + 1
+		if headerLen > len(ud) {
+			return errors.New("user data header exceeds user data")
+		}
+		if p.UDH, err = parseUDH(ud[1:headerLen]); err != nil {
+			return err
+		}
+	}
+
+	switch p.Encoding {
+	case EncodingGSM7:
+		headerSeptets := (headerLen*8 + 6) / 7
+		fillBits := headerSeptets*7 - headerLen*8
+		count := int(udl) - headerSeptets
+		if count < 0 {
+			return errors.New("invalid user data length")
+		}
+		septets := unpackSeptets(ud[headerLen:], count, fillBits)
+		p.Data = septets
+		p.Text = decodeGSM7Septets(septets)
+	case EncodingUCS2:
+		end := int(udl)
+		if end > len(ud) {
+			end = len(ud)
+		}
+		if end < headerLen {
+			return errors.New("invalid user data length")
+		}
+		p.Data = ud[headerLen:end]
+		if p.Text, err = decodeUCS2(p.Data); err != nil {
+			return err
+		}
+	default:
+		end := int(udl)
+		if end > len(ud) {
+			end = len(ud)
+		}
+		if end < headerLen {
+			return errors.New("invalid user data length")
+		}
+		p.Data = ud[headerLen:end]
+		runes := make([]rune, len(p.Data))
+		for i, b := range p.Data {
+			runes[i] = rune(b)
+		}
+		p.Text = string(runes)
+	}
+
+	return nil
+}
+
+// statusReport reads the SMS-STATUS-REPORT fields after the first octet.
+func (r *pduReader) statusReport(p *SMSPDU, hasUDH bool) error {
+
+	mr, err := r.byte()
+	if err != nil {
+		return err
+	}
+	p.MessageRef = int(mr)
+
+	if p.Address, err = r.address(); err != nil {
+		return err
+	}
+
+	scts, err := r.bytes(7)
+	if err != nil {
+		return err
+	}
+	if p.Timestamp, err = decodeSMSTimestamp(scts); err != nil {
+		return err
+	}
+
+	dt, err := r.bytes(7)
+	if err != nil {
+		return err
+	}
+	if p.DischargeTime, err = decodeSMSTimestamp(dt); err != nil {
+		return err
+	}
+
+	st, err := r.byte()
+	if err != nil {
+		return err
+	}
+	p.ReportStatus = SMSReportStatus(st)
+
+	// TP-PI and the fields it announces are optional
+	if r.pos >= len(r.data) {
+		return nil
+	}
+	pi, _ := r.byte()
+	if pi&0x01 != 0 {
+		if p.PID, err = r.byte(); err != nil {
+			return err
+		}
+	}
+	if pi&0x02 != 0 {
+		if p.DCS, err = r.byte(); err != nil {
+			return err
+		}
+	}
+	p.Encoding = dcsEncoding(p.DCS)
+	if pi&0x04 != 0 {
+		return r.userData(p, hasUDH)
+	}
+
+	return nil
+}
+
+// DecodeSMSPDU parses a hex PDU as listed by +CMGL/+CMGR in PDU mode, which
+// is prefixed with the SMSC information.
+func DecodeSMSPDU(hexPDU string) (*SMSPDU, error) {
+
+	raw, err := hex.DecodeString(strings.TrimSpace(hexPDU))
+	if err != nil {
+		return nil, errors.New("pdu hex decode error")
+	}
+
+	r := &pduReader{data: raw}
+	p := &SMSPDU{}
+
+	if p.SMSC, err = r.smsc(); err != nil {
+		return nil, err
+	}
+
+	fo, err := r.byte()
+	if err != nil {
+		return nil, err
+	}
+	hasUDH := fo&0x40 != 0
+
+	switch fo & 0x03 {
+	case 0x00:
+		p.Type = SMSDeliver
+		p.MoreMessages = fo&0x04 == 0
+		p.StatusReportRequest = fo&0x20 != 0
+		if p.Address, err = r.address(); err != nil {
+			return nil, err
+		}
+		if p.PID, err = r.byte(); err != nil {
+			return nil, err
+		}
+		if p.DCS, err = r.byte(); err != nil {
+			return nil, err
+		}
+		scts, err := r.bytes(7)
+		if err != nil {
+			return nil, err
+		}
+		if p.Timestamp, err = decodeSMSTimestamp(scts); err != nil {
+			return nil, err
+		}
+
+	case 0x01:
+		p.Type = SMSSubmit
+		p.StatusReportRequest = fo&0x20 != 0
+		mr, err := r.byte()
+		if err != nil {
+			return nil, err
+		}
+		p.MessageRef = int(mr)
+		if p.Address, err = r.address(); err != nil {
+			return nil, err
+		}
+		if p.PID, err = r.byte(); err != nil {
+			return nil, err
+		}
+		if p.DCS, err = r.byte(); err != nil {
+			return nil, err
+		}
+		switch (fo >> 3) & 0x03 {
+		case 0x02:
+			if p.ValidityPeriod, err = r.byte(); err != nil {
+				return nil, err
+			}
+		case 0x01, 0x03:
+			if _, err = r.bytes(7); err != nil {
+				return nil, err
+			}
+		}
+
+	case 0x02:
+		p.Type = SMSStatusReport
+		return p, r.statusReport(p, hasUDH)
+
+	default:
+		return nil, fmt.Errorf("unsupported pdu type %d", fo&0x03)
+	}
+
+	p.Encoding = dcsEncoding(p.DCS)
+	if err := r.userData(p, hasUDH); err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+// EncodeSubmit builds an SMS-SUBMIT without SMSC information (the modem's
+// default is used). tpduLen is the octet count expected by AT+CMGS=<length>.
+func (p *SMSPDU) EncodeSubmit() (string, int, error) {
+
+	if p.Address.Number == "" {
+		return "", 0, errors.New("empty destination address")
+	}
+
+	fo := byte(0x01)
+	if p.ValidityPeriod != 0 {
+		fo |= 0x10
+	}
+	if p.StatusReportRequest {
+		fo |= 0x20
+	}
+	if len(p.UDH) > 0 {
+		fo |= 0x40
+	}
+
+	address, err := encodeAddress(p.Address)
+	if err != nil {
+		return "", 0, err
+	}
+
+	tpdu := append([]byte{fo, byte(p.MessageRef)}, address...)
+	tpdu = append(tpdu, p.PID, encodingDCS(p.Encoding))
+	if p.ValidityPeriod != 0 {
+		tpdu = append(tpdu, p.ValidityPeriod)
+	}
+
+	if tpdu, err = p.appendUserData(tpdu); err != nil {
+		return "", 0, err
+	}
+
+	return strings.ToUpper("00" + hex.EncodeToString(tpdu)), len(tpdu), nil
+}
+
+// EncodeDeliver builds an SMS-DELIVER the way the modem stores it, SMSC
+// address included. It is the counterpart of DecodeSMSPDU for simulators.
+func (p *SMSPDU) EncodeDeliver() (string, error) {
+
+	fo := byte(0x00)
+	if !p.MoreMessages {
+		fo |= 0x04
+	}
+	if p.StatusReportRequest {
+		fo |= 0x20
+	}
+	if len(p.UDH) > 0 {
+		fo |= 0x40
+	}
+
+	address, err := encodeAddress(p.Address)
+	if err != nil {
+		return "", err
+	}
+
+	tpdu := append([]byte{fo}, address...)
+	tpdu = append(tpdu, p.PID, encodingDCS(p.Encoding))
+	tpdu = append(tpdu, encodeSMSTimestamp(p.Timestamp)...)
+
+	if tpdu, err = p.appendUserData(tpdu); err != nil {
+		return "", err
+	}
+
+	return p.encodeWithSMSC(tpdu)
+}
+
+// EncodeStatusReport builds an SMS-STATUS-REPORT for MessageRef, Address
+// being the recipient of the reported message.
+func (p *SMSPDU) EncodeStatusReport() (string, error) {
+
+	address, err := encodeAddress(p.Address)
+	if err != nil {
+		return "", err
+	}
+
+	tpdu := append([]byte{0x06, byte(p.MessageRef)}, address...)
+	tpdu = append(tpdu, encodeSMSTimestamp(p.Timestamp)...)
+	tpdu = append(tpdu, encodeSMSTimestamp(p.DischargeTime)...)
+	tpdu = append(tpdu, byte(p.ReportStatus))
+
+	return p.encodeWithSMSC(tpdu)
+}
+
+func (p *SMSPDU) encodeWithSMSC(tpdu []byte) (string, error) {
+
+	if p.SMSC.Number == "" {
+		return strings.ToUpper("00" + hex.EncodeToString(tpdu)), nil
+	}
+
+	digits, err := encodeBCDDigits(p.SMSC.Number)
+	if err != nil {
+		return "", err
+	}
+
+	smsc := append([]byte{byte(len(digits) + 1), encodeAddressType(p.SMSC)}, digits...)
+	return strings.ToUpper(hex.EncodeToString(append(smsc, tpdu...))), nil
+}
+
+func encodeAddress(addr SMSAddress) ([]byte, error) {
+
+	if addr.Number == "" {
+		return nil, errors.New("empty address")
+	}
+
+	digits, err := encodeBCDDigits(addr.Number)
+	if err != nil {
+		return nil, err
+	}
+
+	return append([]byte{byte(len(addr.Number)), encodeAddressType(addr)}, digits...), nil
+}
+
+func (p *SMSPDU) appendUserData(tpdu []byte) ([]byte, error) {
+
+	udh := encodeUDH(p.UDH)
+
+	switch p.Encoding {
+	case EncodingGSM7:
+		septets, ok := encodeGSM7Septets(p.Text)
+		if !ok {
+			return nil, errors.New("text not representable in GSM 7-bit alphabet")
+		}
+		headerSeptets := (len(udh)*8 + 6) / 7
+		fillBits := headerSeptets*7 - len(udh)*8
+		packed := packSeptets(septets, fillBits)
+		tpdu = append(tpdu, byte(headerSeptets+len(septets)))
+		tpdu = append(tpdu, udh...)
+		tpdu = append(tpdu, packed...)
+	case EncodingUCS2:
+		data := encodeUCS2(p.Text)
+		tpdu = append(tpdu, byte(len(udh)+len(data)))
+		tpdu = append(tpdu, udh...)
+		tpdu = append(tpdu, data...)
+	default:
+		tpdu = append(tpdu, byte(len(udh)+len(p.Data)))
+		tpdu = append(tpdu, udh...)
+		tpdu = append(tpdu, p.Data...)
+	}
+
+	if len(tpdu) > 176 {
+		return nil, errors.New("pdu too long")
+	}
+
+	return tpdu, nil
+}
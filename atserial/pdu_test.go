@@ -0,0 +1,177 @@
+package atserial
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDecodeSMSPDUShortUserData(t *testing.T) {
+
+	// UCS2 with a 6 byte concat header but a UDL of 2
+	if _, err := DecodeSMSPDU("0044048121430008621016810000000205000301020100"); err == nil {
+		t.Fatal("expected an error for a UDL shorter than the UDH")
+	}
+	// the same for 8-bit data
+	if _, err := DecodeSMSPDU("0044048121430004621016810000000205000301020100"); err == nil {
+		t.Fatal("expected an error for 8-bit data shorter than the UDH")
+	}
+}
+
+func TestDecodeSMSPDUDeliver(t *testing.T) {
+
+	// 3GPP style sample: "How are you?" from +31641600986 via +31624000000
+	p, err := DecodeSMSPDU("07911326040000F0040B911346610089F60000208062917314080CC8F71D14969741F977FD07")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if p.Type != SMSDeliver || p.Encoding != EncodingGSM7 {
+		t.Fatalf("got type %d encoding %v", p.Type, p.Encoding)
+	}
+	if p.SMSC.String() != "+31624000000" || p.Address.String() != "+31641600986" {
+		t.Fatalf("got smsc %s address %s", p.SMSC, p.Address)
+	}
+	if p.Text != "How are you?" {
+		t.Fatalf("got text %q", p.Text)
+	}
+
+	// the zone octet 08 is the sign bit with zero quarters
+	want := time.Date(2002, 8, 26, 19, 37, 41, 0, time.UTC)
+	if !p.Timestamp.Equal(want) {
+		t.Fatalf("got timestamp %v, want %v", p.Timestamp, want)
+	}
+}
+
+func TestEncodeSubmit(t *testing.T) {
+
+	p := &SMSPDU{
+		Address:        NewSMSAddress("+46708251358"),
+		Encoding:       EncodingGSM7,
+		ValidityPeriod: 0xAA,
+		Text:           "hellohello",
+	}
+
+	pdu, tpduLen, err := p.EncodeSubmit()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "0011000B916407281553F80000AA0AE8329BFD4697D9EC37"; pdu != want {
+		t.Fatalf("got %s, want %s", pdu, want)
+	}
+	if tpduLen != len(pdu)/2-1 {
+		t.Fatalf("got tpdu length %d for %d octets", tpduLen, len(pdu)/2-1)
+	}
+}
+
+func TestDeliverRoundTrip(t *testing.T) {
+
+	concat := []UDHElement{{ID: udhConcat8Bit, Data: []byte{0x42, 2, 1}}}
+	concat16 := []UDHElement{{ID: udhConcat16Bit, Data: []byte{0x12, 0x34, 3, 3}}}
+
+	tests := []struct {
+		name     string
+		encoding SMSEncoding
+		text     string
+		data     []byte
+		udh      []UDHElement
+		zone     int
+	}{
+		{"gsm7", EncodingGSM7, "Hello @ £5 {ok} €", nil, nil, 8 * 3600},
+		// a 6 octet header is followed by one fill bit
+		{"gsm7 concat fill bits", EncodingGSM7, "part one of two", nil, concat, 0},
+		// a 7 octet header needs no fill bits
+		{"gsm7 concat 16-bit ref", EncodingGSM7, "last part", nil, concat16, -3*3600 - 1800},
+		{"ucs2", EncodingUCS2, "你好, 世界 😀", nil, nil, 5*3600 + 2700},
+		{"ucs2 concat", EncodingUCS2, "第二部分", nil, concat, -5 * 3600},
+		{"8bit", Encoding8Bit, "", []byte{0x00, 0x7F, 0x80, 0xFF}, nil, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			sent := &SMSPDU{
+				SMSC:      NewSMSAddress("+8613800100500"),
+				Address:   NewSMSAddress("+8613912345678"),
+				Encoding:  tt.encoding,
+				Timestamp: time.Date(2024, 2, 29, 23, 59, 58, 0, time.FixedZone("", tt.zone)),
+				UDH:       tt.udh,
+				Text:      tt.text,
+				Data:      tt.data,
+			}
+
+			pdu, err := sent.EncodeDeliver()
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := DecodeSMSPDU(pdu)
+			if err != nil {
+				t.Fatalf("decode %s: %v", pdu, err)
+			}
+
+			if got.Encoding != tt.encoding {
+				t.Errorf("got encoding %v", got.Encoding)
+			}
+			if tt.encoding == Encoding8Bit {
+				if string(got.Data) != string(tt.data) {
+					t.Errorf("got data %X", got.Data)
+				}
+			} else if got.Text != tt.text {
+				t.Errorf("got text %q, want %q", got.Text, tt.text)
+			}
+			if got.Address.String() != "+8613912345678" || got.SMSC.String() != "+8613800100500" {
+				t.Errorf("got address %s smsc %s", got.Address, got.SMSC)
+			}
+			if !got.Timestamp.Equal(sent.Timestamp) {
+				t.Errorf("got timestamp %v, want %v", got.Timestamp, sent.Timestamp)
+			}
+			if _, offset := got.Timestamp.Zone(); offset != tt.zone {
+				t.Errorf("got zone offset %d, want %d", offset, tt.zone)
+			}
+
+			want, gotConcat := sent.Concat(), got.Concat()
+			if (want == nil) != (gotConcat == nil) || (want != nil && *want != *gotConcat) {
+				t.Errorf("got concat %+v, want %+v", gotConcat, want)
+			}
+		})
+	}
+}
+
+func TestStatusReportRoundTrip(t *testing.T) {
+
+	zone := time.FixedZone("", 8*3600)
+	sent := &SMSPDU{
+		SMSC:          NewSMSAddress("+8613800100500"),
+		Address:       NewSMSAddress("+8613912345678"),
+		MessageRef:    0xA7,
+		Timestamp:     time.Date(2024, 5, 1, 10, 0, 0, 0, zone),
+		DischargeTime: time.Date(2024, 5, 1, 10, 0, 5, 0, zone),
+		ReportStatus:  0x00,
+	}
+
+	pdu, err := sent.EncodeStatusReport()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := DecodeSMSPDU(pdu)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got.Type != SMSStatusReport || got.MessageRef != 0xA7 {
+		t.Fatalf("got type %d reference %d", got.Type, got.MessageRef)
+	}
+	if !got.ReportStatus.Delivered() || !got.ReportStatus.Final() {
+		t.Errorf("got status %v", got.ReportStatus)
+	}
+	if !got.Timestamp.Equal(sent.Timestamp) || !got.DischargeTime.Equal(sent.DischargeTime) {
+		t.Errorf("got times %v %v", got.Timestamp, got.DischargeTime)
+	}
+
+	report, err := parseStatusReportPDU(pdu)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Reference != 0xA7 || !report.Status.Delivered() || !report.SubmitTime.Equal(sent.Timestamp) {
+		t.Errorf("got report %+v", report)
+	}
+}
@@ -0,0 +1,282 @@
+package atserial
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"time"
+	"errors"
+	"context"
+	"strconv"
+	"strings"
+)
+
+// Band lists configurable with AT+QNWPREFCFG.
+const (
+	BandLTE     = "lte_band"
+	BandNSANR5G = "nsa_nr5g_band"
+	BandNR5G    = "nr5g_band"
+)
+
+// NR5GDisableMode is the nr5g_disable_mode setting of AT+QNWPREFCFG.
+type NR5GDisableMode int
+
+const (
+	NR5GEnableAll  NR5GDisableMode = 0
+	NR5GDisableSA  NR5GDisableMode = 1
+	NR5GDisableNSA NR5GDisableMode = 2
+)
+
+func (m NR5GDisableMode) String() string {
+
+	switch m {
+	case NR5GEnableAll:
+		return "SA and NSA enabled"
+	case NR5GDisableSA:
+		return "SA disabled"
+	case NR5GDisableNSA:
+		return "NSA disabled"
+	}
+	return fmt.Sprintf("unknown (%d)", int(m))
+}
+
+var modePrefRATs = map[string]bool{"AUTO": true, "WCDMA": true, "LTE": true, "NR5G": true}
+
+func isBandSetting(setting string) bool {
+	return setting == BandLTE || setting == BandNSANR5G || setting == BandNR5G
+}
+
+// queryPrefCfg returns the value lines of AT+QNWPREFCFG="<setting>" keyed by
+// setting name; ue_capability_band answers with several of them.
+func (nri *NRInterface) queryPrefCfg(ctx context.Context, setting string) (map[string]string, error) {
+
+	rsp, err := nri.ExecuteContext(ctx, fmt.Sprintf("AT+QNWPREFCFG=\"%s\"\r\n", setting), 2*time.Second)
+	if err != nil {
+		return nil, fmt.Errorf("query %s failed: %w", setting, err)
+	}
+
+	values := make(map[string]string)
+	for _, line := range rsp.Prefixed("+QNWPREFCFG:") {
+		name, value, ok := strings.Cut(line, ",")
+		if !ok {
+			continue
+		}
+		values[strings.Trim(strings.TrimSpace(name), "\"")] = strings.TrimSpace(value)
+	}
+
+	if len(values) == 0 {
+		return nil, fmt.Errorf("%s not found", setting)
+	}
+	return values, nil
+}
+
+func (nri *NRInterface) setPrefCfg(ctx context.Context, setting string, value string) error {
+
+	if _, err := nri.ExecuteContext(ctx, fmt.Sprintf("AT+QNWPREFCFG=\"%s\",%s\r\n", setting, value), 3*time.Second); err != nil {
+		return fmt.Errorf("set %s failed: %w", setting, err)
+	}
+
+	log.Printf("[NRInterface] %s set to %s", setting, value)
+	return nil
+}
+
+// ParseBandList parses a colon separated band list such as "1:3:78".
+func ParseBandList(s string) ([]int, error) {
+
+	var bands []int
+	for _, item := range strings.Split(strings.TrimSpace(s), ":") {
+		item = strings.TrimLeft(strings.TrimSpace(item), "bBnN")
+		if item == "" {
+			continue
+		}
+		band, err := strconv.Atoi(item)
+		if err != nil || band <= 0 {
+			return nil, fmt.Errorf("invalid band %q", item)
+		}
+		bands = append(bands, band)
+	}
+
+	if len(bands) == 0 {
+		return nil, errors.New("empty band list")
+	}
+	return bands, nil
+}
+
+func formatBandList(bands []int) string {
+
+	items := make([]string, len(bands))
+	for i, band := range bands {
+		items[i] = strconv.Itoa(band)
+	}
+	return strings.Join(items, ":")
+}
+
+// GetUECapabilityBands returns the bands the module supports, keyed by
+// BandLTE, BandNSANR5G and BandNR5G.
+func (nri *NRInterface) GetUECapabilityBands() (map[string][]int, error) {
+	return nri.GetUECapabilityBandsContext(context.Background())
+}
+
+func (nri *NRInterface) GetUECapabilityBandsContext(ctx context.Context) (map[string][]int, error) {
+
+	values, err := nri.queryPrefCfg(ctx, "ue_capability_band")
+	if err != nil {
+		return nil, err
+	}
+
+	capability := make(map[string][]int)
+	for setting, value := range values {
+		if !isBandSetting(setting) {
+			continue
+		}
+		bands, err := ParseBandList(value)
+		if err != nil {
+			continue
+		}
+		capability[setting] = bands
+	}
+
+	return capability, nil
+}
+
+// GetBands returns the enabled bands of setting (BandLTE, BandNSANR5G or
+// BandNR5G).
+func (nri *NRInterface) GetBands(setting string) ([]int, error) {
+	return nri.GetBandsContext(context.Background(), setting)
+}
+
+func (nri *NRInterface) GetBandsContext(ctx context.Context, setting string) ([]int, error) {
+
+	if !isBandSetting(setting) {
+		return nil, fmt.Errorf("unknown band setting %s", setting)
+	}
+
+	values, err := nri.queryPrefCfg(ctx, setting)
+	if err != nil {
+		return nil, err
+	}
+	return ParseBandList(values[setting])
+}
+
+// SetBands restricts setting to bands after checking every band against
+// ue_capability_band.
+func (nri *NRInterface) SetBands(setting string, bands []int) error {
+	return nri.SetBandsContext(context.Background(), setting, bands)
+}
+
+func (nri *NRInterface) SetBandsContext(ctx context.Context, setting string, bands []int) error {
+
+	if !isBandSetting(setting) {
+		return fmt.Errorf("unknown band setting %s", setting)
+	}
+	if len(bands) == 0 {
+		return errors.New("empty band list")
+	}
+
+	capability, err := nri.GetUECapabilityBandsContext(ctx)
+	if err != nil {
+		return err
+	}
+	supported := make(map[int]bool)
+	for _, band := range capability[setting] {
+		supported[band] = true
+	}
+
+	var unsupported []int
+	for _, band := range bands {
+		if !supported[band] {
+			unsupported = append(unsupported, band)
+		}
+	}
+	if len(unsupported) > 0 {
+		return fmt.Errorf("bands %s not supported for %s", formatBandList(unsupported), setting)
+	}
+
+	sorted := append([]int(nil), bands...)
+	sort.Ints(sorted)
+
+	return nri.setPrefCfg(ctx, setting, formatBandList(sorted))
+}
+
+// ResetBands enables every band of setting the module supports.
+func (nri *NRInterface) ResetBands(setting string) error {
+	return nri.ResetBandsContext(context.Background(), setting)
+}
+
+func (nri *NRInterface) ResetBandsContext(ctx context.Context, setting string) error {
+
+	capability, err := nri.GetUECapabilityBandsContext(ctx)
+	if err != nil {
+		return err
+	}
+	bands, ok := capability[setting]
+	if !ok {
+		return fmt.Errorf("no capability reported for %s", setting)
+	}
+	return nri.setPrefCfg(ctx, setting, formatBandList(bands))
+}
+
+// GetModePref returns the RAT preference, e.g. AUTO or LTE:NR5G.
+func (nri *NRInterface) GetModePref() (string, error) {
+	return nri.GetModePrefContext(context.Background())
+}
+
+func (nri *NRInterface) GetModePrefContext(ctx context.Context) (string, error) {
+
+	values, err := nri.queryPrefCfg(ctx, "mode_pref")
+	if err != nil {
+		return "", err
+	}
+	return values["mode_pref"], nil
+}
+
+// SetModePref sets the RAT preference to AUTO or a colon separated list of
+// WCDMA, LTE and NR5G.
+func (nri *NRInterface) SetModePref(mode string) error {
+	return nri.SetModePrefContext(context.Background(), mode)
+}
+
+func (nri *NRInterface) SetModePrefContext(ctx context.Context, mode string) error {
+
+	mode = strings.ToUpper(strings.TrimSpace(mode))
+	rats := strings.Split(mode, ":")
+	for _, rat := range rats {
+		if !modePrefRATs[rat] {
+			return fmt.Errorf("invalid mode_pref %q", mode)
+		}
+		if rat == "AUTO" && len(rats) > 1 {
+			return errors.New("AUTO can't be combined with other RATs")
+		}
+	}
+
+	return nri.setPrefCfg(ctx, "mode_pref", mode)
+}
+
+func (nri *NRInterface) GetNR5GDisableMode() (NR5GDisableMode, error) {
+	return nri.GetNR5GDisableModeContext(context.Background())
+}
+
+func (nri *NRInterface) GetNR5GDisableModeContext(ctx context.Context) (NR5GDisableMode, error) {
+
+	values, err := nri.queryPrefCfg(ctx, "nr5g_disable_mode")
+	if err != nil {
+		return 0, err
+	}
+	mode, err := strconv.Atoi(values["nr5g_disable_mode"])
+	if err != nil {
+		return 0, fmt.Errorf("invalid nr5g_disable_mode %q", values["nr5g_disable_mode"])
+	}
+	return NR5GDisableMode(mode), nil
+}
+
+func (nri *NRInterface) SetNR5GDisableMode(mode NR5GDisableMode) error {
+	return nri.SetNR5GDisableModeContext(context.Background(), mode)
+}
+
+func (nri *NRInterface) SetNR5GDisableModeContext(ctx context.Context, mode NR5GDisableMode) error {
+
+	if mode < NR5GEnableAll || mode > NR5GDisableNSA {
+		return fmt.Errorf("invalid nr5g_disable_mode %d", int(mode))
+	}
+	return nri.setPrefCfg(ctx, "nr5g_disable_mode", strconv.Itoa(int(mode)))
+}
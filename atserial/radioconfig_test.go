@@ -0,0 +1,36 @@
+package atserial
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestRadioSettersHonourContext(t *testing.T) {
+
+	fake := NewFakeTransport()
+	fake.SetResponse(`AT+QNWPREFCFG="mode_pref",LTE:NR5G`, "\r\nOK\r\n")
+	fake.SetResponse(`AT+QNWLOCK="common/4g",0`, "\r\nOK\r\n")
+	nri := NewNRInterfaceWithTransport(fake)
+
+	if err := nri.SetModePrefContext(context.Background(), "lte:nr5g"); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	sent := len(fake.Requests())
+
+	if err := nri.SetModePrefContext(ctx, "LTE:NR5G"); !errors.Is(err, context.Canceled) {
+		t.Errorf("SetModePrefContext: got %v", err)
+	}
+	if err := nri.ClearLTECellLockContext(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("ClearLTECellLockContext: got %v", err)
+	}
+	if _, err := nri.RegisteredContext(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("RegisteredContext: got %v", err)
+	}
+	if n := len(fake.Requests()); n != sent {
+		t.Errorf("%d commands sent after the context was cancelled", n-sent)
+	}
+}
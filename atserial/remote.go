@@ -0,0 +1,203 @@
+package atserial
+
+import (
+	"fmt"
+	"log"
+	"time"
+	"bufio"
+	"bytes"
+	"context"
+	"strings"
+	"net/http"
+	"encoding/json"
+)
+
+const (
+	RemoteErrTimeout      = "timeout"
+	RemoteErrUnavailable  = "unavailable"
+	RemoteErrSerial       = "serial"
+	RemoteErrBadRequest   = "bad_request"
+	RemoteErrUnauthorized = "unauthorized"
+	RemoteErrHTTP         = "http"
+	RemoteErrPreempted    = "preempted"
+)
+
+// RemoteATRequest is the JSON body posted to <remote_api>/at.
+type RemoteATRequest struct {
+	ID        uint32 `json:"id"`
+	Command   string `json:"command"`
+	Payload   string `json:"payload,omitempty"`
+	TimeoutMs int64  `json:"timeout_ms"`
+
+	Preemptible bool `json:"preemptible,omitempty"`
+}
+
+type RemoteATError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *RemoteATError) Error() string {
+	return fmt.Sprintf("remote %s error: %s", e.Code, e.Message)
+}
+
+type RemoteATResponse struct {
+	ID    uint32         `json:"id"`
+	Data  string         `json:"data"`
+	Error *RemoteATError `json:"error,omitempty"`
+}
+
+type RemoteClient struct {
+	baseURL string
+	token   string
+	client  *http.Client
+}
+
+func NewRemoteClient(baseURL string, token string) *RemoteClient {
+
+	return &RemoteClient{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		token:   token,
+		client:  &http.Client{},
+	}
+}
+
+// Query posts req to the remote server. Cancelling ctx closes the connection,
+// which makes the server drop the request unless it is already running.
+func (c *RemoteClient) Query(ctx context.Context, req SerialRequest) (SerialResponse, error) {
+
+	body, err := json.Marshal(RemoteATRequest{
+		ID:        req.ID,
+		Command:   string(req.Data),
+		Payload:   string(req.Payload),
+		TimeoutMs: req.Timeout.Milliseconds(),
+
+		Preemptible: req.Preemptible,
+	})
+	if err != nil {
+		return SerialResponse{}, err
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+"/at", bytes.NewReader(body))
+	if err != nil {
+		return SerialResponse{}, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	if c.token != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	// the remote side may extend the timeout for long commands, leave some slack
+	client := *c.client
+	client.Timeout = req.Timeout*2 + 5*time.Second
+
+	httpRsp, err := client.Do(httpReq)
+	if err != nil {
+		return SerialResponse{}, fmt.Errorf("remote request failed: %w", err)
+	}
+	defer httpRsp.Body.Close()
+
+	var rsp RemoteATResponse
+	if err := json.NewDecoder(httpRsp.Body).Decode(&rsp); err != nil {
+		if httpRsp.StatusCode != http.StatusOK {
+			return SerialResponse{}, &RemoteATError{Code: RemoteErrHTTP, Message: httpRsp.Status}
+		}
+		return SerialResponse{}, fmt.Errorf("remote response decode failed: %w", err)
+	}
+
+	result := SerialResponse{ID: rsp.ID, Data: []byte(rsp.Data)}
+	if rsp.Error != nil {
+		result.Err = rsp.Error
+		if rsp.Error.Code == RemoteErrPreempted {
+			result.Err = ErrPreempted
+		}
+	}
+
+	return result, nil
+}
+
+// Health asks the remote server whether its serial daemon is up.
+func (c *RemoteClient) Health() error {
+
+	client := *c.client
+	client.Timeout = 5 * time.Second
+
+	httpRsp, err := client.Get(c.baseURL + "/health")
+	if err != nil {
+		return fmt.Errorf("remote health check failed: %w", err)
+	}
+	defer httpRsp.Body.Close()
+
+	if httpRsp.StatusCode != http.StatusOK {
+		return &RemoteATError{Code: RemoteErrUnavailable, Message: httpRsp.Status}
+	}
+	return nil
+}
+
+// StreamURC keeps a connection to <remote_api>/urc open and republishes the
+// received events on bus until quit is closed.
+func (c *RemoteClient) StreamURC(bus *URCBus, quit chan struct{}) {
+
+	for {
+		if err := c.streamURCOnce(bus, quit); err != nil {
+			log.Println("[RemoteClient] urc stream error:", err)
+		}
+
+		select {
+		case <-quit:
+			return
+		case <-time.After(restartInterval):
+		}
+	}
+}
+
+func (c *RemoteClient) streamURCOnce(bus *URCBus, quit chan struct{}) error {
+
+	httpReq, err := http.NewRequest(http.MethodGet, c.baseURL+"/urc", nil)
+	if err != nil {
+		return err
+	}
+	if c.token != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	httpRsp, err := c.client.Do(httpReq)
+	if err != nil {
+		return err
+	}
+	defer httpRsp.Body.Close()
+
+	if httpRsp.StatusCode != http.StatusOK {
+		return &RemoteATError{Code: RemoteErrHTTP, Message: httpRsp.Status}
+	}
+
+	// closing the body unblocks the scanner on quit; done lets the goroutine
+	// go once the stream ended on its own
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-quit:
+			httpRsp.Body.Close()
+		case <-done:
+		}
+	}()
+
+	scanner := bufio.NewScanner(httpRsp.Body)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+
+		var ev URCEvent
+		if err := json.Unmarshal(line, &ev); err != nil {
+			log.Println("[RemoteClient] invalid urc event:", err)
+			continue
+		}
+		ev.Type = urcTypeOf(ev.Name)
+		bus.Publish(ev)
+	}
+
+	return scanner.Err()
+}
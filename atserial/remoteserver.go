@@ -0,0 +1,259 @@
+package atserial
+
+import (
+	"log"
+	"net"
+	"time"
+	"errors"
+	"context"
+	"strings"
+	"net/http"
+	"sync/atomic"
+	"crypto/subtle"
+	"encoding/json"
+)
+
+const (
+	remoteDefaultTimeout = time.Second
+	remoteMaxTimeout     = 5 * time.Minute
+)
+
+type RemoteServer struct {
+	listen     string
+	token      string
+	supervisor *SerialSupervisor
+	server     *http.Server
+	startTime  time.Time
+	requests   atomic.Uint64
+	quit       chan struct{}
+}
+
+type RemoteHealth struct {
+	Status   string `json:"status"`
+	Port     string `json:"port"`
+	Uptime   string `json:"uptime"`
+	Requests uint64 `json:"requests"`
+}
+
+func NewRemoteServer(listen string, token string, supervisor *SerialSupervisor) *RemoteServer {
+
+	rs := &RemoteServer{
+		listen:     listen,
+		token:      token,
+		supervisor: supervisor,
+		quit:       make(chan struct{}),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/at", rs.authorized(rs.handleAT))
+	mux.HandleFunc("/urc", rs.authorized(rs.handleURC))
+	mux.HandleFunc("/health", rs.handleHealth)
+
+	rs.server = &http.Server{
+		Addr:              listen,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	return rs
+}
+
+func (rs *RemoteServer) Start() error {
+
+	if rs.token == "" {
+		log.Println("[RemoteServer] WARNING: no token configured, AT endpoint is unauthenticated")
+	}
+
+	ln, err := net.Listen("tcp", rs.listen)
+	if err != nil {
+		return err
+	}
+	rs.startTime = time.Now()
+
+	go func() {
+		if err := rs.server.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Println("[RemoteServer] serve failed:", err)
+		}
+	}()
+	log.Println("[RemoteServer] listening on", ln.Addr())
+
+	return nil
+}
+
+func (rs *RemoteServer) Stop() error {
+
+	close(rs.quit)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	return rs.server.Shutdown(ctx)
+}
+
+func (rs *RemoteServer) authorized(next http.HandlerFunc) http.HandlerFunc {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		if rs.token != "" {
+			given := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if subtle.ConstantTimeCompare([]byte(given), []byte(rs.token)) != 1 {
+				log.Println("[RemoteServer] unauthorized request from", r.RemoteAddr)
+				writeRemoteJSON(w, http.StatusUnauthorized, RemoteATResponse{
+					Error: &RemoteATError{Code: RemoteErrUnauthorized, Message: "invalid token"},
+				})
+				return
+			}
+		}
+		next(w, r)
+	}
+}
+
+func (rs *RemoteServer) handleAT(w http.ResponseWriter, r *http.Request) {
+
+	if r.Method != http.MethodPost {
+		writeRemoteJSON(w, http.StatusMethodNotAllowed, RemoteATResponse{
+			Error: &RemoteATError{Code: RemoteErrBadRequest, Message: "method not allowed"},
+		})
+		return
+	}
+
+	var req RemoteATRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64*1024)).Decode(&req); err != nil {
+		writeRemoteJSON(w, http.StatusBadRequest, RemoteATResponse{
+			Error: &RemoteATError{Code: RemoteErrBadRequest, Message: err.Error()},
+		})
+		return
+	}
+
+	if strings.TrimSpace(req.Command) == "" {
+		writeRemoteJSON(w, http.StatusBadRequest, RemoteATResponse{
+			ID:    req.ID,
+			Error: &RemoteATError{Code: RemoteErrBadRequest, Message: "empty command"},
+		})
+		return
+	}
+
+	timeout := time.Duration(req.TimeoutMs) * time.Millisecond
+	if timeout <= 0 {
+		timeout = remoteDefaultTimeout
+	}
+	if timeout > remoteMaxTimeout {
+		timeout = remoteMaxTimeout
+	}
+
+	rs.requests.Add(1)
+
+	if !rs.supervisor.Healthy() {
+		writeRemoteJSON(w, http.StatusOK, RemoteATResponse{
+			ID:    req.ID,
+			Error: &RemoteATError{Code: RemoteErrUnavailable, Message: "serial daemon not available"},
+		})
+		return
+	}
+
+	// a client that hangs up takes its request out of the queue
+	rsp, err := rs.supervisor.QueryContext(r.Context(), SerialRequest{
+		ID:      req.ID,
+		Data:    []byte(req.Command),
+		Timeout: timeout,
+		Payload: []byte(req.Payload),
+
+		Preemptible: req.Preemptible,
+	})
+	if err == nil {
+		err = rsp.Err
+	}
+
+	result := RemoteATResponse{ID: req.ID, Data: string(rsp.Data)}
+	if err != nil {
+		log.Printf("[RemoteServer] command %q failed: %v", strings.TrimSpace(req.Command), err)
+		result.Error = remoteErrorFrom(err)
+	}
+
+	writeRemoteJSON(w, http.StatusOK, result)
+}
+
+func (rs *RemoteServer) handleURC(w http.ResponseWriter, r *http.Request) {
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	events, cancel := rs.supervisor.URCBus().Subscribe()
+	defer cancel()
+
+	log.Println("[RemoteServer] urc subscriber connected from", r.RemoteAddr)
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	encoder := json.NewEncoder(w)
+	heartbeat := time.NewTicker(30 * time.Second)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case ev := <-events:
+			if err := encoder.Encode(ev); err != nil {
+				return
+			}
+		case <-heartbeat.C:
+			if _, err := w.Write([]byte("\n")); err != nil {
+				return
+			}
+		case <-r.Context().Done():
+			log.Println("[RemoteServer] urc subscriber gone", r.RemoteAddr)
+			return
+		case <-rs.quit:
+			return
+		}
+		flusher.Flush()
+	}
+}
+
+func (rs *RemoteServer) handleHealth(w http.ResponseWriter, r *http.Request) {
+
+	health := RemoteHealth{
+		Status:   "ok",
+		Port:     rs.supervisor.portname,
+		Uptime:   time.Since(rs.startTime).Truncate(time.Second).String(),
+		Requests: rs.requests.Load(),
+	}
+
+	status := http.StatusOK
+	if !rs.supervisor.Healthy() {
+		health.Status = "down"
+		status = http.StatusServiceUnavailable
+	}
+
+	writeRemoteJSON(w, status, health)
+}
+
+func remoteErrorFrom(err error) *RemoteATError {
+
+	msg := err.Error()
+
+	switch {
+	case err == ErrPreempted:
+		return &RemoteATError{Code: RemoteErrPreempted, Message: msg}
+	case strings.Contains(msg, "timeout"):
+		return &RemoteATError{Code: RemoteErrTimeout, Message: msg}
+	case strings.Contains(msg, "no available daemon"),
+		strings.Contains(msg, "not running"),
+		strings.Contains(msg, "channel full"):
+		return &RemoteATError{Code: RemoteErrUnavailable, Message: msg}
+	default:
+		return &RemoteATError{Code: RemoteErrSerial, Message: msg}
+	}
+}
+
+func writeRemoteJSON(w http.ResponseWriter, status int, v interface{}) {
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Println("[RemoteServer] write response failed:", err)
+	}
+}
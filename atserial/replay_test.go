@@ -0,0 +1,164 @@
+package atserial
+
+import (
+	"testing"
+	"time"
+)
+
+// endcSession was recorded with serial.capture_file against the simulated
+// RM520N-GL: LTE band 3 with an n78 EN-DC leg, two LTE carriers and three
+// stored messages, the first two being the parts of one message. Captures
+// from other firmware versions go next to it.
+const endcSession = "testdata/rm520n_endc_session.jsonl"
+
+func newReplayInterface(t *testing.T) (*NRInterface, *ReplayTransport) {
+
+	t.Helper()
+
+	replay, err := OpenReplayTransport(endcSession)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nri := NewNRInterfaceWithTransport(replay)
+	nri.SMSPDUMode = true
+	t.Cleanup(nri.Close)
+
+	return nri, replay
+}
+
+func TestReplayServingCell(t *testing.T) {
+
+	nri, replay := newReplayInterface(t)
+
+	cell, err := nri.FetchServingCell()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cell.LTE == nil || cell.NR == nil {
+		t.Fatalf("want an EN-DC cell, got %+v", cell)
+	}
+
+	lte, nr := cell.LTE, cell.NR
+	if lte.Duplex != "FDD" || lte.MCC != "460" || lte.MNC != "01" || lte.CellID != "5F1A2B3" ||
+		lte.PCI != 123 || lte.EARFCN != 1850 || lte.Band != 3 || lte.TAC != "1A2B" ||
+		lte.RSRP != -95 || lte.RSRQ != -10 || lte.RSSI != -65 || lte.SINR != 12 {
+		t.Errorf("got LTE %+v", lte)
+	}
+	if nr.Mode != "NR5G-NSA" || nr.PCI != 500 || nr.ARFCN != 627264 || nr.Band != 78 ||
+		nr.RSRP != -88 || nr.RSRQ != -11 || nr.SINR != 20 {
+		t.Errorf("got NR %+v", nr)
+	}
+
+	signal, err := nri.FetchSignalInfo()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if signal.Mode != "LTE+NR5G-NSA" || len(signal.Carriers) != 2 {
+		t.Errorf("got signal %+v", signal)
+	}
+	if pcc := signal.Carriers[0]; pcc.Role != "PCC" || pcc.Band != 3 || pcc.BandwidthMHz != 20 {
+		t.Errorf("got PCC %+v", pcc)
+	}
+
+	if missing := replay.Missing(); len(missing) > 0 {
+		t.Errorf("commands not in the capture: %q", missing)
+	}
+}
+
+func TestReplayNeighbourCells(t *testing.T) {
+
+	nri, replay := newReplayInterface(t)
+
+	cells, err := nri.FetchNeighbourCells()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cells) != 4 {
+		t.Fatalf("got %d cells: %+v", len(cells), cells)
+	}
+
+	var intra, inter, nr int
+	for _, cell := range cells {
+		switch {
+		case cell.RAT == "NR":
+			nr++
+			if cell.ARFCN != 627264 || cell.PCI != 501 || cell.RSRP != -96 || cell.RSRQ != -12 || cell.SINR != 9 {
+				t.Errorf("got NR cell %+v", cell)
+			}
+		case cell.Scope == NeighbourIntra:
+			intra++
+		case cell.Scope == NeighbourInter:
+			inter++
+			if cell.ARFCN != 100 || cell.PCI != 52 || cell.RSRP != -92 || cell.RSRQ != -9 || cell.RSSI != -62 || cell.SINR != 14 {
+				t.Errorf("got inter frequency cell %+v", cell)
+			}
+		}
+	}
+	if intra != 2 || inter != 1 || nr != 1 {
+		t.Errorf("got %d intra, %d inter and %d NR cells", intra, inter, nr)
+	}
+
+	if missing := replay.Missing(); len(missing) > 0 {
+		t.Errorf("commands not in the capture: %q", missing)
+	}
+}
+
+func TestReplaySMSList(t *testing.T) {
+
+	nri, replay := newReplayInterface(t)
+
+	list, err := nri.FetchSMS()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 3 {
+		t.Fatalf("got %d messages", len(list))
+	}
+
+	for i, sms := range list[:2] {
+		if sms.Indices != i || sms.Sender != "+10086" || sms.SMSC != "+8613800100500" || sms.Status != "REC UNREAD" {
+			t.Errorf("part %d: got %+v", i, sms)
+		}
+		if sms.Concat == nil || sms.Concat.Ref != 170 || sms.Concat.Total != 2 || sms.Concat.Seq != i+1 {
+			t.Errorf("part %d: got concat %+v", i, sms.Concat)
+		}
+	}
+	want := "Your data plan: 20GB used of 40GB this month. Reply 1 to buy an add-on pack, reply 2 for the current balance. " +
+		"Thanks for using our network! Data beyond the plan is billed at 5 CNY per GB until the 1st."
+	if got := list[0].Text + list[1].Text; got != want {
+		t.Errorf("got text %q", got)
+	}
+
+	ucs2 := list[2]
+	if ucs2.Indices != 2 || ucs2.Sender != "+8613912345678" || ucs2.Text != "你好" || ucs2.Concat != nil {
+		t.Errorf("got %+v", ucs2)
+	}
+	if ucs2.Date.IsZero() || ucs2.Date.After(time.Now()) {
+		t.Errorf("got date %v", ucs2.Date)
+	}
+
+	if missing := replay.Missing(); len(missing) > 0 {
+		t.Errorf("commands not in the capture: %q", missing)
+	}
+}
+
+func TestReplayURCs(t *testing.T) {
+
+	nri, replay := newReplayInterface(t)
+
+	events, cancel := nri.SubscribeURC(URCNewSMS)
+	defer cancel()
+	replay.ReplayURCs()
+
+	for want := 0; want < 3; want++ {
+		select {
+		case ev := <-events:
+			storage, index, err := ev.MessageIndex()
+			if err != nil || storage != "ME" || index != want {
+				t.Fatalf("got %q, %d, %v", storage, index, err)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("URC %d not replayed", want)
+		}
+	}
+}
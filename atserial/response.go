@@ -0,0 +1,234 @@
+package atserial
+
+import (
+	"fmt"
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// ErrCommandFailed is returned for a plain ERROR final result code.
+var ErrCommandFailed = errors.New("command failed with ERROR")
+
+// ATResponse is the answer to a command line: the information lines in the
+// order they were received and the final result code that ended it.
+type ATResponse struct {
+	Lines []string
+	Final string
+	Raw   string
+}
+
+// IsRetryable reports whether err carries a +CME or +CMS error that may go
+// away when the command is repeated.
+func IsRetryable(err error) bool {
+
+	var cme *CMEError
+	if errors.As(err, &cme) {
+		return cme.Retryable()
+	}
+	var cms *CMSError
+	return errors.As(err, &cms) && cms.Retryable()
+}
+
+// CMEError is a +CME ERROR final result code (3GPP TS 27.007).
+type CMEError struct {
+	Code    int
+	Message string
+}
+
+func (e *CMEError) Error() string {
+	return fmt.Sprintf("+CME ERROR: %d (%s)", e.Code, e.Message)
+}
+
+// Retryable reports whether the command may succeed when repeated a bit
+// later, e.g. while the SIM is busy.
+func (e *CMEError) Retryable() bool {
+	return e.Code == 14 || e.Code == 31
+}
+
+// CMSError is a +CMS ERROR final result code (3GPP TS 27.005).
+type CMSError struct {
+	Code    int
+	Message string
+}
+
+func (e *CMSError) Error() string {
+	return fmt.Sprintf("+CMS ERROR: %d (%s)", e.Code, e.Message)
+}
+
+func (e *CMSError) Retryable() bool {
+	return e.Code == 314 || e.Code == 332 || e.Code == 500
+}
+
+var cmeErrorMessages = map[int]string{
+	0:   "phone failure",
+	1:   "no connection to phone",
+	3:   "operation not allowed",
+	4:   "operation not supported",
+	5:   "PH-SIM PIN required",
+	10:  "SIM not inserted",
+	11:  "SIM PIN required",
+	12:  "SIM PUK required",
+	13:  "SIM failure",
+	14:  "SIM busy",
+	15:  "SIM wrong",
+	16:  "incorrect password",
+	17:  "SIM PIN2 required",
+	18:  "SIM PUK2 required",
+	20:  "memory full",
+	21:  "invalid index",
+	22:  "not found",
+	23:  "memory failure",
+	24:  "text string too long",
+	25:  "invalid characters in text string",
+	26:  "dial string too long",
+	27:  "invalid characters in dial string",
+	30:  "no network service",
+	31:  "network timeout",
+	32:  "network not allowed - emergency calls only",
+	50:  "incorrect parameters",
+	100: "unknown",
+}
+
+var cmsErrorMessages = map[int]string{
+	300: "ME failure",
+	301: "SMS service of ME reserved",
+	302: "operation not allowed",
+	303: "operation not supported",
+	304: "invalid PDU mode parameter",
+	305: "invalid text mode parameter",
+	310: "SIM not inserted",
+	311: "SIM PIN required",
+	312: "PH-SIM PIN required",
+	313: "SIM failure",
+	314: "SIM busy",
+	315: "SIM wrong",
+	316: "SIM PUK required",
+	317: "SIM PIN2 required",
+	318: "SIM PUK2 required",
+	320: "memory failure",
+	321: "invalid memory index",
+	322: "memory full",
+	330: "SMSC address unknown",
+	331: "no network service",
+	332: "network timeout",
+	340: "no +CNMA acknowledgement expected",
+	500: "unknown error",
+}
+
+var finalResultCodes = []string{"OK", "ERROR", "CONNECT", "NO CARRIER", "BUSY", "NO ANSWER", "NO DIALTONE"}
+
+func isFinalResultCode(line string) bool {
+
+	if strings.HasPrefix(line, "+CME ERROR:") || strings.HasPrefix(line, "+CMS ERROR:") {
+		return true
+	}
+	for _, code := range finalResultCodes {
+		if line == code || (code == "CONNECT" && strings.HasPrefix(line, "CONNECT ")) {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseATResponse splits raw into information lines and the final result
+// code, which has to be the last line. Earlier lines reading "OK" are kept as
+// information lines; note that the daemon already ends a response at such a
+// line (see CommandPolicy.complete).
+func ParseATResponse(raw string) (*ATResponse, error) {
+
+	rsp := &ATResponse{Raw: raw}
+	for _, line := range strings.Split(raw, "\n") {
+		line = strings.TrimSpace(line)
+		// the +CMGS prompt stays in front of the answer
+		if line == "" || line == ">" {
+			continue
+		}
+		rsp.Lines = append(rsp.Lines, line)
+	}
+
+	if len(rsp.Lines) == 0 || !isFinalResultCode(rsp.Lines[len(rsp.Lines)-1]) {
+		return rsp, fmt.Errorf("no final result code in response: %q", strings.TrimSpace(raw))
+	}
+	rsp.Final = rsp.Lines[len(rsp.Lines)-1]
+	rsp.Lines = rsp.Lines[:len(rsp.Lines)-1]
+
+	return rsp, nil
+}
+
+// Err returns nil for OK and CONNECT, *CMEError or *CMSError for the
+// extended error codes and ErrCommandFailed for ERROR.
+func (r *ATResponse) Err() error {
+
+	switch {
+	case r.Final == "OK" || strings.HasPrefix(r.Final, "CONNECT"):
+		return nil
+	case strings.HasPrefix(r.Final, "+CME ERROR:"):
+		code, msg := parseErrorCode(strings.TrimPrefix(r.Final, "+CME ERROR:"), cmeErrorMessages)
+		return &CMEError{Code: code, Message: msg}
+	case strings.HasPrefix(r.Final, "+CMS ERROR:"):
+		code, msg := parseErrorCode(strings.TrimPrefix(r.Final, "+CMS ERROR:"), cmsErrorMessages)
+		return &CMSError{Code: code, Message: msg}
+	case r.Final == "ERROR":
+		return ErrCommandFailed
+	}
+	return fmt.Errorf("command failed with %s", r.Final)
+}
+
+// parseErrorCode accepts the numeric (AT+CMEE=1) and the verbose
+// (AT+CMEE=2) form; unknown verbose texts get code -1.
+func parseErrorCode(s string, messages map[int]string) (int, string) {
+
+	s = strings.TrimSpace(s)
+	if code, err := strconv.Atoi(s); err == nil {
+		if msg, ok := messages[code]; ok {
+			return code, msg
+		}
+		return code, "unknown error"
+	}
+	for code, msg := range messages {
+		if strings.EqualFold(msg, s) {
+			return code, msg
+		}
+	}
+	return -1, s
+}
+
+// parseOKResponse parses raw and fails unless it ended with OK.
+func parseOKResponse(raw string) (*ATResponse, error) {
+
+	rsp, err := ParseATResponse(raw)
+	if err != nil {
+		return nil, err
+	}
+	return rsp, rsp.Err()
+}
+
+// Prefixed returns the values of the lines starting with prefix such as
+// "+CPMS:", with the prefix and surrounding spaces removed.
+func (r *ATResponse) Prefixed(prefix string) []string {
+
+	var values []string
+	for _, line := range r.Lines {
+		if strings.HasPrefix(line, prefix) {
+			values = append(values, strings.TrimSpace(strings.TrimPrefix(line, prefix)))
+		}
+	}
+	return values
+}
+
+// ATResponse parses the response data. Transport errors, a missing final
+// result code and failing final result codes are returned as error; the
+// parsed response is still returned for the latter two.
+func (r SerialResponse) ATResponse() (*ATResponse, error) {
+
+	if r.Err != nil {
+		return nil, r.Err
+	}
+
+	rsp, err := ParseATResponse(string(r.Data))
+	if err != nil {
+		return rsp, err
+	}
+	return rsp, rsp.Err()
+}
@@ -0,0 +1,101 @@
+package atserial
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseATResponse(t *testing.T) {
+
+	rsp, err := ParseATResponse("\r\n+QSPN: \"CMCC\",\"CMCC\",\"\",0,\"46000\"\r\n\r\nOK\r\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rsp.Final != "OK" || len(rsp.Lines) != 1 || rsp.Err() != nil {
+		t.Fatalf("got %+v", rsp)
+	}
+	if values := rsp.Prefixed("+QSPN:"); len(values) != 1 || values[0] != `"CMCC","CMCC","",0,"46000"` {
+		t.Fatalf("got prefixed %q", values)
+	}
+
+	// an OK information line, e.g. an SMS text, is kept when more follows
+	rsp, err = ParseATResponse("\r\n+CMGR: \"REC READ\",\"+10086\",,\"24/05/01,10:00:00+32\"\r\nOK\r\n\r\nOK\r\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rsp.Lines) != 2 || rsp.Lines[1] != "OK" {
+		t.Fatalf("got lines %q", rsp.Lines)
+	}
+
+	// the +CMGS prompt is dropped
+	rsp, err = ParseATResponse("\r\n> \r\n+CMGS: 12\r\n\r\nOK\r\n")
+	if err != nil || len(rsp.Lines) != 1 || rsp.Lines[0] != "+CMGS: 12" {
+		t.Fatalf("got %+v, %v", rsp, err)
+	}
+
+	if _, err := ParseATResponse("\r\n+QTEMP: \"cpu0-a7-usr\",\"45\"\r\n"); err == nil {
+		t.Fatal("expected an error without a final result code")
+	}
+}
+
+func TestATResponseErr(t *testing.T) {
+
+	tests := []struct {
+		raw       string
+		cme       int
+		cms       int
+		message   string
+		retryable bool
+	}{
+		{raw: "+CME ERROR: 10", cme: 10, message: "SIM not inserted"},
+		{raw: "+CME ERROR: 14", cme: 14, message: "SIM busy", retryable: true},
+		// verbose form after AT+CMEE=2
+		{raw: "+CME ERROR: SIM busy", cme: 14, message: "SIM busy", retryable: true},
+		{raw: "+CME ERROR: something odd", cme: -1, message: "something odd"},
+		{raw: "+CMS ERROR: 500", cms: 500, retryable: true},
+		{raw: "+CMS ERROR: 321", cms: 321},
+	}
+
+	for _, tt := range tests {
+		rsp, err := ParseATResponse("\r\n" + tt.raw + "\r\n")
+		if err != nil {
+			t.Fatalf("%s: %v", tt.raw, err)
+		}
+		err = rsp.Err()
+
+		var cme *CMEError
+		var cms *CMSError
+		switch {
+		case tt.cme != 0:
+			if !errors.As(err, &cme) || cme.Code != tt.cme || cme.Message != tt.message {
+				t.Errorf("%s: got %v", tt.raw, err)
+			}
+		case !errors.As(err, &cms) || cms.Code != tt.cms:
+			t.Errorf("%s: got %v", tt.raw, err)
+		}
+		if IsRetryable(err) != tt.retryable {
+			t.Errorf("%s: retryable %v, want %v", tt.raw, IsRetryable(err), tt.retryable)
+		}
+	}
+
+	rsp, err := ParseATResponse("\r\nERROR\r\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !errors.Is(rsp.Err(), ErrCommandFailed) || IsRetryable(rsp.Err()) {
+		t.Fatalf("got %v", rsp.Err())
+	}
+}
+
+func TestSerialResponseATResponse(t *testing.T) {
+
+	if _, err := (SerialResponse{Err: errReadTimeout}).ATResponse(); !errors.Is(err, errReadTimeout) {
+		t.Fatalf("got %v", err)
+	}
+
+	rsp, err := SerialResponse{Data: []byte("\r\n+CME ERROR: 3\r\n")}.ATResponse()
+	var cme *CMEError
+	if rsp == nil || !errors.As(err, &cme) || cme.Code != 3 {
+		t.Fatalf("got %+v, %v", rsp, err)
+	}
+}
@@ -0,0 +1,274 @@
+package atserial
+
+import (
+	"fmt"
+	"log"
+	"time"
+	"errors"
+	"context"
+	"strings"
+)
+
+// Network scan methods.
+const (
+	// ScanOperators lists the operators with AT+COPS=?
+	ScanOperators = "cops"
+	// ScanCells lists the LTE and NR cells with AT+QSCAN
+	ScanCells = "qscan"
+)
+
+const (
+	// both scans take a few minutes at most, which also keeps them below
+	// the remote server's request limit
+	scanTimeout     = 4 * time.Minute
+	scanMaxAttempts = 5
+	scanRetryDelay  = 20 * time.Second
+)
+
+var ErrScanRunning = errors.New("a network scan is already running")
+
+var copsStatus = map[string]string{
+	"0": "unknown",
+	"1": "available",
+	"2": "current",
+	"3": "forbidden",
+}
+
+var copsAccessTech = map[string]string{
+	"0":  "GSM",
+	"2":  "UTRAN",
+	"7":  "LTE",
+	"10": "LTE (5GC)",
+	"11": "NR5G",
+	"12": "NR5G",
+	"13": "EN-DC",
+}
+
+// ScanResult is one operator of AT+COPS=? or one cell of AT+QSCAN. ARFCN,
+// PCI, RSRP and RSRQ are only reported by AT+QSCAN, Operator and Status
+// only by AT+COPS=?.
+type ScanResult struct {
+	Operator  string
+	ShortName string
+	MCCMNC    string
+	RAT       string
+	Status    string
+	ARFCN     int
+	PCI       int
+	RSRP      int
+	RSRQ      int
+}
+
+// NetworkScan is a background scan started with StartNetworkScan.
+type NetworkScan struct {
+	Method   string
+	Started  time.Time
+	Finished time.Time
+	Attempts int
+	Results  []ScanResult
+	Err      error
+}
+
+func (s NetworkScan) Running() bool {
+	return s.Finished.IsZero()
+}
+
+// ParseCOPSScan parses the operator list of AT+COPS=?, e.g.
+// +COPS: (2,"CHINA MOBILE","CMCC","46000",7),(1,...),,(0,1,2,3,4),(0,1,2)
+func ParseCOPSScan(raw string) ([]ScanResult, error) {
+
+	rsp, err := parseOKResponse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("operator scan failed: %w", err)
+	}
+	lines := rsp.Prefixed("+COPS:")
+	if len(lines) == 0 {
+		return nil, errors.New("operator list not found")
+	}
+	line := lines[0]
+
+	var results []ScanResult
+	for {
+		start := strings.Index(line, "(")
+		if start < 0 {
+			break
+		}
+		end := strings.Index(line[start:], ")")
+		if end < 0 {
+			break
+		}
+		group := line[start+1 : start+end]
+		line = line[start+end+1:]
+
+		// the supported <mode> and <format> lists follow the operators, they
+		// have no quoted names
+		params := splitATParams(group)
+		if len(params) < 4 || !strings.Contains(group, "\"") {
+			continue
+		}
+		status, ok := copsStatus[params[0]]
+		if !ok {
+			continue
+		}
+
+		result := ScanResult{
+			Status:    status,
+			Operator:  params[1],
+			ShortName: params[2],
+			MCCMNC:    params[3],
+		}
+		if len(params) > 4 {
+			result.RAT = copsAccessTech[params[4]]
+			if result.RAT == "" {
+				result.RAT = params[4]
+			}
+		}
+		results = append(results, result)
+	}
+
+	return results, nil
+}
+
+// ParseQSCAN parses the cell list of AT+QSCAN, e.g.
+// +QSCAN: "LTE",460,00,1850,123,-95,-10,30,20
+// +QSCAN: "NR5G",460,00,627264,501,-88,-11,25,1
+func ParseQSCAN(raw string) ([]ScanResult, error) {
+
+	rsp, err := parseOKResponse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("cell scan failed: %w", err)
+	}
+
+	var results []ScanResult
+	for _, line := range rsp.Prefixed("+QSCAN:") {
+		params := splitATParams(line)
+		if len(params) < 7 {
+			continue
+		}
+		results = append(results, ScanResult{
+			RAT:    params[0],
+			MCCMNC: params[1] + params[2],
+			ARFCN:  atoiField(params[3]),
+			PCI:    atoiField(params[4]),
+			RSRP:   atoiField(params[5]),
+			RSRQ:   atoiField(params[6]),
+		})
+	}
+
+	return results, nil
+}
+
+// StartNetworkScan runs a scan with method (ScanOperators or ScanCells) in
+// the background and calls done with the finished scan. The scan gives the
+// port up whenever another request is queued and is retried a few times, so
+// it never holds up SMS handling.
+func (nri *NRInterface) StartNetworkScan(method string, done func(NetworkScan)) error {
+	return nri.StartNetworkScanContext(context.Background(), method, done)
+}
+
+// StartNetworkScanContext is StartNetworkScan with a context that aborts the
+// scan when done.
+func (nri *NRInterface) StartNetworkScanContext(ctx context.Context, method string, done func(NetworkScan)) error {
+
+	var cmd string
+	switch method {
+	case ScanOperators:
+		cmd = "AT+COPS=?\r\n"
+	case ScanCells:
+		cmd = "AT+QSCAN=3\r\n"
+	default:
+		return fmt.Errorf("unknown scan method %q", method)
+	}
+
+	nri.scanMu.Lock()
+	if nri.scan != nil && nri.scan.Running() {
+		nri.scanMu.Unlock()
+		return ErrScanRunning
+	}
+	nri.scan = &NetworkScan{Method: method, Started: time.Now()}
+	nri.scanMu.Unlock()
+
+	go func() {
+
+		results, attempts, err := nri.runNetworkScan(ctx, method, cmd)
+
+		nri.scanMu.Lock()
+		nri.scan.Finished = time.Now()
+		nri.scan.Attempts = attempts
+		nri.scan.Results = results
+		nri.scan.Err = err
+		scan := *nri.scan
+		nri.scanMu.Unlock()
+
+		if err != nil {
+			log.Printf("[NRInterface] %s scan failed after %d attempts: %v", method, attempts, err)
+		} else {
+			log.Printf("[NRInterface] %s scan found %d results in %v", method, len(results), scan.Finished.Sub(scan.Started))
+		}
+		if done != nil {
+			done(scan)
+		}
+	}()
+
+	return nil
+}
+
+func (nri *NRInterface) runNetworkScan(ctx context.Context, method string, cmd string) ([]ScanResult, int, error) {
+
+	for attempt := 1; ; attempt++ {
+		nri.scanMu.Lock()
+		nri.scan.Attempts = attempt
+		nri.scanMu.Unlock()
+
+		rsp, err := nri.query(ctx, SerialRequest{
+			Data:        []byte(cmd),
+			Timeout:     scanTimeout,
+			Preemptible: true,
+		})
+		if err == nil {
+			err = rsp.Err
+		}
+
+		if errors.Is(err, ErrPreempted) && attempt < scanMaxAttempts {
+			log.Printf("[NRInterface] %s scan preempted, retrying in %v", method, scanRetryDelay)
+			select {
+			case <-time.After(scanRetryDelay):
+			case <-ctx.Done():
+				return nil, attempt, ctx.Err()
+			}
+			continue
+		}
+		if err != nil {
+			return nil, attempt, err
+		}
+
+		var results []ScanResult
+		if method == ScanOperators {
+			results, err = ParseCOPSScan(string(rsp.Data))
+		} else {
+			results, err = ParseQSCAN(string(rsp.Data))
+		}
+		return results, attempt, err
+	}
+}
+
+// NetworkScanStatus returns the running or last finished scan, false when no
+// scan was started yet.
+func (nri *NRInterface) NetworkScanStatus() (NetworkScan, bool) {
+
+	nri.scanMu.Lock()
+	defer nri.scanMu.Unlock()
+
+	if nri.scan == nil {
+		return NetworkScan{}, false
+	}
+	return *nri.scan, true
+}
+
+func (r ScanResult) String() string {
+
+	if r.Operator != "" || r.ShortName != "" {
+		return fmt.Sprintf("%s (%s) %s %s [%s]", r.Operator, r.ShortName, r.MCCMNC, r.RAT, r.Status)
+	}
+	return fmt.Sprintf("%s %s ARFCN %d PCI %d RSRP %d RSRQ %d", r.RAT, r.MCCMNC, r.ARFCN, r.PCI, r.RSRP, r.RSRQ)
+}
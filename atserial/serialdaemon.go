@@ -6,8 +6,8 @@ import (
 	"time"
 	"bytes"
 	"errors"
-	"strings"
 	"context"
+	"strings"
 	"encoding/hex"
 	"crypto/sha256"
 )
@@ -16,6 +16,15 @@ type SerialRequest struct {
 	ID      uint32
 	Data    []byte
 	Timeout time.Duration
+
+	// Payload is written after the "> " prompt of +CMGS within the same
+	// command, so nothing else can reach the port in between.
+	Payload []byte
+
+	// Preemptible marks a long running command such as a network scan. It
+	// has no silence limit but is aborted as soon as another request is
+	// queued, the response then carries ErrPreempted.
+	Preemptible bool
 }
 
 type SerialResponse struct {
@@ -25,10 +34,14 @@ type SerialResponse struct {
 }
 
 type msgIn struct {
+	ctx context.Context
 	req SerialRequest
 	ch  chan SerialResponse
 }
 
+// maxQueuedRequests is how many requests may wait for the port.
+const maxQueuedRequests = 10
+
 
 type cacheEntry struct {
 	response  []byte
@@ -37,16 +50,22 @@ type cacheEntry struct {
 }
 
 type inFlightRequest struct {
-	ch   chan SerialResponse
+	resp SerialResponse
 	done chan struct{}
 }
 
 type PortDaemon struct {
 	portname string
 	baudrate int
-	port     *PosixSerialPort
+	port     SerialPort
+
+	// queue holds the requests waiting for the port. It is a slice rather
+	// than a channel so that cancelled requests can be taken out again.
+	queueMu    sync.Mutex
+	queue      []msgIn
+	queueReady chan struct{}
+	queueSpace chan struct{}
 
-	reqChan chan msgIn
 	quit    chan struct{}
 	mu      sync.Mutex
 	running bool
@@ -59,8 +78,22 @@ type PortDaemon struct {
 
 	inFlightMutex sync.Mutex
 	inFlight      map[string]*inFlightRequest
+
+	bus    *URCBus
+	rxChan chan []byte
+
+	activeMu     sync.Mutex
+	activeCmd    string
+	activePolicy CommandPolicy
+
+	recMu    sync.RWMutex
+	recorder *CaptureRecorder
 }
 
+var errReadTimeout = errors.New("timeout")
+
+var ErrPreempted = errors.New("command preempted by another request")
+
 func (pd *PortDaemon) initializePort() {
 
 	log.Println("[PortDaemon] Initializing port...")
@@ -106,8 +139,196 @@ func (pd *PortDaemon) initializePort() {
 	log.Println("[PortDaemon] Port ready and waiting for requests.")
 }
 
+func (pd *PortDaemon) setActiveCommand(cmd string, policy CommandPolicy) {
+
+	pd.activeMu.Lock()
+	pd.activeCmd = cmd
+	pd.activePolicy = policy
+	pd.activeMu.Unlock()
+}
+
+// SetRecorder makes the daemon append every command and URC to r, nil stops
+// recording.
+func (pd *PortDaemon) SetRecorder(r *CaptureRecorder) {
+
+	pd.recMu.Lock()
+	pd.recorder = r
+	pd.recMu.Unlock()
+}
+
+func (pd *PortDaemon) captureRecorder() *CaptureRecorder {
+
+	pd.recMu.RLock()
+	defer pd.recMu.RUnlock()
+	return pd.recorder
+}
+
+func (pd *PortDaemon) publishURC(ev URCEvent) {
+
+	if r := pd.captureRecorder(); r != nil {
+		r.recordURC(ev)
+	}
+	pd.bus.Publish(ev)
+}
+
+func (pd *PortDaemon) activeCommand() (string, bool) {
+
+	pd.activeMu.Lock()
+	defer pd.activeMu.Unlock()
+	return pd.activeCmd, pd.activeCmd != ""
+}
+
+func (pd *PortDaemon) activeCommandPolicy() (CommandPolicy, bool) {
+
+	pd.activeMu.Lock()
+	defer pd.activeMu.Unlock()
+	return pd.activePolicy, pd.activeCmd != ""
+}
+
+// readLoop owns all reads from the port. Complete lines are either published
+// as URCs or handed to the command in flight; anything else is dropped so it
+// can't be glued onto the next command's response.
+func (pd *PortDaemon) readLoop() {
+
+	buf := make([]byte, 4096)
+	var pending []byte
+	var urcPending *URCEvent
+	urcBodyLeft := 0
+	consecutiveErrors := 0
+
+	dispatchLine := func(line []byte) {
+
+		text := strings.TrimSpace(string(line))
+
+		if urcPending != nil {
+			if text == "" {
+				return
+			}
+			urcPending.Body = text
+			urcPending.Raw += "\r\n" + text
+			urcBodyLeft--
+			if urcBodyLeft <= 0 {
+				pd.publishURC(*urcPending)
+				urcPending = nil
+			}
+			return
+		}
+
+		cmd, active := pd.activeCommand()
+
+		if spec, ok := matchURC(text); ok && !spec.isCommandResponse(cmd) {
+			ev := newURCEvent(spec, text)
+			if spec.bodyLines > 0 {
+				urcPending = &ev
+				urcBodyLeft = spec.bodyLines
+				return
+			}
+			pd.publishURC(ev)
+			return
+		}
+
+		if active {
+			pd.deliverResponse(line)
+		} else if text != "" {
+			log.Printf("[ReadLoop] discard unsolicited data: %s", text)
+		}
+	}
+
+	for {
+		select {
+		case <-pd.quit:
+			return
+		default:
+		}
+
+		n, err := pd.port.Read(buf)
+		if err != nil && err.Error() == "timeout" {
+			consecutiveErrors = 0
+			// partial data without a line ending, e.g. garbage or a bare prompt
+			if len(pending) > 0 {
+				if _, active := pd.activeCommand(); active {
+					pd.deliverResponse(pending)
+				} else {
+					log.Printf("[ReadLoop] discard partial data: %q", string(pending))
+				}
+				pending = nil
+			}
+			continue
+		}
+
+		if err != nil || n == 0 {
+			select {
+			case <-pd.quit:
+				return
+			default:
+			}
+			consecutiveErrors++
+			if consecutiveErrors > 50 {
+				log.Printf("[ReadLoop] port keeps failing (%v), stopping daemon", err)
+				pd.Stop()
+				return
+			}
+			time.Sleep(20 * time.Millisecond)
+			continue
+		}
+		consecutiveErrors = 0
+
+		data := make([]byte, n)
+		copy(data, buf[:n])
+		pending = append(pending, data...)
+
+		for {
+			idx := bytes.IndexByte(pending, '\n')
+			if idx < 0 {
+				break
+			}
+			line := pending[:idx+1]
+			pending = pending[idx+1:]
+			dispatchLine(line)
+		}
+
+		if policy, active := pd.activeCommandPolicy(); active && policy.promptReceived(pending) {
+			pd.deliverResponse(pending)
+			pending = nil
+		}
+	}
+}
+
+func (pd *PortDaemon) deliverResponse(data []byte) {
+
+	select {
+	case pd.rxChan <- data:
+	default:
+		log.Printf("[ReadLoop] response channel full, drop: %q", string(data))
+	}
+}
+
+func (pd *PortDaemon) readResponse(timeout time.Duration) ([]byte, error) {
+
+	select {
+	case data := <-pd.rxChan:
+		return data, nil
+	case <-time.After(timeout):
+		return nil, errReadTimeout
+	case <-pd.quit:
+		return nil, errors.New("daemon stopped")
+	}
+}
+
+func (pd *PortDaemon) drainResponses() {
+
+	for {
+		select {
+		case data := <-pd.rxChan:
+			log.Printf("[PortDaemon] drop stale response data: %q", string(data))
+		default:
+			return
+		}
+	}
+}
+
 
-func StartPortDaemon(portname string, baudrate int) (*PortDaemon, error) {
+func StartPortDaemon(portname string, baudrate int, bus *URCBus) (*PortDaemon, error) {
 	
 	port, err := OpenPosixSerial(portname, baudrate)
 	if err != nil {
@@ -115,22 +336,34 @@ func StartPortDaemon(portname string, baudrate int) (*PortDaemon, error) {
 		return nil, err
 	}
 
+	pd := StartPortDaemonOn(portname, port, bus)
+	pd.baudrate = baudrate
+
+	return pd, nil
+}
+
+// StartPortDaemonOn runs a daemon on an already opened port.
+func StartPortDaemonOn(portname string, port SerialPort, bus *URCBus) *PortDaemon {
+
 	pd := &PortDaemon{
-		portname: portname,
-		baudrate: baudrate,
-		port:     port,
-		reqChan:  make(chan msgIn, 10),
-		quit:     make(chan struct{}),
-		running:  true,
-		cmdCache: make(map[string]cacheEntry),
-		inFlight: make(map[string]*inFlightRequest),
+		portname:   portname,
+		port:       port,
+		queueReady: make(chan struct{}, 1),
+		queueSpace: make(chan struct{}, 1),
+		quit:       make(chan struct{}),
+		running:    true,
+		cmdCache:   make(map[string]cacheEntry),
+		inFlight:   make(map[string]*inFlightRequest),
+		bus:        bus,
+		rxChan:     make(chan []byte, 64),
 	}
 
 	pd.initializePort()
+	go pd.readLoop()
 	go pd.run()
 	go pd.cacheCleaner()
 
-	return pd, nil
+	return pd
 }
 
 func (pd *PortDaemon) getOrCreateInFlight(key string) (*inFlightRequest, bool) {
@@ -143,7 +376,6 @@ func (pd *PortDaemon) getOrCreateInFlight(key string) (*inFlightRequest, bool) {
 	}
 
 	req := &inFlightRequest{
-		ch:   make(chan SerialResponse, 1),
 		done: make(chan struct{}),
 	}
 	pd.inFlight[key] = req
@@ -188,45 +420,47 @@ func getCacheKey(cmd string) string {
 	return hex.EncodeToString(hash[:8])
 }
 
-func getCommandTTL(cmd string) time.Duration {
+// clearCache drops every cached response after cmd changed the module state.
+func (pd *PortDaemon) clearCache(cmd string) {
 
-	if strings.Contains(cmd, `AT+QGDCNT?`) ||
-		strings.Contains(cmd, `AT+QGDNRCNT?`) ||
-		strings.Contains(cmd, `AT+CSMS`) ||
-		strings.Contains(cmd, `AT+CMGD`) {
-		return -1
-	}
+	pd.cacheMutex.Lock()
+	defer pd.cacheMutex.Unlock()
 
-	
-	if strings.Contains(cmd, `AT+QENG="servingcell"`) {
-		return 200 * time.Millisecond
+	if len(pd.cmdCache) > 0 {
+		log.Printf("[PortDaemon] Cache cleared after %s (%d entries)", cmd, len(pd.cmdCache))
+		pd.cmdCache = make(map[string]cacheEntry)
 	}
-
-	if strings.Contains(cmd, `AT+QSIMSTAT?`) ||
-		strings.Contains(cmd, `AT+QMAP=`) {
-		return 30 * time.Second
-	}
-
-	if strings.Contains(cmd, `AT+QSPN`) ||
-		strings.Contains(cmd, `AT+CGCONTRDP`) {
-		return 90 * time.Second
-	}
-
-	return 60 * time.Second
 }
 
 func (pd *PortDaemon) Query(req SerialRequest) (SerialResponse, error) {
+	return pd.QueryContext(context.Background(), req)
+}
+
+// QueryContext is Query with a context. A request cancelled while it waits
+// for the port is taken out of the queue and never reaches the modem; once
+// written it runs to completion, except preemptible commands which are
+// aborted.
+func (pd *PortDaemon) QueryContext(ctx context.Context, req SerialRequest) (SerialResponse, error) {
 	
 	if !pd.running {
 		return SerialResponse{}, errors.New("daemon not running")
 	}
+	if err := ctx.Err(); err != nil {
+		return SerialResponse{}, err
+	}
 
 	cmdStr := strings.TrimSpace(string(req.Data))
-	ttl := getCommandTTL(cmdStr)
+	policy := LookupCommandPolicy(cmdStr)
+	req.Timeout = policy.timeout(req.Timeout)
+	ttl := policy.TTL
 
 	if ttl < 0 {
 		log.Printf("[PortDaemon] COMMAND NON-CACHEABLE: %s", cmdStr)
-		return pd.executeQuery(req)
+		resp, err := pd.executeQuery(ctx, req)
+		if policy.Mutates {
+			pd.clearCache(cmdStr)
+		}
+		return resp, err
 	}
 
 	cacheKey := getCacheKey(cmdStr)
@@ -245,14 +479,21 @@ func (pd *PortDaemon) Query(req SerialRequest) (SerialResponse, error) {
 	if exists {
 		log.Printf("[PortDaemon] REQUEST COALESCING: waiting for in-flight request: %s", cmdStr)
 		select {
-		case resp := <-inFlightReq.ch:
+		case <-inFlightReq.done:
+			resp := inFlightReq.resp
+			// the request we waited for was given up by its caller, not by us
+			if isContextError(resp.Err) {
+				return pd.QueryContext(ctx, req)
+			}
 			return resp, nil
+		case <-ctx.Done():
+			return SerialResponse{}, ctx.Err()
 		case <-time.After(req.Timeout):
 			return SerialResponse{}, errors.New("coalesced request timeout")
 		}
 	}
 
-	resp, err := pd.executeQuery(req)
+	resp, err := pd.executeQuery(ctx, req)
 
 	if err == nil && resp.Err == nil && len(resp.Data) > 0 && ttl > 0 {
 		pd.cacheMutex.Lock()
@@ -265,35 +506,130 @@ func (pd *PortDaemon) Query(req SerialRequest) (SerialResponse, error) {
 		log.Printf("[PortDaemon] CACHE STORE for command: %s (TTL: %v)", cmdStr, ttl)
 	}
 	
-	inFlightReq.ch <- resp
+	inFlightReq.resp = resp
+	if err != nil {
+		inFlightReq.resp.Err = err
+	}
 	close(inFlightReq.done)
 	pd.removeInFlight(cacheKey)
 
 	return resp, err
 }
 
-func (pd *PortDaemon) executeQuery(req SerialRequest) (SerialResponse, error) {
+func isContextError(err error) bool {
+	return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
+
+func (pd *PortDaemon) executeQuery(ctx context.Context, req SerialRequest) (SerialResponse, error) {
 
 	requestID := time.Now().UnixNano()
 	pd.activeRequests.Store(requestID, time.Now())
 	defer pd.activeRequests.Delete(requestID)
 
 	reply := make(chan SerialResponse, 1)
+	m := msgIn{ctx: ctx, req: req, ch: reply}
+
+	if err := pd.enqueue(m); err != nil {
+		return SerialResponse{}, err
+	}
+
+	timeout := time.NewTimer(req.Timeout)
+	defer timeout.Stop()
 
 	select {
-	case pd.reqChan <- msgIn{req: req, ch: reply}:
-	case <-time.After(time.Second * 5):
-		return SerialResponse{}, errors.New("serial daemon channel full")
+	case rsp := <-reply:
+		return rsp, nil
+	case <-ctx.Done():
+		if pd.dequeue(reply) {
+			log.Printf("[PortDaemon] request cancelled before sending: %s", strings.TrimSpace(string(req.Data)))
+			return SerialResponse{}, ctx.Err()
+		}
+	case <-timeout.C:
+		return SerialResponse{}, errors.New("serial daemon response timeout")
 	}
 
+	// already on the port: the command can't be taken back, so report what
+	// it did
 	select {
 	case rsp := <-reply:
 		return rsp, nil
-	case <-time.After(req.Timeout):
+	case <-timeout.C:
 		return SerialResponse{}, errors.New("serial daemon response timeout")
 	}
 }
 
+// enqueue waits up to five seconds for room in the queue.
+func (pd *PortDaemon) enqueue(m msgIn) error {
+
+	full := time.NewTimer(5 * time.Second)
+	defer full.Stop()
+
+	for {
+		pd.queueMu.Lock()
+		if len(pd.queue) < maxQueuedRequests {
+			pd.queue = append(pd.queue, m)
+			pd.queueMu.Unlock()
+			notify(pd.queueReady)
+			return nil
+		}
+		pd.queueMu.Unlock()
+
+		select {
+		case <-pd.queueSpace:
+		case <-m.ctx.Done():
+			return m.ctx.Err()
+		case <-full.C:
+			return errors.New("serial daemon channel full")
+		}
+	}
+}
+
+// dequeue takes the request answered on reply out of the queue, false when
+// run already picked it up.
+func (pd *PortDaemon) dequeue(reply chan SerialResponse) bool {
+
+	pd.queueMu.Lock()
+	defer pd.queueMu.Unlock()
+
+	for i, m := range pd.queue {
+		if m.ch == reply {
+			pd.queue = append(pd.queue[:i], pd.queue[i+1:]...)
+			notify(pd.queueSpace)
+			return true
+		}
+	}
+	return false
+}
+
+func (pd *PortDaemon) nextRequest() (msgIn, bool) {
+
+	pd.queueMu.Lock()
+	defer pd.queueMu.Unlock()
+
+	if len(pd.queue) == 0 {
+		return msgIn{}, false
+	}
+	m := pd.queue[0]
+	pd.queue = pd.queue[1:]
+	notify(pd.queueSpace)
+	return m, true
+}
+
+func (pd *PortDaemon) queuedRequests() int {
+
+	pd.queueMu.Lock()
+	defer pd.queueMu.Unlock()
+	return len(pd.queue)
+}
+
+func notify(ch chan struct{}) {
+
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
+
 func (pd *PortDaemon) run() {
 	
 	defer func() {
@@ -303,20 +639,29 @@ func (pd *PortDaemon) run() {
 	}()
 
 	for {
-		select {
-		case m := <-pd.reqChan:
-			if !pd.running {
-				m.ch <- SerialResponse{Err: errors.New("daemon not running")}
+		m, ok := pd.nextRequest()
+		if !ok {
+			select {
+			case <-pd.queueReady:
 				continue
+			case <-pd.quit:
+				log.Println("[PortDaemon] Quit signal received. Shutting down.")
+				pd.running = false
+				return
 			}
-			pd.cmdMu.Lock()
-			pd.processCommand(m)
-			pd.cmdMu.Unlock()
-		case <-pd.quit:
-			log.Println("[PortDaemon] Quit signal received. Shutting down.")
-			pd.running = false
-			return
 		}
+
+		if !pd.running {
+			m.ch <- SerialResponse{Err: errors.New("daemon not running")}
+			continue
+		}
+		if err := m.ctx.Err(); err != nil {
+			m.ch <- SerialResponse{Err: err}
+			continue
+		}
+		pd.cmdMu.Lock()
+		pd.processCommand(m)
+		pd.cmdMu.Unlock()
 	}
 }
 
@@ -327,110 +672,96 @@ func (pd *PortDaemon) processCommand(m msgIn) {
 	cmdStr := strings.TrimSpace(string(m.req.Data))
 	log.Printf("[PortDaemon] sending command: %s", cmdStr)
 
-	isLongCommand := len(m.req.Data) > 50
-	isSMSCommand := strings.Contains(cmdStr, "+CMGL") ||
-		strings.Contains(cmdStr, "+CSMS") ||
-		strings.Contains(cmdStr, "+CNMI")
-
-	var effectiveTimeout time.Duration = m.req.Timeout
-	if isLongCommand || isSMSCommand {
-		effectiveTimeout = m.req.Timeout * 2
+	policy := LookupCommandPolicy(cmdStr)
+	effectiveTimeout := policy.timeout(m.req.Timeout)
+	if effectiveTimeout != m.req.Timeout {
 		log.Printf("[PortDaemon] Extended timeout: %v -> %v", m.req.Timeout, effectiveTimeout)
 	}
 
-	if strings.Contains(cmdStr, "+CMGS=") {
-		pd.handleSendSMSCommand(m, cmdStr, effectiveTimeout, startTime)
-	} else {
-		pd.handleNormalCommand(m, cmdStr, effectiveTimeout, startTime)
+	if r := pd.captureRecorder(); r != nil {
+		reply := m.ch
+		m.ch = make(chan SerialResponse, 1)
+		defer func() {
+			select {
+			case rsp := <-m.ch:
+				r.recordCommand(m.req, rsp, startTime)
+				reply <- rsp
+			default:
+			}
+		}()
+	}
+
+	pd.drainResponses()
+	pd.setActiveCommand(cmdStr, policy)
+	defer pd.setActiveCommand("", CommandPolicy{})
+
+	switch {
+	case policy.Prompt != "":
+		pd.handlePromptCommand(m, cmdStr, policy, effectiveTimeout, startTime)
+	case m.req.Preemptible || policy.Preemptible:
+		pd.handlePreemptibleCommand(m, cmdStr, policy, effectiveTimeout, startTime)
+	default:
+		pd.handleNormalCommand(m, cmdStr, policy, effectiveTimeout, startTime)
 	}
 }
 
-func (pd *PortDaemon) handleNormalCommand(m msgIn, cmdStr string, effectiveTimeout time.Duration, startTime time.Time) {
-	
-    ctx, cancel := context.WithTimeout(context.Background(), effectiveTimeout)
-    defer cancel()
+func (pd *PortDaemon) handleNormalCommand(m msgIn, cmdStr string, policy CommandPolicy, effectiveTimeout time.Duration, startTime time.Time) {
 
-    if _, err := pd.port.Write(m.req.Data); err != nil {
-        log.Printf("[PortDaemon] write error: %v", err)
-        m.ch <- SerialResponse{Err: err}
-        return
-    }
+	if _, err := pd.port.Write(m.req.Data); err != nil {
+		log.Printf("[PortDaemon] write error: %v", err)
+		m.ch <- SerialResponse{Err: err}
+		return
+	}
 
-    buf := make([]byte, 4096)
-    var response []byte
-    lastDataTime := time.Now()
-    dataTimeout := 500 * time.Millisecond
-    
-    consecutiveTimeouts := 0
-    maxConsecutiveTimeouts := 20
-	
-    for {
-        select {
-        case <-ctx.Done():
-            log.Printf("[PortDaemon] TOTAL TIMEOUT for command: %s", cmdStr)
-            m.ch <- SerialResponse{Err: errors.New("serial daemon response timeout")}
-            return
-        default:
-        }
-
-        n, err := pd.port.Read(buf)
-        
-        if err != nil {
-            if strings.Contains(err.Error(), "timeout") {
-                consecutiveTimeouts++
-                
-				if consecutiveTimeouts > maxConsecutiveTimeouts {
-                    log.Printf("[PortDaemon] SERIAL PORT UNRESPONSIVE for command: %s", cmdStr)
-                    m.ch <- SerialResponse{Err: errors.New("serial port unresponsive")}
-                    return
-                }
-                
-				if time.Since(startTime) > effectiveTimeout {
-                    log.Printf("[PortDaemon] TOTAL TIMEOUT for command: %s", cmdStr)
-                    m.ch <- SerialResponse{Err: errors.New("serial daemon response timeout")}
-                    return
-                }
-                
-                if time.Since(lastDataTime) > dataTimeout && len(response) > 0 {
-                    respStr := string(response)
-                    if strings.Contains(respStr, "\r\nOK\r\n") || strings.Contains(respStr, "\r\nERROR\r\n") ||
-                        strings.Contains(respStr, "+CME ERROR") || strings.Contains(respStr, "CONNECT") ||
-                        strings.Contains(respStr, "NO CARRIER") {
-                        log.Printf("[PortDaemon] RESPONSE COMPLETE for command: %s", cmdStr)
-                        m.ch <- SerialResponse{Data: response}
-                        return
-                    }
-                }
-                continue
-            }
-
-            log.Printf("[PortDaemon] read error: %v", err)
-            m.ch <- SerialResponse{Err: err}
-            return
-        }
-
-        consecutiveTimeouts = 0
-
-        if n > 0 {
-            lastDataTime = time.Now()
-            data := make([]byte, n)
-            copy(data, buf[:n])
-            response = append(response, data...)
-            log.Printf("[ReadLoop] Read raw buffer: %s", string(data))
-
-            respStr := string(response)
-            if strings.Contains(respStr, "\r\nOK\r\n") || strings.Contains(respStr, "\r\nERROR\r\n") ||
-                strings.Contains(respStr, "+CME ERROR") || strings.Contains(respStr, "\r\nCONNECT\r\n") ||
-                strings.Contains(respStr, "\r\nNO CARRIER\r\n") {
-                log.Printf("[PortDaemon] RESPONSE COMPLETE for command: %s", cmdStr)
-                m.ch <- SerialResponse{Data: response}
-                return
-            }
-        }
-    }
+	pd.collectResponse(m, cmdStr, policy, effectiveTimeout, startTime, nil, policy.SilenceLimit)
 }
 
-func (pd *PortDaemon) handleSendSMSCommand(m msgIn, cmdStr string, effectiveTimeout time.Duration, startTime time.Time) {
+// collectResponse reads until one of the policy's final result codes, the
+// total timeout or, unless silenceLimit is negative, silenceLimit without
+// any data.
+func (pd *PortDaemon) collectResponse(m msgIn, cmdStr string, policy CommandPolicy, effectiveTimeout time.Duration, startTime time.Time, response []byte, silenceLimit time.Duration) {
+
+	lastDataTime := time.Now()
+
+	for {
+		if time.Since(startTime) > effectiveTimeout {
+			log.Printf("[PortDaemon] TOTAL TIMEOUT for command: %s", cmdStr)
+			m.ch <- SerialResponse{Err: errors.New("serial daemon response timeout")}
+			return
+		}
+
+		chunk, err := pd.readResponse(100 * time.Millisecond)
+		if err == errReadTimeout {
+			if silenceLimit > 0 && time.Since(lastDataTime) > silenceLimit {
+				log.Printf("[PortDaemon] SERIAL PORT UNRESPONSIVE for command: %s", cmdStr)
+				m.ch <- SerialResponse{Err: errors.New("serial port unresponsive")}
+				return
+			}
+			continue
+		}
+		if err != nil {
+			log.Printf("[PortDaemon] read error: %v", err)
+			m.ch <- SerialResponse{Err: err}
+			return
+		}
+
+		if len(chunk) > 0 {
+			lastDataTime = time.Now()
+			response = append(response, chunk...)
+			log.Printf("[ReadLoop] Read raw buffer: %s", string(chunk))
+
+			if policy.complete(response) {
+				log.Printf("[PortDaemon] RESPONSE COMPLETE for command: %s", cmdStr)
+				m.ch <- SerialResponse{Data: response}
+				return
+			}
+		}
+	}
+}
+
+// handlePromptCommand waits for the policy's prompt (the "> " of +CMGS),
+// writes the request payload and collects the final answer.
+func (pd *PortDaemon) handlePromptCommand(m msgIn, cmdStr string, policy CommandPolicy, effectiveTimeout time.Duration, startTime time.Time) {
 
 	if _, err := pd.port.Write(m.req.Data); err != nil {
 		log.Printf("[PortDaemon] write error: %v", err)
@@ -438,60 +769,62 @@ func (pd *PortDaemon) handleSendSMSCommand(m msgIn, cmdStr string, effectiveTime
 		return
 	}
 
-	buf := make([]byte, 128)
 	var response []byte
-	dataTimeout := 1 * time.Second
 	lastDataTime := time.Now()
-	
-    consecutiveTimeouts := 0
-    maxConsecutiveTimeouts := 30
-	
-	for {
 
+	for {
 		if time.Since(startTime) > effectiveTimeout {
 			log.Printf("[PortDaemon] TOTAL TIMEOUT waiting for > prompt for command: %s", cmdStr)
 			m.ch <- SerialResponse{Err: errors.New("serial daemon response timeout waiting for > prompt")}
 			pd.port.Write([]byte("\r\nAT\r\n"))
-            time.Sleep(100 * time.Millisecond)
+			time.Sleep(100 * time.Millisecond)
 			return
 		}
 
-		n, err := pd.port.Read(buf)
-		if err != nil {
-			if err.Error() == "timeout" {
-				if time.Since(lastDataTime) > dataTimeout {
-					consecutiveTimeouts++
-					if consecutiveTimeouts > maxConsecutiveTimeouts {
-						log.Printf("[PortDaemon] SERIAL PORT UNRESPONSIVE for SMS command: %s", cmdStr)
-						m.ch <- SerialResponse{Err: errors.New("serial port unresponsive")}
-						
-						pd.port.Write([]byte("\r\nAT\r\n"))
-						time.Sleep(100 * time.Millisecond)
-						
-						return
-					}
-					log.Printf("[PortDaemon] No data received for %s, continuing to wait for > prompt", dataTimeout)
-					lastDataTime = time.Now()
-				}
-				continue
+		chunk, err := pd.readResponse(100 * time.Millisecond)
+		if err == errReadTimeout {
+			if policy.SilenceLimit > 0 && time.Since(lastDataTime) > policy.SilenceLimit {
+				log.Printf("[PortDaemon] SERIAL PORT UNRESPONSIVE waiting for > prompt for command: %s", cmdStr)
+				m.ch <- SerialResponse{Err: errors.New("serial port unresponsive")}
+
+				pd.port.Write([]byte("\r\nAT\r\n"))
+				time.Sleep(100 * time.Millisecond)
+
+				return
 			}
+			continue
+		}
+		if err != nil {
 			log.Printf("[PortDaemon] read error waiting for > prompt: %v", err)
 			m.ch <- SerialResponse{Err: err}
 			return
-		} else {
-            consecutiveTimeouts = 0
 		}
 
-		if n > 0 {
+		if len(chunk) > 0 {
 			lastDataTime = time.Now()
-			data := make([]byte, n)
-			copy(data, buf[:n])
-			response = append(response, data...)
-			
-			log.Printf("[ReadLoop] Read raw buffer: %s", string(data))
-			
-			if bytes.Contains(data, []byte(">")) {
+			response = append(response, chunk...)
+
+			log.Printf("[ReadLoop] Read raw buffer: %s", string(chunk))
+
+			if policy.promptReceived(chunk) {
 				log.Println("[PortDaemon] Received > prompt")
+				if len(m.req.Payload) == 0 {
+					m.ch <- SerialResponse{Data: response}
+					return
+				}
+
+				if _, err := pd.port.Write(m.req.Payload); err != nil {
+					log.Printf("[PortDaemon] payload write error: %v", err)
+					m.ch <- SerialResponse{Err: err}
+					return
+				}
+				// the network round trip of a submit easily exceeds the usual silence limit
+				pd.collectResponse(m, cmdStr, policy, effectiveTimeout, startTime, response, -1)
+				return
+			}
+
+			if policy.complete(response) {
+				log.Printf("[PortDaemon] final result instead of > prompt for command: %s", cmdStr)
 				m.ch <- SerialResponse{Data: response}
 				return
 			}
@@ -499,6 +832,81 @@ func (pd *PortDaemon) handleSendSMSCommand(m msgIn, cmdStr string, effectiveTime
 	}
 }
 
+// handlePreemptibleCommand waits for the final result code for up to
+// effectiveTimeout, however long the module stays silent. It gives the port
+// back to queued requests by aborting the command.
+func (pd *PortDaemon) handlePreemptibleCommand(m msgIn, cmdStr string, policy CommandPolicy, effectiveTimeout time.Duration, startTime time.Time) {
+
+	if _, err := pd.port.Write(m.req.Data); err != nil {
+		log.Printf("[PortDaemon] write error: %v", err)
+		m.ch <- SerialResponse{Err: err}
+		return
+	}
+
+	var response []byte
+	for {
+		if time.Since(startTime) > effectiveTimeout {
+			log.Printf("[PortDaemon] TOTAL TIMEOUT for command: %s", cmdStr)
+			pd.abortCommand(policy)
+			m.ch <- SerialResponse{Err: errors.New("serial daemon response timeout")}
+			return
+		}
+
+		if pd.queuedRequests() > 0 {
+			log.Printf("[PortDaemon] PREEMPT %s after %v for queued request", cmdStr, time.Since(startTime))
+			pd.abortCommand(policy)
+			m.ch <- SerialResponse{Data: response, Err: ErrPreempted}
+			return
+		}
+		if err := m.ctx.Err(); err != nil {
+			log.Printf("[PortDaemon] ABORT %s after %v, %v", cmdStr, time.Since(startTime), err)
+			pd.abortCommand(policy)
+			m.ch <- SerialResponse{Data: response, Err: err}
+			return
+		}
+
+		chunk, err := pd.readResponse(100 * time.Millisecond)
+		if err == errReadTimeout {
+			continue
+		}
+		if err != nil {
+			log.Printf("[PortDaemon] read error: %v", err)
+			m.ch <- SerialResponse{Err: err}
+			return
+		}
+
+		response = append(response, chunk...)
+		if policy.complete(response) {
+			log.Printf("[PortDaemon] RESPONSE COMPLETE for command: %s (%v)", cmdStr, time.Since(startTime))
+			m.ch <- SerialResponse{Data: response}
+			return
+		}
+	}
+}
+
+// abortCommand stops an abortable command (any character does) and drops
+// what the module answers to it.
+func (pd *PortDaemon) abortCommand(policy CommandPolicy) {
+
+	pd.port.Write([]byte("\r"))
+
+	var response []byte
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		chunk, err := pd.readResponse(100 * time.Millisecond)
+		if err == errReadTimeout {
+			continue
+		}
+		if err != nil {
+			return
+		}
+		response = append(response, chunk...)
+		if policy.complete(response) {
+			return
+		}
+	}
+}
+
 func (pd *PortDaemon) checkStuckRequests() {
 
 	pd.activeRequests.Range(func(key, value interface{}) bool {
@@ -511,6 +919,9 @@ func (pd *PortDaemon) checkStuckRequests() {
 }
 
 func (pd *PortDaemon) Stop() {
+
+	pd.mu.Lock()
+	defer pd.mu.Unlock()
 	
     if pd.running {
         pd.running = false
@@ -527,21 +938,33 @@ const restartInterval = 3 * time.Second
 
 type SerialSupervisor struct {
 	portname string
-	baudrate int
+	open     PortOpener
 
 	mu      sync.RWMutex
 	daemon  *PortDaemon
 	started chan struct{}
 	quit    chan struct{}
+	bus     *URCBus
+
+	recorder *CaptureRecorder
+	stopOnce sync.Once
 }
 
 func NewSupervisor(portname string, baudrate int) *SerialSupervisor {
 
+	return NewSupervisorWithOpener(portname, func() (SerialPort, error) {
+		return OpenPosixSerial(portname, baudrate)
+	})
+}
+
+func NewSupervisorWithOpener(portname string, open PortOpener) *SerialSupervisor {
+
 	s := &SerialSupervisor{
 		portname: portname,
-		baudrate: baudrate,
+		open:     open,
 		started:  make(chan struct{}),
 		quit:     make(chan struct{}),
+		bus:      NewURCBus(),
 	}
 	go s.supervisor()
 
@@ -551,14 +974,16 @@ func NewSupervisor(portname string, baudrate int) *SerialSupervisor {
 func (s *SerialSupervisor) supervisor() {
 	
 	for {
-		d, err := StartPortDaemon(s.portname, s.baudrate)
+		port, err := s.open()
 		if err != nil {
 			log.Println("[SerialSupervisor] start daemon failed:", err)
 			time.Sleep(restartInterval)
 			continue
 		}
+		d := StartPortDaemonOn(s.portname, port, s.bus)
 
 		s.mu.Lock()
+		d.SetRecorder(s.recorder)
 		s.daemon = d
 		s.mu.Unlock()
 
@@ -604,8 +1029,16 @@ func (s *SerialSupervisor) supervisor() {
 }
 
 func (s *SerialSupervisor) Query(req SerialRequest) (SerialResponse, error) {
+	return s.QueryContext(context.Background(), req)
+}
+
+func (s *SerialSupervisor) QueryContext(ctx context.Context, req SerialRequest) (SerialResponse, error) {
 	
-	<-s.started
+	select {
+	case <-s.started:
+	case <-ctx.Done():
+		return SerialResponse{}, ctx.Err()
+	}
 
 	s.mu.RLock()
 	d := s.daemon
@@ -614,9 +1047,45 @@ func (s *SerialSupervisor) Query(req SerialRequest) (SerialResponse, error) {
 	if d == nil {
 		return SerialResponse{}, errors.New("no available daemon")
 	}
-	return d.Query(req)
+	return d.QueryContext(ctx, req)
+}
+
+func (s *SerialSupervisor) URCBus() *URCBus {
+	return s.bus
+}
+
+func (s *SerialSupervisor) Healthy() bool {
+
+	s.mu.RLock()
+	d := s.daemon
+	s.mu.RUnlock()
+
+	return d != nil && d.running
+}
+
+// SetRecorder records the traffic of the current and every restarted daemon
+// to r. The supervisor closes r when it stops.
+func (s *SerialSupervisor) SetRecorder(r *CaptureRecorder) {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.recorder = r
+	if s.daemon != nil {
+		s.daemon.SetRecorder(r)
+	}
 }
 
 func (s *SerialSupervisor) Stop() {
-	close(s.quit)
+
+	s.stopOnce.Do(func() {
+		close(s.quit)
+
+		s.mu.RLock()
+		r := s.recorder
+		s.mu.RUnlock()
+		if r != nil {
+			r.Close()
+		}
+	})
 }
@@ -0,0 +1,278 @@
+package atserial
+
+import (
+	"fmt"
+	"time"
+	"errors"
+	"context"
+	"strconv"
+	"strings"
+)
+
+// LTECellInfo is the LTE part of AT+QENG="servingcell", either the anchor of
+// an EN-DC connection or the only cell.
+type LTECellInfo struct {
+	Duplex         string
+	MCC            string
+	MNC            string
+	CellID         string
+	PCI            int
+	EARFCN         int
+	Band           int
+	ULBandwidthMHz float64
+	DLBandwidthMHz float64
+	TAC            string
+	RSRP           int
+	RSRQ           int
+	RSSI           int
+	SINR           int
+	CQI            int
+	TXPower        int
+}
+
+// NRCellInfo is the NR part of AT+QENG="servingcell". Mode is NR5G-SA or
+// NR5G-NSA; an NSA secondary cell reports no duplex mode, cell ID or TAC.
+type NRCellInfo struct {
+	Mode           string
+	Duplex         string
+	MCC            string
+	MNC            string
+	CellID         string
+	PCI            int
+	TAC            string
+	ARFCN          int
+	Band           int
+	DLBandwidthMHz float64
+	RSRP           int
+	RSRQ           int
+	SINR           int
+	SCSkHz         int
+}
+
+// ServingCell is the parsed answer of AT+QENG="servingcell". Fields the
+// module reports as "-" are left at zero.
+type ServingCell struct {
+	State string
+	LTE   *LTECellInfo
+	NR    *NRCellInfo
+
+	// RAT is set for access technologies without a parser, e.g. WCDMA
+	RAT string
+}
+
+var (
+	lteBandwidthMHz = []float64{1.4, 3, 5, 10, 15, 20}
+	nrBandwidthMHz  = []float64{5, 10, 15, 20, 25, 30, 40, 50, 60, 70, 80, 90, 100, 200, 400}
+	nrSCSkHz        = []int{15, 30, 60, 120, 240}
+)
+
+func ParseServingCell(raw string) (*ServingCell, error) {
+
+	rsp, err := parseOKResponse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("fetch serving cell failed: %w", err)
+	}
+	return parseServingCell(rsp)
+}
+
+func parseServingCell(rsp *ATResponse) (*ServingCell, error) {
+
+	cell := &ServingCell{}
+	found := false
+
+	for _, line := range rsp.Lines {
+		if !strings.HasPrefix(line, "+QENG:") {
+			continue
+		}
+		found = true
+
+		fields := splitATParams(strings.TrimPrefix(line, "+QENG:"))
+		if fields[0] == "servingcell" {
+			if len(fields) > 1 {
+				cell.State = fields[1]
+			}
+			if len(fields) <= 2 {
+				continue
+			}
+			fields = fields[2:]
+		}
+
+		rat, params := fields[0], fields[1:]
+		switch rat {
+		case "LTE":
+			lte, err := parseLTEServingCell(params)
+			if err != nil {
+				return nil, err
+			}
+			cell.LTE = lte
+		case "NR5G-SA":
+			nr, err := parseNRSAServingCell(params)
+			if err != nil {
+				return nil, err
+			}
+			cell.NR = nr
+		case "NR5G-NSA":
+			nr, err := parseNRNSAServingCell(params)
+			if err != nil {
+				return nil, err
+			}
+			cell.NR = nr
+		default:
+			cell.RAT = rat
+		}
+	}
+
+	if !found {
+		return nil, errors.New("serving cell not found")
+	}
+	return cell, nil
+}
+
+// <is_tdd>,<MCC>,<MNC>,<cellID>,<PCID>,<earfcn>,<band>,<UL_bw>,<DL_bw>,<TAC>,
+// <RSRP>,<RSRQ>,<RSSI>,<SINR>,<CQI>,<tx_power>[,<srxlev>]
+func parseLTEServingCell(p []string) (*LTECellInfo, error) {
+
+	if len(p) < 16 {
+		return nil, errors.New("invalid LTE serving cell: " + strings.Join(p, ","))
+	}
+
+	return &LTECellInfo{
+		Duplex:         p[0],
+		MCC:            p[1],
+		MNC:            p[2],
+		CellID:         p[3],
+		PCI:            atoiField(p[4]),
+		EARFCN:         atoiField(p[5]),
+		Band:           atoiField(p[6]),
+		ULBandwidthMHz: lookupFloat(lteBandwidthMHz, p[7]),
+		DLBandwidthMHz: lookupFloat(lteBandwidthMHz, p[8]),
+		TAC:            p[9],
+		RSRP:           atoiField(p[10]),
+		RSRQ:           atoiField(p[11]),
+		RSSI:           atoiField(p[12]),
+		SINR:           atoiField(p[13]),
+		CQI:            atoiField(p[14]),
+		TXPower:        atoiField(p[15]),
+	}, nil
+}
+
+// <duplex>,<MCC>,<MNC>,<cellID>,<PCID>,<TAC>,<ARFCN>,<band>,<DL_bw>,<RSRP>,
+// <RSRQ>,<SINR>,<scs>[,<srxlev>]
+func parseNRSAServingCell(p []string) (*NRCellInfo, error) {
+
+	if len(p) < 13 {
+		return nil, errors.New("invalid NR5G-SA serving cell: " + strings.Join(p, ","))
+	}
+
+	return &NRCellInfo{
+		Mode:           "NR5G-SA",
+		Duplex:         p[0],
+		MCC:            p[1],
+		MNC:            p[2],
+		CellID:         p[3],
+		PCI:            atoiField(p[4]),
+		TAC:            p[5],
+		ARFCN:          atoiField(p[6]),
+		Band:           atoiField(p[7]),
+		DLBandwidthMHz: lookupFloat(nrBandwidthMHz, p[8]),
+		RSRP:           atoiField(p[9]),
+		RSRQ:           atoiField(p[10]),
+		SINR:           atoiField(p[11]),
+		SCSkHz:         lookupInt(nrSCSkHz, p[12]),
+	}, nil
+}
+
+// <MCC>,<MNC>,<PCID>,<RSRP>,<SINR>,<RSRQ>,<ARFCN>,<band>,<DL_bw>,<scs>
+func parseNRNSAServingCell(p []string) (*NRCellInfo, error) {
+
+	if len(p) < 10 {
+		return nil, errors.New("invalid NR5G-NSA serving cell: " + strings.Join(p, ","))
+	}
+
+	return &NRCellInfo{
+		Mode:           "NR5G-NSA",
+		MCC:            p[0],
+		MNC:            p[1],
+		PCI:            atoiField(p[2]),
+		RSRP:           atoiField(p[3]),
+		SINR:           atoiField(p[4]),
+		RSRQ:           atoiField(p[5]),
+		ARFCN:          atoiField(p[6]),
+		Band:           atoiField(p[7]),
+		DLBandwidthMHz: lookupFloat(nrBandwidthMHz, p[8]),
+		SCSkHz:         lookupInt(nrSCSkHz, p[9]),
+	}, nil
+}
+
+func atoiField(s string) int {
+
+	n, _ := strconv.Atoi(strings.TrimSpace(s))
+	return n
+}
+
+func lookupFloat(table []float64, s string) float64 {
+
+	idx, err := strconv.Atoi(s)
+	if err != nil || idx < 0 || idx >= len(table) {
+		return 0
+	}
+	return table[idx]
+}
+
+func lookupInt(table []int, s string) int {
+
+	idx, err := strconv.Atoi(s)
+	if err != nil || idx < 0 || idx >= len(table) {
+		return 0
+	}
+	return table[idx]
+}
+
+// NetworkMode is LTE, NR5G-SA or LTE+NR5G-NSA for an EN-DC connection.
+func (c *ServingCell) NetworkMode() string {
+
+	switch {
+	case c.LTE != nil && c.NR != nil:
+		return "LTE+" + c.NR.Mode
+	case c.NR != nil:
+		return c.NR.Mode
+	case c.LTE != nil:
+		return "LTE"
+	}
+	return c.RAT
+}
+
+func (c *ServingCell) Duplex() string {
+
+	if c.LTE != nil {
+		return c.LTE.Duplex
+	}
+	if c.NR != nil {
+		return c.NR.Duplex
+	}
+	return ""
+}
+
+func (c *ServingCell) CellID() string {
+
+	if c.LTE != nil {
+		return c.LTE.CellID
+	}
+	if c.NR != nil {
+		return c.NR.CellID
+	}
+	return ""
+}
+
+func (nri *NRInterface) FetchServingCell() (*ServingCell, error) {
+	return nri.FetchServingCellContext(context.Background())
+}
+
+func (nri *NRInterface) FetchServingCellContext(ctx context.Context) (*ServingCell, error) {
+
+	rsp, err := nri.ExecuteContext(ctx, cmdServingCell+"\r\n", time.Second)
+	if err != nil {
+		return nil, fmt.Errorf("fetch serving cell failed: %w", err)
+	}
+	return parseServingCell(rsp)
+}
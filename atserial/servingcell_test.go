@@ -0,0 +1,93 @@
+package atserial
+
+import (
+	"errors"
+	"context"
+	"testing"
+)
+
+func TestParseServingCell(t *testing.T) {
+
+	lte, err := ParseServingCell("\r\n+QENG: \"servingcell\",\"NOCONN\",\"LTE\",\"FDD\",460,01,5F1A2B3,123,1850,3,5,5,1A2B,-95,-10,-65,12,10,20,40\r\n\r\nOK\r\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lte.State != "NOCONN" || lte.LTE == nil || lte.NR != nil || lte.NetworkMode() != "LTE" {
+		t.Fatalf("got %+v", lte)
+	}
+	if c := lte.LTE; c.PCI != 123 || c.EARFCN != 1850 || c.Band != 3 || c.DLBandwidthMHz != 20 || c.RSRP != -95 || c.SINR != 12 {
+		t.Errorf("got LTE %+v", c)
+	}
+
+	sa, err := ParseServingCell("\r\n+QENG: \"servingcell\",\"NOCONN\",\"NR5G-SA\",\"TDD\",460,00,1A2B3C4D5,123,1A2B3C,627264,78,12,-85,-11,15,1,-\r\n\r\nOK\r\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sa.NR == nil || sa.LTE != nil || sa.NetworkMode() != "NR5G-SA" || sa.Duplex() != "TDD" {
+		t.Fatalf("got %+v", sa)
+	}
+	if c := sa.NR; c.CellID != "1A2B3C4D5" || c.ARFCN != 627264 || c.Band != 78 || c.RSRP != -85 || c.SCSkHz != 30 {
+		t.Errorf("got NR %+v", c)
+	}
+
+	endc, err := ParseServingCell("\r\n+QENG: \"servingcell\",\"NOCONN\"\r\n" +
+		"+QENG: \"LTE\",\"FDD\",460,01,5F1A2B3,123,1850,3,5,5,1A2B,-95,-10,-65,12,10,20,40\r\n" +
+		"+QENG: \"NR5G-NSA\",460,01,500,-88,20,-11,627264,78,12,1\r\n\r\nOK\r\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if endc.LTE == nil || endc.NR == nil || endc.NetworkMode() != "LTE+NR5G-NSA" || endc.CellID() != "5F1A2B3" {
+		t.Fatalf("got %+v", endc)
+	}
+	if c := endc.NR; c.PCI != 500 || c.RSRP != -88 || c.SINR != 20 || c.RSRQ != -11 || c.Band != 78 {
+		t.Errorf("got NR %+v", c)
+	}
+
+	if _, err := ParseServingCell("\r\nERROR\r\n"); err == nil {
+		t.Error("expected an error for ERROR")
+	}
+}
+
+func TestCellFetchErrors(t *testing.T) {
+
+	fetchers := []struct {
+		cmd   string
+		fetch func(ctx context.Context, nri *NRInterface) error
+	}{
+		{cmdServingCell, func(ctx context.Context, nri *NRInterface) error {
+			_, err := nri.FetchServingCellContext(ctx)
+			return err
+		}},
+		{cmdNeighbourCells, func(ctx context.Context, nri *NRInterface) error {
+			_, err := nri.FetchNeighbourCellsContext(ctx)
+			return err
+		}},
+		{cmdCarrierAggregation, func(ctx context.Context, nri *NRInterface) error {
+			_, err := nri.FetchCarrierAggregationContext(ctx)
+			return err
+		}},
+	}
+
+	for _, f := range fetchers {
+		nri, fake := newFakeInterface()
+		fake.SetResponse(f.cmd, "\r\n+CME ERROR: 30\r\n")
+
+		var cme *CMEError
+		if err := f.fetch(context.Background(), nri); !errors.As(err, &cme) || cme.Code != 30 {
+			t.Errorf("%s: got %v, want +CME ERROR: 30", f.cmd, err)
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		if err := f.fetch(ctx, nri); !errors.Is(err, context.Canceled) {
+			t.Errorf("%s: got %v, want context.Canceled", f.cmd, err)
+		}
+
+		fake.SetResponse(f.cmd, "\r\nOK\r\n")
+		if err := f.fetch(context.Background(), nri); f.cmd == cmdServingCell && err == nil {
+			t.Errorf("%s: want an error for an empty answer", f.cmd)
+		} else if f.cmd != cmdServingCell && err != nil {
+			t.Errorf("%s: got %v for an empty answer", f.cmd, err)
+		}
+	}
+}
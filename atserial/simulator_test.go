@@ -0,0 +1,160 @@
+package atserial_test
+
+import (
+	"strings"
+	"testing"
+
+	"nrmodule/atserial"
+	"nrmodule/simulator"
+)
+
+func TestSimulatorSnapshot(t *testing.T) {
+
+	_, nri := simulator.NewReadyInterface(t)
+
+	snapshot, err := nri.FetchSnapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	module, network, signal := snapshot.Module, snapshot.Network, snapshot.Signal
+	if module == nil || network == nil || signal == nil {
+		t.Fatalf("incomplete snapshot %+v", snapshot)
+	}
+	if len(module.Errors)+len(network.Errors)+len(signal.Errors) > 0 {
+		t.Fatalf("field errors: %v %v %v", module.Errors, network.Errors, signal.Errors)
+	}
+
+	if !strings.Contains(module.Name, "RM520N-GL") || module.CPUTempC != 45 || !module.SIMInserted || module.SIMSlot != 1 {
+		t.Errorf("got module %+v", module)
+	}
+	if network.Mode != "LTE" || network.MCCMNC != "46000" || network.APN != "cmnet" ||
+		network.IPv4 != "10.12.34.56" || network.IPv6 != "2409:8a00:1234::1" {
+		t.Errorf("got network %+v", network)
+	}
+	if network.UploadBytes == 0 || network.DownloadBytes == 0 {
+		t.Errorf("got data counters %d/%d", network.UploadBytes, network.DownloadBytes)
+	}
+	if signal.LTE == nil || signal.LTE.RSRP != -95 || signal.LTE.PCI != 123 || signal.NR != nil {
+		t.Errorf("got signal %+v", signal)
+	}
+	if len(signal.Carriers) != 2 {
+		t.Errorf("got %d carriers, want PCC and SCC", len(signal.Carriers))
+	}
+}
+
+func TestSimulatorSignalENDC(t *testing.T) {
+
+	q, nri := simulator.NewReadyInterface(t)
+	q.SetServingCell(simulator.ServingCellENDC...)
+
+	signal, err := nri.FetchSignalInfo()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if signal.LTE == nil || signal.NR == nil {
+		t.Fatalf("want LTE and NR signal for EN-DC, got %+v", signal)
+	}
+	if signal.LTE.RSRP != -95 || signal.LTE.ARFCN != 1850 {
+		t.Errorf("got LTE %+v", signal.LTE)
+	}
+	if signal.NR.RSRP != -88 || signal.NR.PCI != 500 || signal.NR.ARFCN != 627264 || signal.NR.Band != 78 {
+		t.Errorf("got NR %+v", signal.NR)
+	}
+
+	// NR keys apply to an EN-DC serving cell
+	if rsrp, err := nri.GetInfo("NR_RSRP"); err != nil || rsrp != -88 {
+		t.Errorf("got NR_RSRP %v, %v", rsrp, err)
+	}
+}
+
+func TestSimulatorNeighbourCells(t *testing.T) {
+
+	_, nri := simulator.NewReadyInterface(t)
+
+	cells, err := nri.FetchNeighbourCells()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cells) != len(simulator.NeighbourCells) {
+		t.Fatalf("got %d cells: %+v", len(cells), cells)
+	}
+
+	byPCI := make(map[int]atserial.NeighbourCell)
+	for _, cell := range cells {
+		byPCI[cell.PCI] = cell
+	}
+	if cell := byPCI[124]; cell.RAT != "LTE" || cell.Scope != atserial.NeighbourIntra || cell.ARFCN != 1850 || cell.RSRP != -101 {
+		t.Errorf("got intra frequency cell %+v", cell)
+	}
+	if cell := byPCI[52]; cell.Scope != atserial.NeighbourInter || cell.ARFCN != 100 || cell.RSRP != -92 {
+		t.Errorf("got inter frequency cell %+v", cell)
+	}
+	if cell := byPCI[501]; cell.RAT != "NR" || cell.ARFCN != 627264 || cell.RSRP != -96 {
+		t.Errorf("got NR cell %+v", cell)
+	}
+}
+
+func TestSimulatorSendMultipartSMS(t *testing.T) {
+
+	q, nri := simulator.NewReadyInterface(t)
+
+	text := strings.Repeat("0123456789", 20)
+	result, err := nri.SendRawSMS("+8613912345678", text)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Segments != 2 || result.Encoding != atserial.EncodingGSM7 || len(result.References) != 2 {
+		t.Fatalf("got result %+v", result)
+	}
+
+	sent := q.Sent()
+	if len(sent) != 2 {
+		t.Fatalf("simulator got %d messages", len(sent))
+	}
+	var joined string
+	for i, sms := range sent {
+		concat := sms.Decoded.Concat()
+		if concat == nil || concat.Total != 2 || concat.Seq != i+1 || concat.Ref != sent[0].Decoded.Concat().Ref {
+			t.Fatalf("part %d has concat %+v", i, concat)
+		}
+		if sms.Decoded.Address.String() != "+8613912345678" {
+			t.Fatalf("part %d sent to %s", i, sms.Decoded.Address)
+		}
+		joined += sms.Decoded.Text
+	}
+	if joined != text {
+		t.Fatalf("got %q", joined)
+	}
+}
+
+func TestSimulatorReceiveMultipartSMS(t *testing.T) {
+
+	q, nri := simulator.NewReadyInterface(t)
+	nri.SMSPDUMode = true
+
+	text := strings.Repeat("多部分短信", 20)
+	if _, err := q.ReceiveSMS("+10086", text); err != nil {
+		t.Fatal(err)
+	}
+
+	parts, err := nri.FetchSMS()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(parts) != 2 {
+		t.Fatalf("got %d parts", len(parts))
+	}
+
+	var joined string
+	for i, part := range parts {
+		if part.Sender != "+10086" || part.Concat == nil || part.Concat.Total != 2 || part.Concat.Seq != i+1 {
+			t.Fatalf("got part %+v", part)
+		}
+		joined += part.Text
+	}
+	if joined != text {
+		t.Fatalf("got %q", joined)
+	}
+}
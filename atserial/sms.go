@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"time"
 	"errors"
+	"context"
 	"strconv"
 	"strings"
 	"math/rand"
@@ -14,11 +15,110 @@ import (
 )
 
 type NRModuleSMS struct {
-	Text    string
-	Sender  string
-	Status  string
-	Date    time.Time
+	Text       string
+	Sender     string
+	SenderType string
+	SMSC       string
+	Status     string
+	Date       time.Time
+	Indices    int
+
+	// Concat is set on a single part of a multipart message, Parts on the
+	// reassembled logical message.
+	Concat *SMSConcat
+	Parts  []SMSPart
+
+	// Report is set when the stored message is a delivery status report for
+	// an SMS we sent rather than an incoming message
+	Report *SMSDeliveryReport
+}
+
+type SMSDeliveryReport struct {
+	Reference     int
+	Recipient     string
+	Status        SMSReportStatus
+	SubmitTime    time.Time
+	DischargeTime time.Time
+}
+
+type SMSPart struct {
+	Seq     int
 	Indices int
+	Text    string
+}
+
+var smsStatNames = map[string]string{
+	"0": "REC UNREAD",
+	"1": "REC READ",
+	"2": "STO UNSENT",
+	"3": "STO SENT",
+}
+
+// parseTextModeTimestamp parses "yy/MM/dd,hh:mm:ss±zz", zz being the zone
+// offset in quarters of an hour.
+func parseTextModeTimestamp(dateStr string) (time.Time, error) {
+
+	dateStr = strings.Trim(dateStr, "\"")
+	if len(dateStr) < 17 {
+		return time.Time{}, errors.New("invalid sms timestamp " + dateStr)
+	}
+
+	loc := time.UTC
+	if len(dateStr) > 18 {
+		quarters, err := strconv.Atoi(dateStr[18:])
+		if err != nil {
+			return time.Time{}, errors.New("invalid sms timezone " + dateStr)
+		}
+		offset := quarters * 15 * 60
+		if dateStr[17] == '-' {
+			offset = -offset
+		}
+		loc = time.FixedZone(formatZone(offset), offset)
+	}
+
+	return time.ParseInLocation("06/01/02,15:04:05", dateStr[:17], loc)
+}
+
+func smsFromPDU(p *SMSPDU, index int, stat string) NRModuleSMS {
+
+	status, ok := smsStatNames[stat]
+	if !ok {
+		status = stat
+	}
+
+	if p.Type == SMSStatusReport {
+		return NRModuleSMS{
+			Text:    p.ReportStatus.String(),
+			Sender:  p.Address.String(),
+			SMSC:    p.SMSC.String(),
+			Status:  status,
+			Date:    p.DischargeTime,
+			Indices: index,
+			Report:  deliveryReportFromPDU(p),
+		}
+	}
+
+	return NRModuleSMS{
+		Text:       p.Text,
+		Sender:     p.Address.String(),
+		SenderType: p.Address.TypeName(),
+		SMSC:       p.SMSC.String(),
+		Status:     status,
+		Date:       p.Timestamp,
+		Indices:    index,
+		Concat:     p.Concat(),
+	}
+}
+
+func deliveryReportFromPDU(p *SMSPDU) *SMSDeliveryReport {
+
+	return &SMSDeliveryReport{
+		Reference:     p.MessageRef,
+		Recipient:     p.Address.String(),
+		Status:        p.ReportStatus,
+		SubmitTime:    p.Timestamp,
+		DischargeTime: p.DischargeTime,
+	}
 }
 
 func hexToUCS2(hexIn string) (string, error) {
@@ -54,58 +154,250 @@ func stringToUCS2Hex(strIn string) []byte {
 }
 
 func (nri *NRInterface) FetchSMS() ([]NRModuleSMS, error) {
+	return nri.FetchSMSContext(context.Background())
+}
 
-	var resSMS []NRModuleSMS
-	var resulterr error
+func (nri *NRInterface) FetchSMSContext(ctx context.Context) ([]NRModuleSMS, error) {
 
-	rawdata := nri.FetchRawData("AT+CSMS=1;+CSDH=0;+CNMI=2,1,0,0,0;+CMGF=1;+CSCA?;+CSMP=17,167,0,8;+CPMS=\"ME\",\"ME\",\"ME\";+CSCS=\"UCS2\";+CMGL=\"ALL\"\r\n", 15 * time.Second)
+	if nri.SMSPDUMode {
+		return nri.fetchSMSPDU(ctx)
+	}
 
-	if strings.Contains(rawdata, "OK") {
+	var resSMS []NRModuleSMS
+	var resulterr error
 
-		lines := strings.Split(rawdata, "\r\n")
+	rsp, err := nri.ExecuteContext(ctx, "AT+CSMS=1;+CSDH=0;+CNMI=2,1,0,0,0;+CMGF=1;+CSCA?;+CSMP=17,167,0,8;+CPMS=\"ME\",\"ME\",\"ME\";+CSCS=\"UCS2\";+CMGL=\"ALL\"\r\n", 15*time.Second)
+	if err != nil {
+		return nil, fmt.Errorf("fetch sms failed: %w", err)
+	}
 
-		for index, line := range lines {
-			if strings.Contains(line, "+CMGL:") {
-				var smsContent string
-				var smsIndices int
-				var smsSender string
-				var smsStatus string
-				var smsDate time.Time
-				if index+1 < len(lines) {
-					smsContent, _ = hexToUCS2(lines[index+1])
-				}
+	lines := rsp.Lines
+	for index, line := range lines {
+		if strings.Contains(line, "+CMGL:") {
+			var smsContent string
+			var smsIndices int
+			var smsSender string
+			var smsStatus string
+			var smsDate time.Time
+			// empty lines are dropped, an empty text is directly followed by the next header
+			if index+1 < len(lines) && !strings.HasPrefix(lines[index+1], "+CMGL:") {
+				smsContent, _ = hexToUCS2(lines[index+1])
+			}
 
-				ctx := strings.Split(line, ",")
-				if len(ctx) >= 6 {
-					smsIndices, resulterr = strconv.Atoi(strings.ReplaceAll(ctx[0], "+CMGL: ", ""))
-					smsStatus = ctx[1]
-					smsSender, resulterr = hexToUCS2(strings.ReplaceAll(ctx[2], "\"", ""))
-					dateStr := strings.ReplaceAll(ctx[4], "\"", "") + "," + strings.ReplaceAll(ctx[5], "\"", "")
-					dateStr = dateStr[:len(dateStr)-3]
-					smsDate, _ = time.Parse("06/01/02,15:04:05", dateStr)
-					var sms = NRModuleSMS{
-						Text:    smsContent,
-						Indices: smsIndices,
-						Status:  smsStatus,
-						Sender:  smsSender,
-						Date:    smsDate,
-					}
-					log.Println("[NRModuleSMS] fetch sms, sender:", smsSender, "content:", smsContent, "status:", smsStatus, "indices", smsIndices, "date:", dateStr)
-					resSMS = append(resSMS, sms)
-				} else {
-					resulterr = errors.Join(resulterr, errors.New("parse SMS"+string(index)+" failed"))
+			fields := strings.Split(line, ",")
+			if len(fields) >= 6 {
+				smsIndices, resulterr = strconv.Atoi(strings.ReplaceAll(fields[0], "+CMGL: ", ""))
+				smsStatus = strings.ReplaceAll(fields[1], "\"", "")
+				smsSender, resulterr = hexToUCS2(strings.ReplaceAll(fields[2], "\"", ""))
+				dateStr := strings.ReplaceAll(fields[4], "\"", "") + "," + strings.ReplaceAll(fields[5], "\"", "")
+				smsDate, _ = parseTextModeTimestamp(dateStr)
+				var sms = NRModuleSMS{
+					Text:    smsContent,
+					Indices: smsIndices,
+					Status:  smsStatus,
+					Sender:  smsSender,
+					Date:    smsDate,
 				}
+				log.Println("[NRModuleSMS] fetch sms, sender:", smsSender, "content:", smsContent, "status:", smsStatus, "indices", smsIndices, "date:", dateStr)
+				resSMS = append(resSMS, sms)
+			} else {
+				resulterr = errors.Join(resulterr, errors.New("parse SMS"+strconv.Itoa(index)+" failed"))
 			}
 		}
+	}
 
-	} else {
-		return nil, errors.New("fetch sms rawdata failed " + rawdata)
+	return resSMS, resulterr
+}
+
+func (nri *NRInterface) fetchSMSPDU(ctx context.Context) ([]NRModuleSMS, error) {
+
+	var resSMS []NRModuleSMS
+	var resulterr error
+
+	rsp, err := nri.ExecuteContext(ctx, "AT+CSMS=1;+CSDH=0;+CNMI=2,1,0,2,0;+CMGF=0;+CSCA?;+CPMS=\"ME\",\"ME\",\"ME\";+CMGL=4\r\n", 15*time.Second)
+	if err != nil {
+		return nil, fmt.Errorf("fetch sms failed: %w", err)
+	}
+
+	lines := rsp.Lines
+	for i, line := range lines {
+		if !strings.Contains(line, "+CMGL:") {
+			continue
+		}
+
+		fields := splitATParams(strings.TrimPrefix(line, "+CMGL:"))
+		if len(fields) < 4 || i+1 >= len(lines) {
+			resulterr = errors.Join(resulterr, errors.New("parse SMS"+strconv.Itoa(i)+" failed"))
+			continue
+		}
+
+		smsIndices, err := strconv.Atoi(fields[0])
+		if err != nil {
+			resulterr = errors.Join(resulterr, err)
+			continue
+		}
+
+		pdu, err := DecodeSMSPDU(lines[i+1])
+		if err != nil {
+			resulterr = errors.Join(resulterr, fmt.Errorf("decode sms %d: %w", smsIndices, err))
+			continue
+		}
+
+		sms := smsFromPDU(pdu, smsIndices, fields[1])
+		log.Println("[NRModuleSMS] fetch pdu sms, sender:", sms.Sender, "(", sms.SenderType, ") content:", sms.Text, "status:", sms.Status, "indices", smsIndices, "date:", sms.Date)
+		resSMS = append(resSMS, sms)
 	}
 
 	return resSMS, resulterr
 }
 
+func (nri *NRInterface) readSMSPDU(ctx context.Context, index int) (*NRModuleSMS, error) {
+
+	rsp, err := nri.ExecuteContext(ctx, fmt.Sprintf("AT+CMGF=0;+CMGR=%d\r\n", index), 3*time.Second)
+	if err != nil {
+		return nil, fmt.Errorf("read sms %d failed: %w", index, err)
+	}
+
+	lines := rsp.Lines
+	for i, line := range lines {
+		if !strings.Contains(line, "+CMGR:") || i+1 >= len(lines) {
+			continue
+		}
+
+		fields := splitATParams(strings.TrimPrefix(line, "+CMGR:"))
+		pdu, err := DecodeSMSPDU(lines[i+1])
+		if err != nil {
+			return nil, fmt.Errorf("decode sms %d: %w", index, err)
+		}
+
+		sms := smsFromPDU(pdu, index, fields[0])
+		log.Println("[NRModuleSMS] read pdu sms, sender:", sms.Sender, "content:", sms.Text, "indices", index, "date:", sms.Date)
+		return &sms, nil
+	}
+
+	return nil, fmt.Errorf("sms %d not found", index)
+}
+
+// ReadStatusReport reads and removes a status report announced by +CDSI from
+// a storage other than ME, switching back to ME afterwards.
+func (nri *NRInterface) ReadStatusReport(storage string, index int) (*SMSDeliveryReport, error) {
+	return nri.ReadStatusReportContext(context.Background(), storage, index)
+}
+
+func (nri *NRInterface) ReadStatusReportContext(ctx context.Context, storage string, index int) (*SMSDeliveryReport, error) {
+
+	rsp, err := nri.ExecuteContext(ctx, fmt.Sprintf("AT+CMGF=0;+CPMS=\"%s\";+CMGR=%d;+CMGD=%d;+CPMS=\"ME\",\"ME\",\"ME\"\r\n",
+		storage, index, index), 5*time.Second)
+	if err != nil {
+		return nil, fmt.Errorf("read status report %s/%d failed: %w", storage, index, err)
+	}
+
+	lines := rsp.Lines
+	for i, line := range lines {
+		if !strings.Contains(line, "+CMGR:") || i+1 >= len(lines) {
+			continue
+		}
+		return parseStatusReportPDU(lines[i+1])
+	}
+
+	return nil, fmt.Errorf("status report %s/%d not found", storage, index)
+}
+
+// DeliveryReportFromURC decodes a status report routed directly to us as
+// "+CDS: <length>" followed by the PDU.
+func DeliveryReportFromURC(ev URCEvent) (*SMSDeliveryReport, error) {
+
+	if ev.Type != URCStatusReport {
+		return nil, errors.New("urc is not a status report")
+	}
+	return parseStatusReportPDU(ev.Body)
+}
+
+func parseStatusReportPDU(hexPDU string) (*SMSDeliveryReport, error) {
+
+	pdu, err := DecodeSMSPDU(hexPDU)
+	if err != nil {
+		return nil, fmt.Errorf("decode status report: %w", err)
+	}
+	if pdu.Type != SMSStatusReport {
+		return nil, errors.New("pdu is not a status report")
+	}
+
+	report := deliveryReportFromPDU(pdu)
+	log.Println("[NRModuleSMS] status report, reference:", report.Reference, "recipient:", report.Recipient, "status:", report.Status)
+	return report, nil
+}
+
+// AckStatusReport acknowledges a +CDS, which the SMSC expects for reports
+// routed directly to the TE when +CSMS=1.
+func (nri *NRInterface) AckStatusReport() error {
+	return nri.AckStatusReportContext(context.Background())
+}
+
+func (nri *NRInterface) AckStatusReportContext(ctx context.Context) error {
+
+	if _, err := nri.ExecuteContext(ctx, "AT+CNMA\r\n", 2*time.Second); err != nil {
+		return fmt.Errorf("ack status report failed: %w", err)
+	}
+	return nil
+}
+
+func (nri *NRInterface) ReadSMS(index int) (*NRModuleSMS, error) {
+	return nri.ReadSMSContext(context.Background(), index)
+}
+
+func (nri *NRInterface) ReadSMSContext(ctx context.Context, index int) (*NRModuleSMS, error) {
+
+	if nri.SMSPDUMode {
+		return nri.readSMSPDU(ctx, index)
+	}
+
+	rsp, err := nri.ExecuteContext(ctx, fmt.Sprintf("AT+CMGF=1;+CSCS=\"UCS2\";+CMGR=%d\r\n", index), 3*time.Second)
+	if err != nil {
+		return nil, fmt.Errorf("read sms %d failed: %w", index, err)
+	}
+
+	lines := rsp.Lines
+	for i, line := range lines {
+		if !strings.Contains(line, "+CMGR:") {
+			continue
+		}
+
+		fields := strings.Split(line, ",")
+		if len(fields) < 5 {
+			return nil, errors.New("parse sms header failed: " + line)
+		}
+
+		var smsContent string
+		if i+1 < len(lines) && !strings.HasPrefix(lines[i+1], "+CMGR:") {
+			smsContent, _ = hexToUCS2(lines[i+1])
+		}
+		smsSender, err := hexToUCS2(strings.ReplaceAll(fields[1], "\"", ""))
+		if err != nil {
+			return nil, err
+		}
+		dateStr := strings.ReplaceAll(fields[3], "\"", "") + "," + strings.ReplaceAll(fields[4], "\"", "")
+		smsDate, _ := parseTextModeTimestamp(dateStr)
+
+		sms := &NRModuleSMS{
+			Text:    smsContent,
+			Sender:  smsSender,
+			Status:  strings.Trim(strings.TrimSpace(strings.ReplaceAll(fields[0], "+CMGR:", "")), "\""),
+			Date:    smsDate,
+			Indices: index,
+		}
+		log.Println("[NRModuleSMS] read sms, sender:", smsSender, "content:", smsContent, "indices", index, "date:", dateStr)
+		return sms, nil
+	}
+
+	return nil, fmt.Errorf("sms %d not found", index)
+}
+
 func (nri *NRInterface) DeleteSMS(indices []int) error {
+	return nri.DeleteSMSContext(context.Background(), indices)
+}
+
+func (nri *NRInterface) DeleteSMSContext(ctx context.Context, indices []int) error {
 
 	var atcmds []string
 
@@ -123,44 +415,192 @@ func (nri *NRInterface) DeleteSMS(indices []int) error {
 	atcmd := strings.Join(atcmds, ";")
 	atcmd += "\r\n"
 
-	rawdata := nri.FetchRawData(atcmd, time.Second)
-	if strings.Contains(rawdata, "OK") {
-		log.Println("[NRModuleSMS] delete sms successfully", indices)
-	} else {
-		log.Println("[NRModuleSMS] delete sms failed", rawdata)
-		return errors.New("delete sms failed, serial output:" + rawdata)
+	if _, err := nri.ExecuteContext(ctx, atcmd, time.Second); err != nil {
+		log.Println("[NRModuleSMS] delete sms failed", err)
+		return fmt.Errorf("delete sms failed: %w", err)
 	}
+	log.Println("[NRModuleSMS] delete sms successfully", indices)
 
 	return nil
 }
 
-func (nri *NRInterface) SendRawSMS(phone string, msg string) error {
+const (
+	smsMaxSegments       = 255
+	gsm7SingleSeptets    = 160
+	gsm7MultipartSeptets = 153
+	ucs2SingleUnits      = 70
+	ucs2MultipartUnits   = 67
+)
+
+type SMSSendResult struct {
+	Encoding   SMSEncoding
+	Segments   int
+	ConcatRef  int
+	References []int
+}
+
+func gsm7RuneCost(r rune) int {
+
+	if _, ok := gsm7BasicReverse[r]; ok {
+		return 1
+	}
+	if _, ok := gsm7ExtensionReverse[r]; ok {
+		return 2
+	}
+	return 0
+}
+
+func ucs2RuneCost(r rune) int {
 
-	rand.Seed(time.Now().UnixNano())
-	uid := rand.Intn(256)
+	if r > 0xFFFF {
+		return 2
+	}
+	return 1
+}
 
-	phoneUCS2 := fmt.Sprintf("%X", stringToUCS2Hex(phone))
-	msgUCS2 := fmt.Sprintf("%X", stringToUCS2Hex(msg))
+// SplitSMS picks GSM 7-bit when every character fits the default alphabet
+// and UCS2 otherwise, then cuts the text into segments without splitting an
+// escape sequence or a surrogate pair.
+func SplitSMS(text string) (SMSEncoding, []string) {
+
+	encoding := EncodingGSM7
+	cost := gsm7RuneCost
+	single, multi := gsm7SingleSeptets, gsm7MultipartSeptets
+
+	for _, r := range text {
+		if gsm7RuneCost(r) == 0 {
+			encoding = EncodingUCS2
+			cost = ucs2RuneCost
+			single, multi = ucs2SingleUnits, ucs2MultipartUnits
+			break
+		}
+	}
 
-	atcmd := fmt.Sprintf("AT+CMGF=1;+CSCS=\"UCS2\";+CMGS=\"%s\",%d,1,1\r\n", phoneUCS2, uid)
+	total := 0
+	for _, r := range text {
+		total += cost(r)
+	}
+	if total <= single {
+		return encoding, []string{text}
+	}
 
-	rawdata := nri.FetchRawData(atcmd, time.Second)
+	var segments []string
+	var cur strings.Builder
+	used := 0
+	for _, r := range text {
+		c := cost(r)
+		if used+c > multi {
+			segments = append(segments, cur.String())
+			cur.Reset()
+			used = 0
+		}
+		cur.WriteRune(r)
+		used += c
+	}
+	if cur.Len() > 0 {
+		segments = append(segments, cur.String())
+	}
 
-	if strings.Contains(rawdata, ">") {
-		atcmd = msgUCS2 + string(rune(0x1A))
-		rawdata = nri.FetchRawData(atcmd, 3*time.Second)
+	return encoding, segments
+}
 
-		time.Sleep(time.Second)
+func parseCMGSReference(rsp *ATResponse) (int, error) {
 
-		log.Println("[SMS Sender] rawdata:", rawdata)
-		if strings.Contains(rawdata, "OK") {
-			return nil
-		} else {
-			return errors.New("sms sender error" + rawdata)
+	for _, value := range rsp.Prefixed("+CMGS:") {
+		return strconv.Atoi(value)
+	}
+
+	return 0, errors.New("message reference not found")
+}
+
+// SendRawSMS sends msg in PDU mode, as concatenated segments when it doesn't
+// fit into a single message. The result lists the +CMGS reference of every
+// segment that went out, also when a later segment failed.
+func (nri *NRInterface) SendRawSMS(phone string, msg string) (*SMSSendResult, error) {
+	return nri.SendRawSMSContext(context.Background(), phone, msg)
+}
+
+// SendRawSMSContext is SendRawSMS with a context. Segments not written to the
+// module yet are not sent once ctx is done.
+func (nri *NRInterface) SendRawSMSContext(ctx context.Context, phone string, msg string) (*SMSSendResult, error) {
+	return nri.sendRawSMS(ctx, phone, msg, &SMSSendResult{ConcatRef: rand.Intn(256)})
+}
+
+// ResumeRawSMS continues a send that failed partway. The segments listed in
+// sent.References are skipped and the remaining ones go out under
+// sent.ConcatRef, so the recipient joins them with the segments it already
+// has. The result lists the references of all segments.
+func (nri *NRInterface) ResumeRawSMS(phone string, msg string, sent *SMSSendResult) (*SMSSendResult, error) {
+	return nri.ResumeRawSMSContext(context.Background(), phone, msg, sent)
+}
+
+// ResumeRawSMSContext is ResumeRawSMS with a context.
+func (nri *NRInterface) ResumeRawSMSContext(ctx context.Context, phone string, msg string, sent *SMSSendResult) (*SMSSendResult, error) {
+
+	return nri.sendRawSMS(ctx, phone, msg, &SMSSendResult{
+		Segments:   sent.Segments,
+		ConcatRef:  sent.ConcatRef,
+		References: append([]int(nil), sent.References...),
+	})
+}
+
+func (nri *NRInterface) sendRawSMS(ctx context.Context, phone string, msg string, result *SMSSendResult) (*SMSSendResult, error) {
+
+	if msg == "" {
+		return nil, errors.New("empty sms content")
+	}
+
+	encoding, segments := SplitSMS(msg)
+	if len(segments) > smsMaxSegments {
+		return nil, fmt.Errorf("sms too long: %d segments", len(segments))
+	}
+	if len(result.References) > 0 && result.Segments != len(segments) {
+		return nil, fmt.Errorf("sms resume: %d segments sent before, message has %d", result.Segments, len(segments))
+	}
+	if len(result.References) > len(segments) {
+		return nil, fmt.Errorf("sms resume: %d references for %d segments", len(result.References), len(segments))
+	}
+
+	result.Encoding = encoding
+	result.Segments = len(segments)
+	concatRef := byte(result.ConcatRef)
+
+	for i := len(result.References); i < len(segments); i++ {
+		pdu := &SMSPDU{
+			Address:             NewSMSAddress(phone),
+			Encoding:            encoding,
+			Text:                segments[i],
+			ValidityPeriod:      167,
+			StatusReportRequest: true,
+		}
+		if len(segments) > 1 {
+			pdu.UDH = []UDHElement{{
+				ID:   udhConcat8Bit,
+				Data: []byte{concatRef, byte(len(segments)), byte(i + 1)},
+			}}
+		}
+
+		hexPDU, tpduLen, err := pdu.EncodeSubmit()
+		if err != nil {
+			return result, err
 		}
-	} else {
-		return errors.New("sms sender not receive the prompt")
+
+		rsp, err := nri.execute(ctx, SerialRequest{
+			Data:    []byte(fmt.Sprintf("AT+CMGF=0;+CMGS=%d\r", tpduLen)),
+			Payload: []byte(hexPDU + string(rune(0x1A))),
+			Timeout: 20 * time.Second,
+		})
+		if err != nil {
+			return result, fmt.Errorf("sms segment %d/%d send error: %w", i+1, len(segments), err)
+		}
+		log.Println("[SMS Sender] segment", i+1, "/", len(segments), "response:", rsp.Lines, rsp.Final)
+
+		mr, err := parseCMGSReference(rsp)
+		if err != nil {
+			return result, fmt.Errorf("sms segment %d/%d: %w", i+1, len(segments), err)
+		}
+		result.References = append(result.References, mr)
 	}
 
-	return nil
+	return result, nil
 }
@@ -0,0 +1,263 @@
+package atserial
+
+import (
+	"fmt"
+	"time"
+	"errors"
+	"context"
+	"strings"
+)
+
+// ErrNetworkInactive is returned by FetchNetworkInfo when no SIM is inserted.
+var ErrNetworkInactive = errors.New("network inactivity")
+
+// FieldError names a field of an info struct that could not be fetched. The
+// other fields are still filled in.
+type FieldError struct {
+	Field string `json:"field"`
+	Error string `json:"error"`
+}
+
+func (e FieldError) String() string {
+	return e.Field + ": " + e.Error
+}
+
+type fieldErrors []FieldError
+
+// add records err for every field and reports whether err was nil.
+func (e *fieldErrors) add(err error, fields ...string) bool {
+
+	if err == nil {
+		return true
+	}
+	for _, field := range fields {
+		*e = append(*e, FieldError{Field: field, Error: err.Error()})
+	}
+	return false
+}
+
+// result is the error of a whole fetch: the context error, or an error when
+// none of the total fields could be fetched.
+func (e fieldErrors) result(ctx context.Context, what string, total int) error {
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if len(e) < total {
+		return nil
+	}
+
+	msgs := make([]string, 0, len(e))
+	for _, fe := range e {
+		msgs = append(msgs, fe.String())
+	}
+	return fmt.Errorf("fetch %s failed: %s", what, strings.Join(msgs, "; "))
+}
+
+// The commands behind each info struct, sent once per fetch.
+var (
+	moduleInfoCommands  = []string{cmdModuleName, cmdCPUTemp, cmdSIMStatus, cmdSIMSlot}
+	networkInfoCommands = []string{cmdServingCell, cmdMCCMNC, cmdAPN, cmdWWAN, cmdLTEDataCounter, cmdNRDataCounter}
+	signalInfoCommands  = []string{cmdServingCell, cmdCarrierAggregation}
+)
+
+// ModuleInfo describes the module and its SIM.
+type ModuleInfo struct {
+	Name        string       `json:"name"`
+	CPUTempC    int          `json:"cpu_temp_c"`
+	SIMInserted bool         `json:"sim_inserted"`
+	SIMSlot     int          `json:"sim_slot"`
+	FetchedAt   time.Time    `json:"fetched_at"`
+	Errors      []FieldError `json:"errors,omitempty"`
+}
+
+// NetworkInfo describes the registered network and the data session.
+// MCCMNC keeps leading zeros of the MNC, the counters are in bytes.
+type NetworkInfo struct {
+	Mode          string       `json:"mode"`
+	Duplex        string       `json:"duplex"`
+	MCCMNC        string       `json:"mccmnc"`
+	CellID        string       `json:"cell_id"`
+	APN           string       `json:"apn"`
+	IPv4          string       `json:"ipv4,omitempty"`
+	IPv6          string       `json:"ipv6,omitempty"`
+	UploadBytes   int64        `json:"upload_bytes"`
+	DownloadBytes int64        `json:"download_bytes"`
+	FetchedAt     time.Time    `json:"fetched_at"`
+	Errors        []FieldError `json:"errors,omitempty"`
+}
+
+func (n *NetworkInfo) UploadSize() string {
+	return bytesToSize(float64(n.UploadBytes))
+}
+
+func (n *NetworkInfo) DownloadSize() string {
+	return bytesToSize(float64(n.DownloadBytes))
+}
+
+// CellSignal is the signal of a serving cell. RSRP is in dBm, RSRQ and SINR
+// in dB.
+type CellSignal struct {
+	Band  int `json:"band"`
+	ARFCN int `json:"arfcn"`
+	PCI   int `json:"pci"`
+	RSRP  int `json:"rsrp_dbm"`
+	RSRQ  int `json:"rsrq_db"`
+	SINR  int `json:"sinr_db"`
+}
+
+// SignalInfo holds the LTE and/or NR serving cell signal, both for an EN-DC
+// connection such as LTE+NR5G-NSA, and the component carriers in use.
+type SignalInfo struct {
+	Mode      string             `json:"mode"`
+	LTE       *CellSignal        `json:"lte,omitempty"`
+	NR        *CellSignal        `json:"nr,omitempty"`
+	Carriers  []CarrierComponent `json:"carriers,omitempty"`
+	FetchedAt time.Time          `json:"fetched_at"`
+	Errors    []FieldError       `json:"errors,omitempty"`
+}
+
+// DeviceSnapshot is everything FetchSnapshot could read in one go. Module,
+// Network and Signal are nil when they could not be fetched at all, Errors
+// says why.
+type DeviceSnapshot struct {
+	Module    *ModuleInfo  `json:"module,omitempty"`
+	Network   *NetworkInfo `json:"network,omitempty"`
+	Signal    *SignalInfo  `json:"signal,omitempty"`
+	FetchedAt time.Time    `json:"fetched_at"`
+	Errors    []FieldError `json:"errors,omitempty"`
+}
+
+func (nri *NRInterface) FetchModuleInfo() (*ModuleInfo, error) {
+	return nri.FetchModuleInfoContext(context.Background())
+}
+
+// FetchModuleInfoContext fails only when ctx is done or no field could be
+// read, other failures are listed in Errors.
+func (nri *NRInterface) FetchModuleInfoContext(ctx context.Context) (*ModuleInfo, error) {
+
+	ctx = nri.withCommandBatch(ctx, moduleInfoCommands)
+
+	info := &ModuleInfo{FetchedAt: time.Now()}
+	var errs fieldErrors
+	var err error
+
+	info.Name, err = nri.fetchModuleName(ctx)
+	errs.add(err, "name")
+	info.CPUTempC, err = nri.fetchCPUTemp(ctx)
+	errs.add(err, "cpu_temp_c")
+	info.SIMInserted, err = nri.fetchSIMInserted(ctx)
+	errs.add(err, "sim_inserted")
+	info.SIMSlot, err = nri.fetchSIMSlot(ctx)
+	errs.add(err, "sim_slot")
+
+	info.Errors = errs
+	return info, errs.result(ctx, "module info", 4)
+}
+
+func (nri *NRInterface) FetchNetworkInfo() (*NetworkInfo, error) {
+	return nri.FetchNetworkInfoContext(context.Background())
+}
+
+// FetchNetworkInfoContext returns ErrNetworkInactive without a SIM. Like
+// FetchModuleInfoContext it reports single failed fields in Errors.
+func (nri *NRInterface) FetchNetworkInfoContext(ctx context.Context) (*NetworkInfo, error) {
+
+	inserted, err := nri.fetchSIMInserted(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !inserted {
+		return nil, ErrNetworkInactive
+	}
+	ctx = nri.withCommandBatch(ctx, networkInfoCommands)
+
+	info := &NetworkInfo{FetchedAt: time.Now()}
+	var errs fieldErrors
+
+	cell, err := nri.FetchServingCellContext(ctx)
+	if errs.add(err, "mode", "duplex", "cell_id") {
+		info.Mode = cell.NetworkMode()
+		info.Duplex = cell.Duplex()
+		info.CellID = cell.CellID()
+	}
+	info.MCCMNC, err = nri.fetchMCCMNC(ctx)
+	errs.add(err, "mccmnc")
+	info.APN, err = nri.fetchAPN(ctx)
+	errs.add(err, "apn")
+	info.IPv4, err = nri.fetchWWANAddress(ctx, "IPV4")
+	errs.add(err, "ipv4")
+	info.IPv6, err = nri.fetchWWANAddress(ctx, "IPV6")
+	errs.add(err, "ipv6")
+	info.UploadBytes, info.DownloadBytes, err = nri.fetchDataCounters(ctx)
+	errs.add(err, "upload_bytes", "download_bytes")
+
+	info.Errors = errs
+	return info, errs.result(ctx, "network info", 9)
+}
+
+func (nri *NRInterface) FetchSignalInfo() (*SignalInfo, error) {
+	return nri.FetchSignalInfoContext(context.Background())
+}
+
+// FetchSignalInfoContext fails when the serving cell is neither LTE nor NR.
+// A failed carrier aggregation query is reported in Errors.
+func (nri *NRInterface) FetchSignalInfoContext(ctx context.Context) (*SignalInfo, error) {
+
+	ctx = nri.withCommandBatch(ctx, signalInfoCommands)
+	cell, err := nri.FetchServingCellContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if cell.LTE == nil && cell.NR == nil {
+		return nil, errors.New("network mode not recognized")
+	}
+
+	info := &SignalInfo{
+		Mode:      cell.NetworkMode(),
+		FetchedAt: time.Now(),
+	}
+	if lte := cell.LTE; lte != nil {
+		info.LTE = &CellSignal{Band: lte.Band, ARFCN: lte.EARFCN, PCI: lte.PCI, RSRP: lte.RSRP, RSRQ: lte.RSRQ, SINR: lte.SINR}
+	}
+	if nr := cell.NR; nr != nil {
+		info.NR = &CellSignal{Band: nr.Band, ARFCN: nr.ARFCN, PCI: nr.PCI, RSRP: nr.RSRP, RSRQ: nr.RSRQ, SINR: nr.SINR}
+	}
+
+	var errs fieldErrors
+	ca, err := nri.FetchCarrierAggregationContext(ctx)
+	if errs.add(err, "carriers") {
+		info.Carriers = ca.Carriers
+	}
+
+	info.Errors = errs
+	return info, ctx.Err()
+}
+
+func (nri *NRInterface) FetchSnapshot() (*DeviceSnapshot, error) {
+	return nri.FetchSnapshotContext(context.Background())
+}
+
+// FetchSnapshotContext reads module, network and signal info. It fails only
+// when ctx is done or none of them could be read. Commands needed by more
+// than one of them, such as AT+QENG="servingcell", are sent once.
+func (nri *NRInterface) FetchSnapshotContext(ctx context.Context) (*DeviceSnapshot, error) {
+
+	ctx = nri.withCommandBatch(ctx, nil)
+	snapshot := &DeviceSnapshot{FetchedAt: time.Now()}
+	var errs fieldErrors
+	var err error
+
+	if snapshot.Module, err = nri.FetchModuleInfoContext(ctx); !errs.add(err, "module") {
+		snapshot.Module = nil
+	}
+	if snapshot.Network, err = nri.FetchNetworkInfoContext(ctx); !errs.add(err, "network") {
+		snapshot.Network = nil
+	}
+	if snapshot.Signal, err = nri.FetchSignalInfoContext(ctx); !errs.add(err, "signal") {
+		snapshot.Signal = nil
+	}
+
+	snapshot.Errors = errs
+	return snapshot, errs.result(ctx, "snapshot", 3)
+}
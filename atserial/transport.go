@@ -0,0 +1,121 @@
+package atserial
+
+import (
+	"fmt"
+	"time"
+	"context"
+)
+
+// SerialPort is the byte stream the PortDaemon talks AT over. Read returns an
+// error when nothing arrived within the read timeout.
+type SerialPort interface {
+	Read(buf []byte) (int, error)
+	Write(data []byte) (int, error)
+	Close() error
+	SetReadTimeout(timeout time.Duration)
+}
+
+// PortOpener opens a fresh SerialPort, it is called again whenever the
+// supervisor restarts the daemon.
+type PortOpener func() (SerialPort, error)
+
+// Transport carries AT requests to a modem. NRInterface only talks to the
+// modem through a Transport. Query gives up when ctx is done, requests that
+// did not reach the modem yet are dropped.
+type Transport interface {
+	Query(ctx context.Context, req SerialRequest) (SerialResponse, error)
+	Health() error
+	Close() error
+}
+
+// URCSource is implemented by transports that deliver unsolicited result
+// codes.
+type URCSource interface {
+	URCBus() *URCBus
+}
+
+// LocalTransport drives a modem attached to this host through a supervised
+// PortDaemon.
+type LocalTransport struct {
+	supervisor *SerialSupervisor
+}
+
+func NewLocalTransport(portname string, baudrate int) *LocalTransport {
+
+	return &LocalTransport{supervisor: NewSupervisor(portname, baudrate)}
+}
+
+// NewLocalTransportWithOpener is like NewLocalTransport for ports that are
+// not a POSIX tty, e.g. a TCP-to-serial bridge.
+func NewLocalTransportWithOpener(name string, open PortOpener) *LocalTransport {
+
+	return &LocalTransport{supervisor: NewSupervisorWithOpener(name, open)}
+}
+
+func (t *LocalTransport) Query(ctx context.Context, req SerialRequest) (SerialResponse, error) {
+	return t.supervisor.QueryContext(ctx, req)
+}
+
+func (t *LocalTransport) Health() error {
+
+	if !t.supervisor.Healthy() {
+		return fmt.Errorf("serial daemon on %s not running", t.supervisor.portname)
+	}
+	return nil
+}
+
+func (t *LocalTransport) Close() error {
+
+	t.supervisor.Stop()
+	return nil
+}
+
+func (t *LocalTransport) URCBus() *URCBus {
+	return t.supervisor.URCBus()
+}
+
+func (t *LocalTransport) Supervisor() *SerialSupervisor {
+	return t.supervisor
+}
+
+// RemoteTransport forwards requests to a remote `nrmodule serve` instance and
+// republishes its URC stream locally.
+type RemoteTransport struct {
+	client *RemoteClient
+	bus    *URCBus
+	quit   chan struct{}
+}
+
+func NewRemoteTransport(baseURL string, token string) *RemoteTransport {
+
+	t := &RemoteTransport{
+		client: NewRemoteClient(baseURL, token),
+		bus:    NewURCBus(),
+		quit:   make(chan struct{}),
+	}
+	go t.client.StreamURC(t.bus, t.quit)
+
+	return t
+}
+
+func (t *RemoteTransport) Query(ctx context.Context, req SerialRequest) (SerialResponse, error) {
+	return t.client.Query(ctx, req)
+}
+
+func (t *RemoteTransport) Health() error {
+	return t.client.Health()
+}
+
+func (t *RemoteTransport) Close() error {
+
+	select {
+	case <-t.quit:
+	default:
+		close(t.quit)
+	}
+	return nil
+}
+
+func (t *RemoteTransport) URCBus() *URCBus {
+	return t.bus
+}
@@ -0,0 +1,238 @@
+package atserial
+
+import (
+	"log"
+	"sync"
+	"time"
+	"errors"
+	"strconv"
+	"strings"
+)
+
+type URCType int
+
+const (
+	URCUnknown URCType = iota
+	URCNewSMS
+	URCNewSMSDirect
+	URCStatusReport
+	URCStatusReportIndex
+	URCRegistration
+	URCIndication
+	URCRing
+	URCPacketDomain
+	URCSimStatus
+)
+
+func (t URCType) String() string {
+
+	switch t {
+	case URCNewSMS:
+		return "NewSMS"
+	case URCNewSMSDirect:
+		return "NewSMSDirect"
+	case URCStatusReport:
+		return "StatusReport"
+	case URCStatusReportIndex:
+		return "StatusReportIndex"
+	case URCRegistration:
+		return "Registration"
+	case URCIndication:
+		return "Indication"
+	case URCRing:
+		return "Ring"
+	case URCPacketDomain:
+		return "PacketDomain"
+	case URCSimStatus:
+		return "SimStatus"
+	default:
+		return "Unknown"
+	}
+}
+
+// URCEvent is one unsolicited result code. Body holds the extra line that
+// follows two-line URCs such as +CMT and +CDS.
+type URCEvent struct {
+	Type   URCType   `json:"-"`
+	Name   string    `json:"name"`
+	Params []string  `json:"params"`
+	Body   string    `json:"body,omitempty"`
+	Raw    string    `json:"raw"`
+	Time   time.Time `json:"time"`
+}
+
+type urcSpec struct {
+	name      string
+	urcType   URCType
+	bodyLines int
+}
+
+var urcSpecs = []urcSpec{
+	{name: "+CMTI", urcType: URCNewSMS},
+	{name: "+CMT", urcType: URCNewSMSDirect, bodyLines: 1},
+	{name: "+CDSI", urcType: URCStatusReportIndex},
+	{name: "+CDS", urcType: URCStatusReport, bodyLines: 1},
+	{name: "+CREG", urcType: URCRegistration},
+	{name: "+CGREG", urcType: URCRegistration},
+	{name: "+CEREG", urcType: URCRegistration},
+	{name: "+C5GREG", urcType: URCRegistration},
+	{name: "+QIND", urcType: URCIndication},
+	{name: "RING", urcType: URCRing},
+	{name: "+CGEV", urcType: URCPacketDomain},
+	{name: "+QUSIM", urcType: URCSimStatus},
+	{name: "+CPIN", urcType: URCSimStatus},
+}
+
+func matchURC(line string) (urcSpec, bool) {
+
+	for _, spec := range urcSpecs {
+		if line == spec.name || strings.HasPrefix(line, spec.name+":") {
+			return spec, true
+		}
+	}
+
+	return urcSpec{}, false
+}
+
+func urcTypeOf(name string) URCType {
+
+	if spec, ok := matchURC(name); ok {
+		return spec.urcType
+	}
+	return URCUnknown
+}
+
+// isCommandResponse reports whether a URC-looking line is actually the answer
+// to the command in flight, e.g. "+CREG: 0,1" after "AT+CREG?".
+func (spec urcSpec) isCommandResponse(cmd string) bool {
+
+	if cmd == "" || !strings.HasPrefix(spec.name, "+") {
+		return false
+	}
+	return strings.Contains(strings.ToUpper(cmd), spec.name)
+}
+
+func newURCEvent(spec urcSpec, line string) URCEvent {
+
+	ev := URCEvent{
+		Type: spec.urcType,
+		Name: spec.name,
+		Raw:  line,
+		Time: time.Now(),
+	}
+
+	if idx := strings.Index(line, ":"); idx >= 0 {
+		ev.Params = splitATParams(line[idx+1:])
+	}
+
+	return ev
+}
+
+// splitATParams splits a result code parameter list on commas outside of
+// quotes and strips the quotes from each value.
+func splitATParams(s string) []string {
+
+	var params []string
+	var cur strings.Builder
+	inQuote := false
+
+	for _, r := range s {
+		switch {
+		case r == '"':
+			inQuote = !inQuote
+		case r == ',' && !inQuote:
+			params = append(params, strings.TrimSpace(cur.String()))
+			cur.Reset()
+		default:
+			cur.WriteRune(r)
+		}
+	}
+	params = append(params, strings.TrimSpace(cur.String()))
+
+	return params
+}
+
+// MessageIndex returns the storage and index carried by +CMTI and +CDSI.
+func (ev URCEvent) MessageIndex() (string, int, error) {
+
+	if ev.Type != URCNewSMS && ev.Type != URCStatusReportIndex {
+		return "", 0, errors.New("urc does not carry a message index")
+	}
+	if len(ev.Params) < 2 {
+		return "", 0, errors.New("invalid urc params: " + ev.Raw)
+	}
+
+	index, err := strconv.Atoi(ev.Params[1])
+	if err != nil {
+		return "", 0, errors.New("invalid message index: " + ev.Raw)
+	}
+
+	return ev.Params[0], index, nil
+}
+
+type urcSubscriber struct {
+	ch    chan URCEvent
+	types map[URCType]bool
+}
+
+type URCBus struct {
+	mu     sync.RWMutex
+	subs   map[int]*urcSubscriber
+	nextID int
+}
+
+func NewURCBus() *URCBus {
+	return &URCBus{
+		subs: make(map[int]*urcSubscriber),
+	}
+}
+
+// Subscribe returns a channel receiving the given URC types (all types when
+// none are given) and a function that cancels the subscription.
+func (b *URCBus) Subscribe(types ...URCType) (<-chan URCEvent, func()) {
+
+	sub := &urcSubscriber{
+		ch:    make(chan URCEvent, 16),
+		types: make(map[URCType]bool),
+	}
+	for _, t := range types {
+		sub.types[t] = true
+	}
+
+	b.mu.Lock()
+	id := b.nextID
+	b.nextID++
+	b.subs[id] = sub
+	b.mu.Unlock()
+
+	var once sync.Once
+	cancel := func() {
+		once.Do(func() {
+			b.mu.Lock()
+			delete(b.subs, id)
+			b.mu.Unlock()
+			close(sub.ch)
+		})
+	}
+
+	return sub.ch, cancel
+}
+
+func (b *URCBus) Publish(ev URCEvent) {
+
+	log.Printf("[URCBus] %s event: %s", ev.Type, ev.Raw)
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	for _, sub := range b.subs {
+		if len(sub.types) > 0 && !sub.types[ev.Type] {
+			continue
+		}
+		select {
+		case sub.ch <- ev:
+		default:
+			log.Printf("[URCBus] subscriber busy, drop %s event", ev.Type)
+		}
+	}
+}
@@ -11,18 +11,43 @@ type Config struct {
 	Serial  SerialConfig  `yaml:"serial"`
 	SMS     SMSConfig     `yaml:"sms"`
 	Discord DiscordConfig `yaml:"discord"`
+	Server  ServerConfig  `yaml:"server"`
+	Radio   RadioConfig   `yaml:"radio"`
+	Metrics MetricsConfig `yaml:"metrics"`
 }
 
 type SerialConfig struct {
-	IsLocal   bool   `yaml:"is_local"`
-	Port      string `yaml:"port"`
-	BaudRate  int    `yaml:"baud_rate"`
-	RemoteAPI string `yaml:"remote_api"`
+	IsLocal     bool   `yaml:"is_local"`
+	Port        string `yaml:"port"`
+	BaudRate    int    `yaml:"baud_rate"`
+	RemoteAPI   string `yaml:"remote_api"`
+	RemoteToken string `yaml:"remote_token"`
+	CaptureFile string `yaml:"capture_file"`
+	// ChainCommands sends the commands of an info fetch as chained lines
+	ChainCommands bool `yaml:"chain_commands"`
+
+	CommandPolicies []CommandPolicyConfig `yaml:"command_policies"`
+}
+
+// CommandPolicyConfig adds or overrides the daemon's handling of the AT
+// commands starting with Prefix.
+type CommandPolicyConfig struct {
+	Prefix       string        `yaml:"prefix"`
+	Final        []string      `yaml:"final"`
+	Prompt       string        `yaml:"prompt"`
+	MaxDuration  time.Duration `yaml:"max_duration"`
+	SilenceLimit time.Duration `yaml:"silence_limit"`
+	TTL          time.Duration `yaml:"ttl"`
+	Mutates      bool          `yaml:"mutates"`
+	SetOnly      bool          `yaml:"set_only"`
+	Preemptible  bool          `yaml:"preemptible"`
 }
 
 type SMSConfig struct {
 	DBPath        string        `yaml:"db_path"`
 	CheckInterval time.Duration `yaml:"check_interval"`
+	PDUMode       bool          `yaml:"pdu_mode"`
+	ConcatTimeout time.Duration `yaml:"concat_timeout"`
 }
 
 type DiscordConfig struct {
@@ -30,6 +55,24 @@ type DiscordConfig struct {
 	ChannelID string `yaml:"channel_id"`
 }
 
+type ServerConfig struct {
+	Listen string `yaml:"listen"`
+	Token  string `yaml:"token"`
+}
+
+type RadioConfig struct {
+	LockRevertAfter time.Duration `yaml:"lock_revert_after"`
+}
+
+// MetricsConfig controls the signal and traffic history kept in the metrics
+// table of the SMS database.
+type MetricsConfig struct {
+	Enabled      bool          `yaml:"enabled"`
+	Interval     time.Duration `yaml:"interval"`
+	RawRetention time.Duration `yaml:"raw_retention"`
+	Retention    time.Duration `yaml:"retention"`
+}
+
 func Load(filename string) (*Config, error) {
 
 	data, err := os.ReadFile(filename)
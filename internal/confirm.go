@@ -0,0 +1,89 @@
+package internal
+
+import (
+	"fmt"
+	"log"
+	"time"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+const confirmTimeout = 2 * time.Minute
+
+// pendingAction is a command that changes the modem and only runs once the
+// user who issued it repeats the token with !confirm. run gets the context of
+// the !confirm command.
+type pendingAction struct {
+	description string
+	authorID    string
+	expires     time.Time
+	run         func(ctx context.Context) (string, error)
+}
+
+func newConfirmToken() string {
+
+	buf := make([]byte, 3)
+	if _, err := rand.Read(buf); err != nil {
+		return fmt.Sprintf("%06x", time.Now().UnixNano()&0xffffff)
+	}
+	return hex.EncodeToString(buf)
+}
+
+// requestConfirmation parks run until it is confirmed within confirmTimeout.
+func (bot *DiscordBot) requestConfirmation(m *discordgo.MessageCreate, description string, run func(ctx context.Context) (string, error)) {
+
+	token := newConfirmToken()
+
+	bot.pendingMu.Lock()
+	for t, action := range bot.pending {
+		if time.Now().After(action.expires) {
+			delete(bot.pending, t)
+		}
+	}
+	bot.pending[token] = &pendingAction{
+		description: description,
+		authorID:    m.Author.ID,
+		expires:     time.Now().Add(confirmTimeout),
+		run:         run,
+	}
+	bot.pendingMu.Unlock()
+
+	bot.session.ChannelMessageSend(m.ChannelID, fmt.Sprintf("About to %s.\nType `!confirm %s` within %v to proceed.",
+		description, token, confirmTimeout))
+}
+
+func (bot *DiscordBot) processConfirmCmd(ctx context.Context, m *discordgo.MessageCreate, args []string) {
+
+	if len(args) != 1 {
+		bot.session.ChannelMessageSend(m.ChannelID, "Usage: !confirm <token>")
+		return
+	}
+
+	bot.pendingMu.Lock()
+	action, ok := bot.pending[args[0]]
+	if ok && action.authorID == m.Author.ID {
+		delete(bot.pending, args[0])
+	}
+	bot.pendingMu.Unlock()
+
+	switch {
+	case !ok || time.Now().After(action.expires):
+		bot.session.ChannelMessageSend(m.ChannelID, "Unknown or expired confirmation token")
+		return
+	case action.authorID != m.Author.ID:
+		bot.session.ChannelMessageSend(m.ChannelID, "Only the user who issued the command can confirm it")
+		return
+	}
+
+	log.Printf("[DiscordBot] %s confirmed: %s", m.Author.Username, action.description)
+
+	result, err := action.run(ctx)
+	if err != nil {
+		bot.session.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Failed to %s: %v", action.description, err))
+		return
+	}
+	bot.session.ChannelMessageSend(m.ChannelID, result)
+}
@@ -3,10 +3,13 @@ package internal
 import (
 	"fmt"
 	"log"
+	"sync"
 	"time"
+	"context"
 	"strconv"
 	"strings"
 
+	"nrmodule/metrics"
 	"nrmodule/atserial"
 	"nrmodule/smsmanager"
 
@@ -21,6 +24,20 @@ type DiscordBot struct {
 	smsManager *smsmanager.Manager
 
 	commandPrefix string
+
+	pendingMu sync.Mutex
+	pending   map[string]*pendingAction
+
+	lockGuard *atserial.CellLockGuard
+
+	history *metrics.Store
+
+	// ctx ends with the bot; every command runs under a child that is also
+	// cancelled when its message is deleted
+	ctx       context.Context
+	cancel    context.CancelFunc
+	commandMu sync.Mutex
+	commands  map[string]context.CancelFunc
 }
 
 func (bot *DiscordBot) OnNewSMS(sms atserial.NRModuleSMS) {
@@ -36,12 +53,56 @@ func (bot *DiscordBot) OnNewSMS(sms atserial.NRModuleSMS) {
 		},
 	}
 
+	if sms.Concat != nil {
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{
+			Name: "Parts", Value: formatSMSParts(sms.Parts, sms.Concat.Total), Inline: true,
+		})
+	}
+
 	_, err := bot.session.ChannelMessageSendEmbed(bot.channelID, embed)
 	if err != nil {
 		log.Println("[DiscordBot] send new sms failed,", err)
 	}
 }
 
+func (bot *DiscordBot) OnDeliveryReport(report smsmanager.DeliveryReport) {
+
+	color := 0xffcc00
+	switch {
+	case report.Status.Delivered():
+		color = 0x00ff00
+	case report.Status.Final():
+		color = 0xff0000
+	}
+
+	embed := &discordgo.MessageEmbed{
+		Title:       "SMS Delivery Report",
+		Color:       color,
+		Timestamp:   report.DischargeTime.Format(time.RFC3339),
+		Description: fmt.Sprintf(" Recipient: %s\n Status: %s", report.Recipient, report.Status),
+		Fields: []*discordgo.MessageEmbedField{
+			{Name: "Reference", Value: strconv.Itoa(report.Reference), Inline: true},
+		},
+	}
+
+	if report.OutboxID != 0 {
+		embed.Fields = append(embed.Fields,
+			&discordgo.MessageEmbedField{Name: "Outbox ID", Value: strconv.FormatInt(report.OutboxID, 10), Inline: true},
+			&discordgo.MessageEmbedField{Name: "Segment", Value: fmt.Sprintf("%d/%d", report.Seq, report.Segments), Inline: true},
+			&discordgo.MessageEmbedField{Name: "Outbox Status", Value: report.OutboxStatus, Inline: true},
+		)
+	} else {
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{
+			Name: "Outbox ID", Value: "no matching sent SMS", Inline: true,
+		})
+	}
+
+	_, err := bot.session.ChannelMessageSendEmbed(bot.channelID, embed)
+	if err != nil {
+		log.Println("[DiscordBot] send delivery report failed,", err)
+	}
+}
+
 func (bot *DiscordBot) sendSMSRecord(m *discordgo.MessageCreate, record *smsmanager.SMSRecord) {
 	
 	embed := &discordgo.MessageEmbed{
@@ -55,10 +116,30 @@ func (bot *DiscordBot) sendSMSRecord(m *discordgo.MessageCreate, record *smsmana
 			{Name: "Warehousing Time", Value: record.CreatAt.Format("2006-01-02 15:04:05"), Inline: true},
 		},
 	}
+
+	if len(record.Parts) > 0 {
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{
+			Name: "Parts", Value: formatSMSParts(record.Parts, 0), Inline: true,
+		})
+	}
 	
 	_, _ = bot.session.ChannelMessageSendEmbed(m.ChannelID, embed)
 }
 
+func formatSMSParts(parts []atserial.SMSPart, total int) string {
+
+	if total == 0 {
+		total = len(parts)
+	}
+
+	indices := make([]string, 0, len(parts))
+	for _, part := range parts {
+		indices = append(indices, fmt.Sprintf("#%d@%d", part.Seq, part.Indices))
+	}
+
+	return fmt.Sprintf("%d/%d (%s)", len(parts), total, strings.Join(indices, ", "))
+}
+
 func (bot *DiscordBot) sendSMSRecordList(m *discordgo.MessageCreate, records []*smsmanager.SMSRecord, start int64, end int64) {
 
 	if len(records) == 0 {
@@ -92,6 +173,106 @@ func (bot *DiscordBot) sendSMSRecordList(m *discordgo.MessageCreate, records []*
 	}
 }
 
+func (bot *DiscordBot) sendOutboxRecord(m *discordgo.MessageCreate, record *smsmanager.OutboxRecord) {
+
+	embed := &discordgo.MessageEmbed{
+		Title:       fmt.Sprintf("Outbox Details [ID: %d]", record.ID),
+		Color:       0x9966ff,
+		Description: fmt.Sprintf(" Recipient: %s\n Content: %s", record.Recipient, record.Text),
+		Fields: []*discordgo.MessageEmbedField{
+			{Name: "Status", Value: record.Status, Inline: true},
+			{Name: "Attempts", Value: strconv.Itoa(record.Attempts), Inline: true},
+			{Name: "Queued Time", Value: record.CreatedAt.Format("2006-01-02 15:04:05"), Inline: true},
+		},
+	}
+
+	if record.SentAt != nil {
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{
+			Name: "Sent Time", Value: record.SentAt.Format("2006-01-02 15:04:05"), Inline: true,
+		})
+	}
+	if record.Status == smsmanager.OutboxQueued && record.Attempts > 0 {
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{
+			Name: "Next Attempt", Value: record.NextAttempt.Format("2006-01-02 15:04:05"), Inline: true,
+		})
+	}
+	if record.LastError != "" {
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{
+			Name: "Last Error", Value: record.LastError, Inline: false,
+		})
+	}
+	if len(record.Parts) > 0 {
+		parts := make([]string, 0, len(record.Parts))
+		for _, part := range record.Parts {
+			line := fmt.Sprintf("#%d ref %d %s", part.Seq, part.Reference, part.Status)
+			if part.DeliveredAt != nil {
+				line += " at " + part.DeliveredAt.Format("2006-01-02 15:04:05")
+			}
+			parts = append(parts, line)
+		}
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{
+			Name: fmt.Sprintf("Segments (%s)", record.Encoding), Value: strings.Join(parts, "\n"), Inline: false,
+		})
+	}
+
+	_, _ = bot.session.ChannelMessageSendEmbed(m.ChannelID, embed)
+}
+
+func (bot *DiscordBot) sendOutboxList(m *discordgo.MessageCreate, records []*smsmanager.OutboxRecord) {
+
+	if len(records) == 0 {
+		bot.session.ChannelMessageSend(m.ChannelID, "Outbox is empty")
+		return
+	}
+
+	embed := &discordgo.MessageEmbed{
+		Title: fmt.Sprintf("Recent Outbox (Total: %d)", len(records)),
+		Color: 0x9966ff,
+	}
+
+	for _, record := range records {
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{
+			Name: fmt.Sprintf("ID: %d | To: %s | %s", record.ID, record.Recipient, record.Status),
+			Value: fmt.Sprintf("Content: %s\nQueued: %s, Attempts: %d", record.Text,
+				record.CreatedAt.Format("01-02 15:04"), record.Attempts),
+			Inline: false,
+		})
+	}
+
+	_, _ = bot.session.ChannelMessageSendEmbed(m.ChannelID, embed)
+}
+
+func (bot *DiscordBot) sendNeighbourCells(ctx context.Context, m *discordgo.MessageCreate) {
+
+	cells, err := bot.nri.FetchNeighbourCellsContext(ctx)
+	if err != nil {
+		bot.session.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Information retrieval failed: %v", err))
+		return
+	}
+	if len(cells) == 0 {
+		bot.session.ChannelMessageSend(m.ChannelID, "No neighbour cells reported")
+		return
+	}
+
+	var table strings.Builder
+	table.WriteString("```\nRAT  Scope  ARFCN    PCI   RSRP  RSRQ  SINR\n")
+	for _, cell := range cells {
+		scope := cell.Scope
+		if scope == "" {
+			scope = "-"
+		}
+		table.WriteString(fmt.Sprintf("%-4s %-6s %-8d %-5d %-5d %-5d %d\n",
+			cell.RAT, scope, cell.ARFCN, cell.PCI, cell.RSRP, cell.RSRQ, cell.SINR))
+	}
+	table.WriteString("```")
+
+	_, _ = bot.session.ChannelMessageSendEmbed(m.ChannelID, &discordgo.MessageEmbed{
+		Title:       fmt.Sprintf("Neighbour Cells (Total: %d)", len(cells)),
+		Color:       0x0099ff,
+		Description: table.String(),
+	})
+}
+
 func (bot *DiscordBot) formatInfoEmbed(infoType string, data map[string]interface{}) *discordgo.MessageEmbed {
 
 	fields := make([]*discordgo.MessageEmbedField, 0, len(data))
@@ -112,7 +293,7 @@ func (bot *DiscordBot) formatInfoEmbed(infoType string, data map[string]interfac
 
 func (bot *DiscordBot) handleMessage(s *discordgo.Session, m *discordgo.MessageCreate) {
 
-	help := "*List of Available Commands*\n**Information Query:**\n!info module - Query module information\n!info network - Query network information\n!info signal - Query signal information\n!info <key> - Query specific information (e.g., ModuleName)\n**SMS Operations:**\n!sms send <phone number> <content> - Send an SMS message\n!sms count - Query the total number of SMS messages\n!sms get <DBID> - Query SMS messages with a specific ID\n!sms list <DBID_start> <DBID_end> - Query SMS messages within a range of IDs\n**Other:**\n!help - Display this help information\n!check - Send new SMS detection trigger signal"
+	help := "*List of Available Commands*\n**Information Query:**\n!info module - Query module information\n!info network - Query network information\n!info signal - Query signal information\n!info neighbours - List neighbour cells by RSRP\n!info <key> - Query specific information (e.g., ModuleName)\n!info keys - List the keys with their descriptions\n**SMS Operations:**\n!sms send <phone number> <content> - Queue an SMS message for sending\n!sms outbox [ID] - Query the state of queued SMS messages\n!sms count - Query the total number of SMS messages\n!sms get <DBID> - Query SMS messages with a specific ID\n!sms list <DBID_start> <DBID_end> - Query SMS messages within a range of IDs\n**Radio Configuration (needs !confirm):**\n!radio - Show band locks and RAT preference\n!radio band <lte|nsa|sa> <b1:b2|all> - Lock or unlock bands\n!radio mode <AUTO|LTE|NR5G|LTE:NR5G> - Set RAT preference\n!radio nr5g-disable <none|sa|nsa> - Disable NR5G SA or NSA\n!radio lock - Show cell locks\n!radio lock 4g <EARFCN> <PCI> [<EARFCN> <PCI> ...] - Lock LTE cells\n!radio lock 5g <PCI> <ARFCN> <SCS kHz> <band> - Lock an NR cell\n!radio unlock <4g|5g> - Clear a cell lock\n!confirm <token> - Run a pending radio command\n**Network Scan:**\n!scan [cops|qscan] - Scan operators or cells in the background, results are posted when done\n!scan status - Show the running or last scan\n**History:**\n!history <signal|cells|temp|traffic> [24h|7d] - Summarize the recorded metrics of a window\n**Other:**\n!help - Display this help information\n!check - Send new SMS detection trigger signal"
 
 	if m.Author.ID == s.State.User.ID {
 		return
@@ -135,10 +316,13 @@ func (bot *DiscordBot) handleMessage(s *discordgo.Session, m *discordgo.MessageC
 
 	command := strings.ToLower(args[0])
 
+	ctx := bot.startCommand(m.ID)
+	defer bot.finishCommand(m.ID)
+
 	switch command {
 
 	case "info":
-		bot.processInfoCmd(s, m, args[1:])
+		bot.processInfoCmd(ctx, s, m, args[1:])
 
 	case "check":
 		checkingMsg, _ := s.ChannelMessageSend(m.ChannelID, "Manual check trigger signal sent, checking in progress")
@@ -151,6 +335,18 @@ func (bot *DiscordBot) handleMessage(s *discordgo.Session, m *discordgo.MessageC
 	case "sms":
 		bot.processSMSCmd(s, m, args[1:])
 
+	case "radio":
+		bot.processRadioCmd(ctx, m, args[1:])
+
+	case "confirm":
+		bot.processConfirmCmd(ctx, m, args[1:])
+
+	case "scan":
+		bot.processScanCmd(m, args[1:])
+
+	case "history":
+		bot.processHistoryCmd(m, args[1:])
+
 	case "help":
 		s.ChannelMessageSend(m.ChannelID, help)
 		
@@ -161,59 +357,119 @@ func (bot *DiscordBot) handleMessage(s *discordgo.Session, m *discordgo.MessageC
 	return
 }
 
-func (bot *DiscordBot) processInfoCmd(s *discordgo.Session, m *discordgo.MessageCreate, args []string) {
+// startCommand returns the context of the command sent in message id.
+func (bot *DiscordBot) startCommand(id string) context.Context {
+
+	ctx, cancel := context.WithCancel(bot.ctx)
+
+	bot.commandMu.Lock()
+	bot.commands[id] = cancel
+	bot.commandMu.Unlock()
+
+	return ctx
+}
+
+func (bot *DiscordBot) finishCommand(id string) {
+
+	bot.commandMu.Lock()
+	cancel, ok := bot.commands[id]
+	delete(bot.commands, id)
+	bot.commandMu.Unlock()
+
+	if ok {
+		cancel()
+	}
+}
+
+// handleMessageDelete abandons a command whose message was deleted, so its
+// queued AT commands don't hold up the serial port.
+func (bot *DiscordBot) handleMessageDelete(s *discordgo.Session, m *discordgo.MessageDelete) {
+
+	bot.commandMu.Lock()
+	cancel, ok := bot.commands[m.ID]
+	bot.commandMu.Unlock()
+
+	if ok {
+		log.Println("[DiscordBot] command message", m.ID, "deleted, cancelling")
+		cancel()
+	}
+}
+
+func (bot *DiscordBot) processInfoCmd(ctx context.Context, s *discordgo.Session, m *discordgo.MessageCreate, args []string) {
 	
 	if len(args) == 0 {
-		bot.session.ChannelMessageSend(m.ChannelID, "Please specify the information type: module, network, signal")
+		bot.session.ChannelMessageSend(m.ChannelID, "Please specify the information type: module, network, signal, keys")
 		return
 	}
 
 	infoType := strings.ToLower(args[0])
-	var result map[string]interface{}
+	var embed *discordgo.MessageEmbed
 	var err error
 
 	switch infoType {
 
 	case "module":
-		result, err = bot.nri.FetchModuleInfo()
+		var info *atserial.ModuleInfo
+		if info, err = bot.nri.FetchModuleInfoContext(ctx); err == nil {
+			embed = moduleInfoEmbed(info)
+		}
 
 	case "network":
-		result, err = bot.nri.FetchNetworkInfo()
+		var info *atserial.NetworkInfo
+		if info, err = bot.nri.FetchNetworkInfoContext(ctx); err == nil {
+			embed = networkInfoEmbed(info)
+		}
 
-	case "signal":
-		networkMode, _ := bot.nri.GetInfo("NetworkMode")
-		networkModeStr, ok := networkMode.(string)
+	case "neighbours", "neighbors":
+		bot.sendNeighbourCells(ctx, m)
+		return
 
-		if ok {
-			if strings.Contains(networkMode.(string), "NR") || strings.Contains(networkMode.(string), "LTE") {
-				result, err = bot.nri.FetchSignalInfo(networkModeStr)
-			} else {
-				err = fmt.Errorf("Unrecognized network mode")
-			}
-		} else {
-			err = fmt.Errorf("Unable to obtain network mode")
+	case "keys":
+		embed = infoKeysEmbed(bot.nri.ListInfo())
+
+	case "signal":
+		var info *atserial.SignalInfo
+		if info, err = bot.nri.FetchSignalInfoContext(ctx); err == nil {
+			embed = signalInfoEmbed(info)
 		}
 		
 	default:
 		var info interface{}
-		info, err = bot.nri.GetInfo(args[0])
-		if err == nil {
-			result = map[string]interface{}{args[0]: info}
+		if info, err = bot.nri.GetInfoContext(ctx, args[0]); err == nil {
+			if meta, ok := bot.nri.InfoMetadata(args[0]); ok && meta.Unit != "" {
+				info = fmt.Sprintf("%v %s", info, meta.Unit)
+			}
+			embed = bot.formatInfoEmbed(infoType, map[string]interface{}{args[0]: info})
 		}
 	}
 
+	if ctx.Err() != nil {
+		log.Println("[DiscordBot] info command abandoned,", ctx.Err())
+		return
+	}
 	if err != nil {
 		bot.session.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Information retrieval failed: %v", err))
 		return
 	}
 
-	bot.session.ChannelMessageSendEmbed(m.ChannelID, bot.formatInfoEmbed(infoType, result))
+	bot.session.ChannelMessageSendEmbed(m.ChannelID, embed)
+}
+
+// smsSendContent returns everything after the phone number as typed, so line
+// breaks and repeated spaces survive into the message.
+func smsSendContent(content string, phone string) string {
+
+	idx := strings.Index(content, phone)
+	if idx < 0 {
+		return ""
+	}
+	return strings.TrimSpace(content[idx+len(phone):])
 }
 
 func (bot *DiscordBot) processSMSCmd(s *discordgo.Session, m *discordgo.MessageCreate, args []string) {
 
 	if len(args) == 0 {
-		bot.session.ChannelMessageSend(m.ChannelID, "Please specify the subcommand type: send, count, get, list")
+		bot.session.ChannelMessageSend(m.ChannelID, "Please specify the subcommand type: send, outbox, count, get, list")
 		return
 	}
 
@@ -227,12 +483,34 @@ func (bot *DiscordBot) processSMSCmd(s *discordgo.Session, m *discordgo.MessageC
 			return
 		}
 		phone := args[1]
-		msg := strings.Join(args[2:], " ")
-		err := bot.nri.SendRawSMS(phone, msg)
+		msg := smsSendContent(m.Content, phone)
+		id, err := bot.smsManager.EnqueueSMS(phone, msg)
+		if err != nil {
+			bot.session.ChannelMessageSend(m.ChannelID, fmt.Sprintf("SMS Failed To Queue: %v", err))
+		} else {
+			bot.session.ChannelMessageSend(m.ChannelID, fmt.Sprintf("SMS Queued [Outbox ID: %d], check with !sms outbox %d", id, id))
+		}
+
+	case "outbox":
+		if len(args) < 2 {
+			records, err := bot.smsManager.GetRecentOutbox(10)
+			if err != nil {
+				bot.session.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Outbox Failed To Query: %v", err))
+			} else {
+				bot.sendOutboxList(m, records)
+			}
+			return
+		}
+		id, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			bot.session.ChannelMessageSend(m.ChannelID, "Outbox ID Must Be An Integer")
+			return
+		}
+		record, err := bot.smsManager.GetOutboxByID(id)
 		if err != nil {
-			bot.session.ChannelMessageSend(m.ChannelID, fmt.Sprintf("SMS Failed To Send: %v", err))
+			bot.session.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Outbox Failed To Query: %v", err))
 		} else {
-			bot.session.ChannelMessageSend(m.ChannelID, "SMS Sent Successfully")
+			bot.sendOutboxRecord(m, record)
 		}
 
 	case "count":
@@ -283,7 +561,9 @@ func (bot *DiscordBot) processSMSCmd(s *discordgo.Session, m *discordgo.MessageC
 	}
 }
 
-func NewDiscordBot(token string, channelID string, nri *atserial.NRInterface, smsManager *smsmanager.Manager) (*DiscordBot, error) {
+// NewDiscordBot creates the bot. history may be nil when metrics are
+// disabled, !history then says so.
+func NewDiscordBot(token string, channelID string, nri *atserial.NRInterface, smsManager *smsmanager.Manager, lockGuard *atserial.CellLockGuard, history *metrics.Store) (*DiscordBot, error) {
 
 	dg, err := discordgo.New("Bot " + token)
 	if err != nil {
@@ -296,9 +576,15 @@ func NewDiscordBot(token string, channelID string, nri *atserial.NRInterface, sm
 		nri:           nri,
 		smsManager:    smsManager,
 		commandPrefix: "!",
+		pending:       make(map[string]*pendingAction),
+		lockGuard:     lockGuard,
+		history:       history,
+		commands:      make(map[string]context.CancelFunc),
 	}
+	bot.ctx, bot.cancel = context.WithCancel(context.Background())
 
 	dg.AddHandler(bot.handleMessage)
+	dg.AddHandler(bot.handleMessageDelete)
 
 	return bot, nil
 }
@@ -311,11 +597,13 @@ func (bot *DiscordBot) Start() error {
 	}
 	log.Println("[DiscordBot] listening channel", bot.channelID)
 	bot.smsManager.RegisterObserver(bot)
+	bot.lockGuard.OnRevert(bot.onCellLockReverted)
 
 	return nil
 }
 
 func (bot *DiscordBot) Stop() error {
 
+	bot.cancel()
 	return bot.session.Close()
 }
@@ -0,0 +1,210 @@
+package internal
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"time"
+	"strconv"
+	"strings"
+
+	"nrmodule/metrics"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+const defaultHistoryWindow = 24 * time.Hour
+
+type historyMetric struct {
+	name  string
+	title string
+	unit  string
+}
+
+var signalHistory = []historyMetric{
+	{metrics.LTERSRP, "LTE RSRP", "dBm"},
+	{metrics.LTERSRQ, "LTE RSRQ", "dB"},
+	{metrics.LTESINR, "LTE SINR", "dB"},
+	{metrics.NRRSRP, "NR RSRP", "dBm"},
+	{metrics.NRRSRQ, "NR RSRQ", "dB"},
+	{metrics.NRSINR, "NR SINR", "dB"},
+	{metrics.CACarriers, "CA Carriers", ""},
+	{metrics.CABandwidth, "CA Bandwidth", "MHz"},
+}
+
+var tempHistory = []historyMetric{
+	{metrics.CPUTemp, "CPU Temperature", "°C"},
+}
+
+var cellHistory = []historyMetric{
+	{name: metrics.Mode, title: "Mode"},
+	{name: metrics.CellID, title: "Cell ID"},
+	{name: metrics.LTECell, title: "LTE Cell"},
+	{name: metrics.NRCell, title: "NR Cell"},
+	{name: metrics.CABands, title: "CA Bands"},
+}
+
+// parseHistoryWindow accepts Go durations such as 90m or 24h and days such
+// as 7d.
+func parseHistoryWindow(s string) (time.Duration, error) {
+
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n <= 0 {
+			return 0, fmt.Errorf("invalid window %q", s)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+
+	window, err := time.ParseDuration(s)
+	if err != nil || window <= 0 {
+		return 0, fmt.Errorf("invalid window %q", s)
+	}
+	return window, nil
+}
+
+func (bot *DiscordBot) processHistoryCmd(m *discordgo.MessageCreate, args []string) {
+
+	usage := "Usage: !history <signal|cells|temp|traffic> [24h|7d]"
+
+	if bot.history == nil {
+		bot.session.ChannelMessageSend(m.ChannelID, "Metrics history is disabled, set metrics.enabled in the config")
+		return
+	}
+	if len(args) == 0 {
+		bot.session.ChannelMessageSend(m.ChannelID, usage)
+		return
+	}
+
+	window, windowText := defaultHistoryWindow, "24h"
+	if len(args) > 1 {
+		windowText = args[1]
+		var err error
+		if window, err = parseHistoryWindow(strings.ToLower(args[1])); err != nil {
+			bot.session.ChannelMessageSend(m.ChannelID, fmt.Sprintf("%v. %s", err, usage))
+			return
+		}
+	}
+	to := time.Now()
+	from := to.Add(-window)
+
+	var fields []*discordgo.MessageEmbedField
+	var err error
+	switch strings.ToLower(args[0]) {
+	case "signal":
+		fields, err = bot.summaryFields(signalHistory, from, to)
+	case "temp", "temperature":
+		fields, err = bot.summaryFields(tempHistory, from, to)
+	case "cells":
+		fields, err = bot.labelFields(cellHistory, from, to)
+	case "traffic":
+		fields, err = bot.trafficFields(from, to)
+	default:
+		bot.session.ChannelMessageSend(m.ChannelID, usage)
+		return
+	}
+
+	if err != nil {
+		log.Println("[DiscordBot] history query failed,", err)
+		bot.session.ChannelMessageSend(m.ChannelID, fmt.Sprintf("History query failed: %v", err))
+		return
+	}
+
+	embed := &discordgo.MessageEmbed{
+		Title:       fmt.Sprintf("%s History (%s)", strings.ToUpper(args[0]), windowText),
+		Description: fmt.Sprintf("%s - %s", from.Format("2006-01-02 15:04"), to.Format("2006-01-02 15:04")),
+		Color:       0x0099ff,
+		Fields:      fields,
+	}
+	if len(fields) == 0 {
+		embed.Description += "\nNo samples recorded in this window"
+	}
+
+	bot.session.ChannelMessageSendEmbed(m.ChannelID, embed)
+}
+
+func (bot *DiscordBot) summaryFields(list []historyMetric, from time.Time, to time.Time) ([]*discordgo.MessageEmbedField, error) {
+
+	var fields []*discordgo.MessageEmbedField
+	for _, metric := range list {
+		summary, err := bot.history.Summarize(metric.name, from, to)
+		if err != nil {
+			return nil, err
+		}
+		if summary.Samples == 0 {
+			continue
+		}
+		fields = append(fields, &discordgo.MessageEmbedField{
+			Name: metric.title,
+			Value: fmt.Sprintf("min %s / avg %s / max %s %s\n%d samples", formatMetric(summary.Min),
+				formatMetric(summary.Avg), formatMetric(summary.Max), metric.unit, summary.Samples),
+			Inline: true,
+		})
+	}
+	return fields, nil
+}
+
+func (bot *DiscordBot) labelFields(list []historyMetric, from time.Time, to time.Time) ([]*discordgo.MessageEmbedField, error) {
+
+	var fields []*discordgo.MessageEmbedField
+	for _, metric := range list {
+		shares, err := bot.history.LabelShares(metric.name, from, to)
+		if err != nil {
+			return nil, err
+		}
+		if len(shares) == 0 {
+			continue
+		}
+
+		var total int64
+		for _, share := range shares {
+			total += share.Samples
+		}
+		lines := make([]string, 0, 5)
+		for i, share := range shares {
+			if i == 5 {
+				lines = append(lines, fmt.Sprintf("... %d more", len(shares)-i))
+				break
+			}
+			lines = append(lines, fmt.Sprintf("%s: %.0f%%", share.Label, float64(share.Samples)*100/float64(total)))
+		}
+		fields = append(fields, &discordgo.MessageEmbedField{Name: metric.title, Value: strings.Join(lines, "\n")})
+	}
+	return fields, nil
+}
+
+func (bot *DiscordBot) trafficFields(from time.Time, to time.Time) ([]*discordgo.MessageEmbedField, error) {
+
+	var fields []*discordgo.MessageEmbedField
+	for _, metric := range []historyMetric{{metrics.UploadBytes, "Upload", ""}, {metrics.DownloadBytes, "Download", ""}} {
+		summary, err := bot.history.Summarize(metric.name, from, to)
+		if err != nil {
+			return nil, err
+		}
+		if summary.Samples == 0 {
+			continue
+		}
+		increase, err := bot.history.Increase(metric.name, from, to)
+		if err != nil {
+			return nil, err
+		}
+		fields = append(fields, &discordgo.MessageEmbedField{Name: metric.title, Value: formatBytes(increase), Inline: true})
+	}
+	return fields, nil
+}
+
+// formatMetric rounds averages to one decimal.
+func formatMetric(v float64) string {
+	return strconv.FormatFloat(math.Round(v*10)/10, 'f', -1, 64)
+}
+
+func formatBytes(bytes float64) string {
+
+	units := []string{"B", "KiB", "MiB", "GiB", "TiB"}
+	i := 0
+	for bytes >= 1024 && i < len(units)-1 {
+		bytes /= 1024
+		i++
+	}
+	return fmt.Sprintf("%.1f %s", bytes, units[i])
+}
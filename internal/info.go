@@ -0,0 +1,120 @@
+package internal
+
+import (
+	"fmt"
+	"time"
+	"strings"
+
+	"nrmodule/atserial"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func moduleInfoEmbed(info *atserial.ModuleInfo) *discordgo.MessageEmbed {
+
+	sim := "not inserted"
+	if info.SIMInserted {
+		sim = "inserted"
+	}
+
+	return infoEmbed("MODULE Info", info.FetchedAt, info.Errors, []*discordgo.MessageEmbedField{
+		infoField("Module", info.Name),
+		infoField("CPU Temperature", fmt.Sprintf("%d °C", info.CPUTempC)),
+		infoField("SIM", sim),
+		infoField("SIM Slot", fmt.Sprint(info.SIMSlot)),
+	})
+}
+
+func networkInfoEmbed(info *atserial.NetworkInfo) *discordgo.MessageEmbed {
+
+	return infoEmbed("NETWORK Info", info.FetchedAt, info.Errors, []*discordgo.MessageEmbedField{
+		infoField("Mode", info.Mode),
+		infoField("Duplex", info.Duplex),
+		infoField("MCCMNC", info.MCCMNC),
+		infoField("Cell ID", info.CellID),
+		infoField("APN", info.APN),
+		infoField("IPv4", info.IPv4),
+		infoField("IPv6", info.IPv6),
+		infoField("Upload", info.UploadSize()),
+		infoField("Download", info.DownloadSize()),
+	})
+}
+
+func signalInfoEmbed(info *atserial.SignalInfo) *discordgo.MessageEmbed {
+
+	fields := []*discordgo.MessageEmbedField{infoField("Mode", info.Mode)}
+	for _, cell := range []struct {
+		name   string
+		signal *atserial.CellSignal
+	}{{"LTE", info.LTE}, {"NR", info.NR}} {
+		if cell.signal == nil {
+			continue
+		}
+		fields = append(fields,
+			infoField(cell.name+" RSRP", fmt.Sprintf("%d dBm", cell.signal.RSRP)),
+			infoField(cell.name+" RSRQ", fmt.Sprintf("%d dB", cell.signal.RSRQ)),
+			infoField(cell.name+" SINR", fmt.Sprintf("%d dB", cell.signal.SINR)),
+		)
+	}
+	if len(info.Carriers) > 0 {
+		ca := &atserial.CarrierAggregation{Carriers: info.Carriers}
+		fields = append(fields, &discordgo.MessageEmbedField{Name: "Carrier Aggregation", Value: ca.String()})
+	}
+
+	return infoEmbed("SIGNAL Info", info.FetchedAt, info.Errors, fields)
+}
+
+func infoField(name string, value string) *discordgo.MessageEmbedField {
+
+	if value == "" {
+		value = "-"
+	}
+	return &discordgo.MessageEmbedField{Name: name, Value: value, Inline: true}
+}
+
+// infoEmbed lists the fields that could not be fetched below the others.
+func infoEmbed(title string, at time.Time, errs []atserial.FieldError, fields []*discordgo.MessageEmbedField) *discordgo.MessageEmbed {
+
+	if len(errs) > 0 {
+		failed := make([]string, 0, len(errs))
+		for _, fe := range errs {
+			failed = append(failed, fe.String())
+		}
+		fields = append(fields, &discordgo.MessageEmbedField{Name: "Failed", Value: strings.Join(failed, "\n")})
+	}
+
+	return &discordgo.MessageEmbed{
+		Title:     title,
+		Color:     0x0099ff,
+		Timestamp: at.Format(time.RFC3339),
+		Fields:    fields,
+	}
+}
+
+// infoKeysEmbed lists the keys of !info <key> by category.
+func infoKeysEmbed(list []atserial.InfoMetadata) *discordgo.MessageEmbed {
+
+	var fields []*discordgo.MessageEmbedField
+	var lines []string
+	for i, meta := range list {
+		line := fmt.Sprintf("`%s` %s", meta.Key, meta.Description)
+		if meta.Unit != "" {
+			line += fmt.Sprintf(" (%s)", meta.Unit)
+		}
+		if len(meta.RATs) > 0 {
+			line += fmt.Sprintf(" [%s only]", strings.Join(meta.RATs, "/"))
+		}
+		lines = append(lines, line)
+
+		if i == len(list)-1 || list[i+1].Category != meta.Category {
+			fields = append(fields, &discordgo.MessageEmbedField{Name: strings.ToUpper(meta.Category), Value: strings.Join(lines, "\n")})
+			lines = nil
+		}
+	}
+
+	return &discordgo.MessageEmbed{
+		Title:  "Info Keys",
+		Color:  0x0099ff,
+		Fields: fields,
+	}
+}
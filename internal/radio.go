@@ -0,0 +1,287 @@
+package internal
+
+import (
+	"fmt"
+	"log"
+	"context"
+	"strconv"
+	"strings"
+
+	"nrmodule/atserial"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+var radioBandSettings = map[string]string{
+	"lte": atserial.BandLTE,
+	"nsa": atserial.BandNSANR5G,
+	"sa":  atserial.BandNR5G,
+}
+
+var nr5gDisableModes = map[string]atserial.NR5GDisableMode{
+	"none": atserial.NR5GEnableAll,
+	"sa":   atserial.NR5GDisableSA,
+	"nsa":  atserial.NR5GDisableNSA,
+}
+
+const radioUsage = "Usage:\n!radio - Show band and RAT preferences\n!radio band <lte|nsa|sa> <b1:b2:...|all>\n!radio mode <AUTO|LTE|NR5G|LTE:NR5G>\n!radio nr5g-disable <none|sa|nsa>\n!radio lock [4g <EARFCN> <PCI> ...|5g <PCI> <ARFCN> <SCS> <band>]\n!radio unlock <4g|5g>"
+
+func (bot *DiscordBot) processRadioCmd(ctx context.Context, m *discordgo.MessageCreate, args []string) {
+
+	if len(args) == 0 {
+		bot.sendRadioConfig(ctx, m)
+		return
+	}
+
+	switch strings.ToLower(args[0]) {
+
+	case "band":
+		if len(args) != 3 {
+			bot.session.ChannelMessageSend(m.ChannelID, radioUsage)
+			return
+		}
+		setting, ok := radioBandSettings[strings.ToLower(args[1])]
+		if !ok {
+			bot.session.ChannelMessageSend(m.ChannelID, "Band type must be lte, nsa or sa")
+			return
+		}
+
+		if strings.ToLower(args[2]) == "all" {
+			bot.requestConfirmation(m, fmt.Sprintf("enable all supported %s", setting), func(ctx context.Context) (string, error) {
+				if err := bot.nri.ResetBandsContext(ctx, setting); err != nil {
+					return "", err
+				}
+				return fmt.Sprintf("All supported %s enabled", setting), nil
+			})
+			return
+		}
+
+		bands, err := atserial.ParseBandList(args[2])
+		if err != nil {
+			bot.session.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Invalid band list: %v", err))
+			return
+		}
+		bot.requestConfirmation(m, fmt.Sprintf("lock %s to %s", setting, args[2]), func(ctx context.Context) (string, error) {
+			if err := bot.nri.SetBandsContext(ctx, setting, bands); err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("%s locked to %s", setting, args[2]), nil
+		})
+
+	case "mode":
+		if len(args) != 2 {
+			bot.session.ChannelMessageSend(m.ChannelID, radioUsage)
+			return
+		}
+		mode := strings.ToUpper(args[1])
+		bot.requestConfirmation(m, fmt.Sprintf("set mode_pref to %s", mode), func(ctx context.Context) (string, error) {
+			if err := bot.nri.SetModePrefContext(ctx, mode); err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("mode_pref set to %s", mode), nil
+		})
+
+	case "nr5g-disable":
+		if len(args) != 2 {
+			bot.session.ChannelMessageSend(m.ChannelID, radioUsage)
+			return
+		}
+		mode, ok := nr5gDisableModes[strings.ToLower(args[1])]
+		if !ok {
+			bot.session.ChannelMessageSend(m.ChannelID, "nr5g-disable must be none, sa or nsa")
+			return
+		}
+		bot.requestConfirmation(m, fmt.Sprintf("set nr5g_disable_mode to %s", mode), func(ctx context.Context) (string, error) {
+			if err := bot.nri.SetNR5GDisableModeContext(ctx, mode); err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("nr5g_disable_mode set: %s", mode), nil
+		})
+
+	case "lock":
+		bot.processCellLockCmd(ctx, m, args[1:])
+
+	case "unlock":
+		if len(args) != 2 {
+			bot.session.ChannelMessageSend(m.ChannelID, radioUsage)
+			return
+		}
+		target, ok := cellLockTargets[strings.ToLower(args[1])]
+		if !ok {
+			bot.session.ChannelMessageSend(m.ChannelID, "Lock type must be 4g or 5g")
+			return
+		}
+		bot.requestConfirmation(m, fmt.Sprintf("clear the %s lock", target), func(ctx context.Context) (string, error) {
+			var err error
+			if target == atserial.CellLock5G {
+				err = bot.nri.ClearNRCellLockContext(ctx)
+			} else {
+				err = bot.nri.ClearLTECellLockContext(ctx)
+			}
+			if err != nil {
+				return "", err
+			}
+			bot.lockGuard.Release(target)
+			return fmt.Sprintf("%s lock cleared", target), nil
+		})
+
+	default:
+		bot.session.ChannelMessageSend(m.ChannelID, radioUsage)
+	}
+}
+
+var cellLockTargets = map[string]string{
+	"4g": atserial.CellLock4G,
+	"5g": atserial.CellLock5G,
+}
+
+func (bot *DiscordBot) processCellLockCmd(ctx context.Context, m *discordgo.MessageCreate, args []string) {
+
+	if len(args) == 0 {
+		bot.sendCellLocks(ctx, m)
+		return
+	}
+
+	values := make([]int, 0, len(args)-1)
+	for _, arg := range args[1:] {
+		v, err := strconv.Atoi(arg)
+		if err != nil {
+			bot.session.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Invalid number %q", arg))
+			return
+		}
+		values = append(values, v)
+	}
+
+	revert := fmt.Sprintf("it is cleared again if the module stays unregistered for %v", bot.lockGuard.Timeout())
+
+	switch strings.ToLower(args[0]) {
+
+	case "4g":
+		if len(values) == 0 || len(values)%2 != 0 {
+			bot.session.ChannelMessageSend(m.ChannelID, "Usage: !radio lock 4g <EARFCN> <PCI> [<EARFCN> <PCI> ...]")
+			return
+		}
+		var cells []atserial.LTECellLock
+		var names []string
+		for i := 0; i < len(values); i += 2 {
+			cell := atserial.LTECellLock{EARFCN: values[i], PCI: values[i+1]}
+			cells = append(cells, cell)
+			names = append(names, cell.String())
+		}
+		description := fmt.Sprintf("lock LTE to %s (%s)", strings.Join(names, ", "), revert)
+		bot.requestConfirmation(m, description, func(ctx context.Context) (string, error) {
+			if err := bot.nri.SetLTECellLockContext(ctx, cells); err != nil {
+				return "", err
+			}
+			bot.lockGuard.Watch(atserial.CellLock4G)
+			return fmt.Sprintf("LTE locked to %s", strings.Join(names, ", ")), nil
+		})
+
+	case "5g":
+		if len(values) != 4 {
+			bot.session.ChannelMessageSend(m.ChannelID, "Usage: !radio lock 5g <PCI> <ARFCN> <SCS kHz> <band>")
+			return
+		}
+		lock := atserial.NRCellLock{PCI: values[0], ARFCN: values[1], SCSkHz: values[2], Band: values[3]}
+		bot.requestConfirmation(m, fmt.Sprintf("lock NR to %s (%s)", lock, revert), func(ctx context.Context) (string, error) {
+			if err := bot.nri.SetNRCellLockContext(ctx, lock); err != nil {
+				return "", err
+			}
+			bot.lockGuard.Watch(atserial.CellLock5G)
+			return fmt.Sprintf("NR locked to %s", lock), nil
+		})
+
+	default:
+		bot.session.ChannelMessageSend(m.ChannelID, radioUsage)
+	}
+}
+
+func (bot *DiscordBot) sendCellLocks(ctx context.Context, m *discordgo.MessageCreate) {
+
+	lte := "none"
+	if locks, err := bot.nri.GetLTECellLockContext(ctx); err != nil {
+		lte = fmt.Sprintf("error: %v", err)
+	} else if len(locks) > 0 {
+		names := make([]string, len(locks))
+		for i, lock := range locks {
+			names[i] = lock.String()
+		}
+		lte = strings.Join(names, "\n")
+	}
+
+	nr := "none"
+	if lock, err := bot.nri.GetNRCellLockContext(ctx); err != nil {
+		nr = fmt.Sprintf("error: %v", err)
+	} else if lock != nil {
+		nr = lock.String()
+	}
+
+	_, _ = bot.session.ChannelMessageSendEmbed(m.ChannelID, &discordgo.MessageEmbed{
+		Title: "Cell Locks",
+		Color: 0x0099ff,
+		Fields: []*discordgo.MessageEmbedField{
+			{Name: atserial.CellLock4G, Value: lte, Inline: true},
+			{Name: atserial.CellLock5G, Value: nr, Inline: true},
+		},
+	})
+}
+
+func (bot *DiscordBot) onCellLockReverted(target string, err error) {
+
+	msg := fmt.Sprintf("Module stayed unregistered for %v, %s lock was cleared", bot.lockGuard.Timeout(), target)
+	if err != nil {
+		msg = fmt.Sprintf("Module stayed unregistered for %v, clearing the %s lock failed: %v", bot.lockGuard.Timeout(), target, err)
+	}
+
+	if _, sendErr := bot.session.ChannelMessageSend(bot.channelID, msg); sendErr != nil {
+		log.Println("[DiscordBot] send cell lock revert failed,", sendErr)
+	}
+}
+
+func (bot *DiscordBot) sendRadioConfig(ctx context.Context, m *discordgo.MessageCreate) {
+
+	embed := &discordgo.MessageEmbed{
+		Title: "Radio Preferences",
+		Color: 0x0099ff,
+	}
+	addField := func(name string, value string) {
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{Name: name, Value: value, Inline: false})
+	}
+
+	capability, _ := bot.nri.GetUECapabilityBandsContext(ctx)
+
+	for _, setting := range []string{atserial.BandLTE, atserial.BandNSANR5G, atserial.BandNR5G} {
+		bands, err := bot.nri.GetBandsContext(ctx, setting)
+		value := joinBands(bands)
+		if err != nil {
+			value = fmt.Sprintf("error: %v", err)
+		}
+		if supported, ok := capability[setting]; ok {
+			value += "\nsupported: " + joinBands(supported)
+		}
+		addField(setting, value)
+	}
+
+	if mode, err := bot.nri.GetModePrefContext(ctx); err != nil {
+		addField("mode_pref", fmt.Sprintf("error: %v", err))
+	} else {
+		addField("mode_pref", mode)
+	}
+
+	if mode, err := bot.nri.GetNR5GDisableModeContext(ctx); err != nil {
+		addField("nr5g_disable_mode", fmt.Sprintf("error: %v", err))
+	} else {
+		addField("nr5g_disable_mode", mode.String())
+	}
+
+	_, _ = bot.session.ChannelMessageSendEmbed(m.ChannelID, embed)
+}
+
+func joinBands(bands []int) string {
+
+	items := make([]string, len(bands))
+	for i, band := range bands {
+		items[i] = fmt.Sprint(band)
+	}
+	return strings.Join(items, ":")
+}
@@ -0,0 +1,101 @@
+package internal
+
+import (
+	"fmt"
+	"log"
+	"time"
+	"strings"
+
+	"nrmodule/atserial"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+var scanMethods = map[string]string{
+	"cops":  atserial.ScanOperators,
+	"qscan": atserial.ScanCells,
+}
+
+func (bot *DiscordBot) processScanCmd(m *discordgo.MessageCreate, args []string) {
+
+	method := atserial.ScanOperators
+	if len(args) > 0 {
+		if strings.ToLower(args[0]) == "status" {
+			bot.sendScanStatus(m)
+			return
+		}
+		var ok bool
+		if method, ok = scanMethods[strings.ToLower(args[0])]; !ok {
+			bot.session.ChannelMessageSend(m.ChannelID, "Usage: !scan [cops|qscan|status]")
+			return
+		}
+	}
+
+	// the scan outlives the command, only a shutdown stops it
+	err := bot.nri.StartNetworkScanContext(bot.ctx, method, func(scan atserial.NetworkScan) {
+		if _, sendErr := bot.session.ChannelMessageSendEmbed(m.ChannelID, formatScanEmbed(scan)); sendErr != nil {
+			log.Println("[DiscordBot] send scan result failed,", sendErr)
+		}
+	})
+	if err != nil {
+		bot.session.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Scan not started: %v", err))
+		return
+	}
+
+	bot.session.ChannelMessageSend(m.ChannelID, "Network scan started, this can take a few minutes. Results will be posted here.")
+}
+
+func (bot *DiscordBot) sendScanStatus(m *discordgo.MessageCreate) {
+
+	scan, ok := bot.nri.NetworkScanStatus()
+	if !ok {
+		bot.session.ChannelMessageSend(m.ChannelID, "No network scan has been run")
+		return
+	}
+	if scan.Running() {
+		bot.session.ChannelMessageSend(m.ChannelID, fmt.Sprintf("%s scan running for %v (attempt %d)",
+			scan.Method, time.Since(scan.Started).Round(time.Second), scan.Attempts))
+		return
+	}
+
+	_, _ = bot.session.ChannelMessageSendEmbed(m.ChannelID, formatScanEmbed(scan))
+}
+
+func formatScanEmbed(scan atserial.NetworkScan) *discordgo.MessageEmbed {
+
+	embed := &discordgo.MessageEmbed{
+		Title: fmt.Sprintf("Network Scan (%s)", scan.Method),
+		Color: 0x0099ff,
+		Footer: &discordgo.MessageEmbedFooter{
+			Text: fmt.Sprintf("Finished %s after %v, %d attempt(s)", scan.Finished.Format("2006-01-02 15:04:05"),
+				scan.Finished.Sub(scan.Started).Round(time.Second), scan.Attempts),
+		},
+	}
+
+	if scan.Err != nil {
+		embed.Color = 0xff0000
+		embed.Description = fmt.Sprintf("Scan failed: %v", scan.Err)
+		return embed
+	}
+	if len(scan.Results) == 0 {
+		embed.Description = "Nothing found"
+		return embed
+	}
+
+	var table strings.Builder
+	if scan.Method == atserial.ScanOperators {
+		table.WriteString("```\nStatus     MCCMNC  RAT        Operator\n")
+		for _, r := range scan.Results {
+			table.WriteString(fmt.Sprintf("%-10s %-7s %-10s %s\n", r.Status, r.MCCMNC, r.RAT, r.Operator))
+		}
+	} else {
+		table.WriteString("```\nRAT   MCCMNC  ARFCN    PCI   RSRP  RSRQ\n")
+		for _, r := range scan.Results {
+			table.WriteString(fmt.Sprintf("%-5s %-7s %-8d %-5d %-5d %d\n", r.RAT, r.MCCMNC, r.ARFCN, r.PCI, r.RSRP, r.RSRQ))
+		}
+	}
+	table.WriteString("```")
+	embed.Description = table.String()
+
+	return embed
+}
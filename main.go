@@ -2,31 +2,58 @@ package main
 
 import (
 	"os"
+	"fmt"
 	"log"
+	"sort"
 	"syscall"
 	"os/signal"
+	"encoding/json"
 
 	"nrmodule/config"
+	"nrmodule/metrics"
 	"nrmodule/internal"
 	"nrmodule/atserial"
+	"nrmodule/simulator"
 	"nrmodule/smsmanager"
 )
 
 func main() {
 
+	if len(os.Args) > 1 && os.Args[1] == "simulate" {
+		runSimulator()
+		return
+	}
+
+	if len(os.Args) > 2 && os.Args[1] == "replay" {
+		runReplay(os.Args[2])
+		return
+	}
+
 	cfg, err := config.Load("config/config.yaml")
 	if err != nil {
 		log.Fatalf("Failed to load configuration: %v", err)
 	}
 
+	registerCommandPolicies(cfg.Serial.CommandPolicies)
+
+	if len(os.Args) > 1 && os.Args[1] == "serve" {
+		runServer(cfg)
+		return
+	}
+
 	port := atserial.NRInterfacePort{
 		LocalPort:     cfg.Serial.Port,
 		LocalBaudRate: cfg.Serial.BaudRate,
+		RemoteAPI:     cfg.Serial.RemoteAPI,
+		RemoteToken:   cfg.Serial.RemoteToken,
+		CaptureFile:   cfg.Serial.CaptureFile,
 	}
 	nri := atserial.NewNRInterface(port, cfg.Serial.IsLocal)
+	nri.SMSPDUMode = cfg.SMS.PDUMode
+	nri.ChainCommands = cfg.Serial.ChainCommands
 	defer nri.Close()
 
-	smsManager, err := smsmanager.NewManager(nri, cfg.SMS.DBPath, cfg.SMS.CheckInterval)
+	smsManager, err := smsmanager.NewManager(nri, cfg.SMS.DBPath, cfg.SMS.CheckInterval, cfg.SMS.ConcatTimeout)
 	if err != nil {
 		log.Fatalf("Failed to create SMS manager: %v", err)
 	}
@@ -36,7 +63,22 @@ func main() {
 		log.Fatalf("Failed to start SMS manager: %v", err)
 	}
 
-	bot, err := internal.NewDiscordBot(cfg.Discord.BotToken, cfg.Discord.ChannelID, nri, smsManager)
+	lockGuard := atserial.NewCellLockGuard(nri, cfg.Radio.LockRevertAfter)
+	defer lockGuard.Stop()
+
+	var history *metrics.Store
+	if cfg.Metrics.Enabled {
+		sampler, err := metrics.NewSampler(nri, cfg.SMS.DBPath, cfg.Metrics.Interval, cfg.Metrics.RawRetention, cfg.Metrics.Retention)
+		if err != nil {
+			log.Fatalf("Failed to create metrics sampler: %v", err)
+		}
+		defer sampler.Close()
+
+		sampler.Start()
+		history = sampler.Store()
+	}
+
+	bot, err := internal.NewDiscordBot(cfg.Discord.BotToken, cfg.Discord.ChannelID, nri, smsManager, lockGuard, history)
 	if err != nil {
 		log.Fatalf("Failed to create Discord bot: %v", err)
 	}
@@ -46,9 +88,116 @@ func main() {
 	}
 	defer bot.Stop()
 
+	go lockGuard.WatchActive()
+
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
 	<-sigChan
 
 	log.Println("Shutting down...")
 }
+
+func registerCommandPolicies(policies []config.CommandPolicyConfig) {
+
+	for _, p := range policies {
+		atserial.RegisterCommandPolicy(atserial.CommandPolicy{
+			Prefix:       p.Prefix,
+			Final:        p.Final,
+			Prompt:       p.Prompt,
+			MaxDuration:  p.MaxDuration,
+			SilenceLimit: p.SilenceLimit,
+			TTL:          p.TTL,
+			Mutates:      p.Mutates,
+			SetOnly:      p.SetOnly,
+			Preemptible:  p.Preemptible,
+		})
+	}
+}
+
+func runServer(cfg *config.Config) {
+
+	supervisor := atserial.NewSupervisor(cfg.Serial.Port, cfg.Serial.BaudRate)
+	defer supervisor.Stop()
+
+	if cfg.Serial.CaptureFile != "" {
+		recorder, err := atserial.NewCaptureRecorder(cfg.Serial.CaptureFile)
+		if err != nil {
+			log.Fatalf("Failed to open capture file: %v", err)
+		}
+		supervisor.SetRecorder(recorder)
+	}
+
+	server := atserial.NewRemoteServer(cfg.Server.Listen, cfg.Server.Token, supervisor)
+	if err := server.Start(); err != nil {
+		log.Fatalf("Failed to start remote server: %v", err)
+	}
+	defer server.Stop()
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	<-sigChan
+
+	log.Println("Shutting down remote server...")
+}
+
+func runSimulator() {
+
+	modem, err := simulator.NewQuectel()
+	if err != nil {
+		log.Fatalf("Failed to start modem simulator: %v", err)
+	}
+	defer modem.Close()
+
+	log.Println("Simulated modem ready, set serial.port to", modem.Path())
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	<-sigChan
+
+	log.Println("Shutting down modem simulator...")
+}
+
+// runReplay feeds a capture file recorded with serial.capture_file through
+// the info providers and the SMS parser and prints what they make of it.
+func runReplay(path string) {
+
+	transport, err := atserial.OpenReplayTransport(path)
+	if err != nil {
+		log.Fatalf("Failed to load capture: %v", err)
+	}
+
+	nri := atserial.NewNRInterfaceWithTransport(transport)
+	nri.SMSPDUMode = true
+	defer nri.Close()
+
+	keys := nri.GetAllInfoKeys()
+	sort.Strings(keys)
+	for _, key := range keys {
+		value, err := nri.GetInfo(key)
+		if err != nil {
+			fmt.Printf("%-20s error: %v\n", key, err)
+			continue
+		}
+		fmt.Printf("%-20s %v\n", key, value)
+	}
+
+	snapshot, err := nri.FetchSnapshot()
+	if err != nil {
+		fmt.Println("snapshot: error:", err)
+	}
+	if data, err := json.MarshalIndent(snapshot, "", "  "); err == nil {
+		fmt.Println(string(data))
+	}
+
+	messages, err := nri.FetchSMS()
+	if err != nil {
+		fmt.Println("sms: error:", err)
+	}
+	for _, msg := range messages {
+		fmt.Printf("sms %d from %s: %s\n", msg.Indices, msg.Sender, msg.Text)
+	}
+
+	for _, cmd := range transport.Missing() {
+		fmt.Println("not in capture:", cmd)
+	}
+}
@@ -0,0 +1,259 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"nrmodule/atserial"
+)
+
+const (
+	defaultInterval     = time.Minute
+	defaultRawRetention = 48 * time.Hour
+	defaultRetention    = 90 * 24 * time.Hour
+
+	// maintenanceInterval is how often raw samples are downsampled and old
+	// rows pruned
+	maintenanceInterval = time.Hour
+)
+
+// Sampler snapshots the module periodically into a Store. Raw samples are
+// kept for rawRetention, then merged into hourly rows that are kept for
+// retention.
+type Sampler struct {
+	nri   *atserial.NRInterface
+	store *Store
+
+	interval     time.Duration
+	rawRetention time.Duration
+	retention    time.Duration
+
+	mu       sync.Mutex
+	running  bool
+	stopChan chan struct{}
+
+	// ctx is cancelled by Stop so that a snapshot still waiting for the
+	// serial port is dropped
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+func NewSampler(nri *atserial.NRInterface, dbPath string, interval time.Duration, rawRetention time.Duration, retention time.Duration) (*Sampler, error) {
+
+	store, err := NewStore(dbPath)
+	if err != nil {
+		return nil, err
+	}
+
+	if interval <= 0 {
+		interval = defaultInterval
+	}
+	if rawRetention <= 0 {
+		rawRetention = defaultRawRetention
+	}
+	if retention <= 0 {
+		retention = defaultRetention
+	}
+	if retention < rawRetention {
+		retention = rawRetention
+	}
+
+	sampler := &Sampler{
+		nri:          nri,
+		store:        store,
+		interval:     interval,
+		rawRetention: rawRetention,
+		retention:    retention,
+		stopChan:     make(chan struct{}),
+	}
+	sampler.ctx, sampler.cancel = context.WithCancel(context.Background())
+
+	return sampler, nil
+}
+
+// Store returns the store the sampler writes to, for queries.
+func (s *Sampler) Store() *Store {
+	return s.store
+}
+
+func (s *Sampler) Start() {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.running {
+		return
+	}
+	s.running = true
+
+	log.Printf("[MetricsSampler] sampling every %v, raw samples kept %v, hourly %v", s.interval, s.rawRetention, s.retention)
+	go s.loop()
+}
+
+func (s *Sampler) Stop() {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.running {
+		return
+	}
+	close(s.stopChan)
+	s.cancel()
+	s.running = false
+	log.Println("[MetricsSampler] stop sampling")
+}
+
+func (s *Sampler) Close() error {
+
+	s.Stop()
+	return s.store.Close()
+}
+
+func (s *Sampler) loop() {
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	maintenance := time.NewTicker(maintenanceInterval)
+	defer maintenance.Stop()
+
+	s.maintain()
+	s.sample()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.sample()
+
+		case <-maintenance.C:
+			s.maintain()
+
+		case <-s.stopChan:
+			return
+		}
+	}
+}
+
+func (s *Sampler) sample() {
+
+	// a scan gives the port up to every queued request, so sampling during
+	// one would restart it each interval
+	if scan, ok := s.nri.NetworkScanStatus(); ok && scan.Running() {
+		log.Println("[MetricsSampler] network scan running, skip sample")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(s.ctx, s.interval)
+	defer cancel()
+
+	snapshot, err := s.nri.FetchSnapshotContext(ctx)
+	if s.ctx.Err() != nil {
+		return
+	}
+	if err != nil {
+		log.Println("[MetricsSampler] snapshot failed,", err)
+		return
+	}
+
+	samples := snapshotSamples(snapshot)
+	if len(samples) == 0 {
+		return
+	}
+	if err := s.store.Insert(snapshot.FetchedAt, samples); err != nil {
+		log.Println("[MetricsSampler] store samples failed,", err)
+	}
+}
+
+func (s *Sampler) maintain() {
+
+	now := time.Now()
+	if merged, err := s.store.Downsample(now.Add(-s.rawRetention)); err != nil {
+		log.Println("[MetricsSampler]", err)
+	} else if merged > 0 {
+		log.Println("[MetricsSampler] downsampled", merged, "raw samples")
+	}
+	if pruned, err := s.store.Prune(now.Add(-s.retention)); err != nil {
+		log.Println("[MetricsSampler]", err)
+	} else if pruned > 0 {
+		log.Println("[MetricsSampler] pruned", pruned, "old samples")
+	}
+}
+
+// snapshotSamples turns the parts of snapshot that could be read into
+// samples, failed fields are left out.
+func snapshotSamples(snapshot *atserial.DeviceSnapshot) []Sample {
+
+	var samples []Sample
+
+	if module := snapshot.Module; module != nil && !failed(module.Errors, "cpu_temp_c") {
+		samples = append(samples, Sample{Name: CPUTemp, Value: float64(module.CPUTempC)})
+	}
+
+	if network := snapshot.Network; network != nil {
+		if !failed(network.Errors, "upload_bytes") {
+			samples = append(samples,
+				Sample{Name: UploadBytes, Value: float64(network.UploadBytes)},
+				Sample{Name: DownloadBytes, Value: float64(network.DownloadBytes)},
+			)
+		}
+		if network.Mode != "" {
+			samples = append(samples, Sample{Name: Mode, Label: network.Mode})
+		}
+		if network.CellID != "" {
+			samples = append(samples, Sample{Name: CellID, Label: network.CellID})
+		}
+	}
+
+	if signal := snapshot.Signal; signal != nil {
+		if lte := signal.LTE; lte != nil {
+			samples = append(samples,
+				Sample{Name: LTERSRP, Value: float64(lte.RSRP)},
+				Sample{Name: LTERSRQ, Value: float64(lte.RSRQ)},
+				Sample{Name: LTESINR, Value: float64(lte.SINR)},
+				Sample{Name: LTECell, Label: fmt.Sprintf("B%d EARFCN %d PCI %d", lte.Band, lte.ARFCN, lte.PCI)},
+			)
+		}
+		if nr := signal.NR; nr != nil {
+			samples = append(samples,
+				Sample{Name: NRRSRP, Value: float64(nr.RSRP)},
+				Sample{Name: NRRSRQ, Value: float64(nr.RSRQ)},
+				Sample{Name: NRSINR, Value: float64(nr.SINR)},
+				Sample{Name: NRCell, Label: fmt.Sprintf("n%d ARFCN %d PCI %d", nr.Band, nr.ARFCN, nr.PCI)},
+			)
+		}
+		if !failed(signal.Errors, "carriers") && len(signal.Carriers) > 0 {
+			var bandwidth float64
+			bands := make([]string, 0, len(signal.Carriers))
+			for _, cc := range signal.Carriers {
+				bandwidth += cc.BandwidthMHz
+				if cc.RAT == atserial.RATNR {
+					bands = append(bands, fmt.Sprintf("n%d", cc.Band))
+				} else {
+					bands = append(bands, fmt.Sprintf("B%d", cc.Band))
+				}
+			}
+			samples = append(samples,
+				Sample{Name: CACarriers, Value: float64(len(signal.Carriers))},
+				Sample{Name: CABandwidth, Value: bandwidth},
+				Sample{Name: CABands, Label: strings.Join(bands, "+")},
+			)
+		}
+	}
+
+	return samples
+}
+
+func failed(errs []atserial.FieldError, field string) bool {
+
+	for _, fe := range errs {
+		if fe.Field == field {
+			return true
+		}
+	}
+	return false
+}
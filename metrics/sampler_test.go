@@ -0,0 +1,56 @@
+package metrics
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"nrmodule/atserial"
+	"nrmodule/simulator"
+)
+
+func TestSamplerSkipsWhileScanning(t *testing.T) {
+
+	q, nri := simulator.NewReadyInterface(t)
+	q.SetScanDuration(time.Second)
+
+	sampler, err := NewSampler(nri, filepath.Join(t.TempDir(), "metrics.db"), time.Minute, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sampler.Close()
+
+	done := make(chan atserial.NetworkScan, 1)
+	if err := nri.StartNetworkScan(atserial.ScanCells, func(scan atserial.NetworkScan) { done <- scan }); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(200 * time.Millisecond)
+	sampler.sample()
+
+	var scan atserial.NetworkScan
+	select {
+	case scan = <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("scan did not finish")
+	}
+	if scan.Err != nil || scan.Attempts != 1 || len(scan.Results) == 0 {
+		t.Fatalf("got scan %+v", scan)
+	}
+	for _, cmd := range q.Commands() {
+		if strings.HasPrefix(cmd, `AT+QENG="servingcell"`) {
+			t.Fatalf("snapshot sent during the scan: %s", cmd)
+		}
+	}
+
+	// once the scan is done samples are taken again
+	sampler.sample()
+	now := time.Now()
+	summary, err := sampler.Store().Summarize(LTERSRP, now.Add(-time.Minute), now.Add(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary.Samples != 1 || summary.Avg != -95 {
+		t.Fatalf("got summary %+v", summary)
+	}
+}
@@ -0,0 +1,252 @@
+package metrics
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// Metric names written by the sampler. Numeric metrics carry a value, label
+// metrics such as the serving cell a text in label.
+const (
+	CPUTemp       = "cpu_temp"
+	LTERSRP       = "lte_rsrp"
+	LTERSRQ       = "lte_rsrq"
+	LTESINR       = "lte_sinr"
+	NRRSRP        = "nr_rsrp"
+	NRRSRQ        = "nr_rsrq"
+	NRSINR        = "nr_sinr"
+	CACarriers    = "ca_carriers"
+	CABandwidth   = "ca_bandwidth_mhz"
+	UploadBytes   = "upload_bytes"
+	DownloadBytes = "download_bytes"
+
+	Mode    = "mode"
+	CellID  = "cell_id"
+	LTECell = "lte_cell"
+	NRCell  = "nr_cell"
+	CABands = "ca_bands"
+)
+
+// hourResolution is the resolution of downsampled rows in seconds.
+const hourResolution = 3600
+
+// Sample is one value of a metric. Label metrics leave Value at zero.
+type Sample struct {
+	Name  string
+	Value float64
+	Label string
+}
+
+// Summary is the minimum, sample weighted average and maximum of a numeric
+// metric over a window. Samples is zero when nothing was recorded.
+type Summary struct {
+	Name    string
+	Min     float64
+	Avg     float64
+	Max     float64
+	Samples int64
+}
+
+// LabelShare is how many samples of a label metric had Label.
+type LabelShare struct {
+	Label   string
+	Samples int64
+}
+
+// Store keeps samples in the metrics table. Rows have a resolution of 0 for
+// raw samples or hourResolution once downsampled; min, max and samples keep
+// min/avg/max queries exact across both.
+type Store struct {
+	db *sql.DB
+}
+
+func NewStore(dbPath string) (*Store, error) {
+
+	// the table lives next to sms, the SMS manager writes to the same file
+	db, err := sql.Open("sqlite3", dbPath+"?_busy_timeout=5000")
+	if err != nil {
+		return nil, errors.New("database not found")
+	}
+
+	schema := `
+	CREATE TABLE IF NOT EXISTS metrics (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		sampled_at INTEGER NOT NULL,
+		resolution INTEGER NOT NULL DEFAULT 0,
+		name TEXT NOT NULL,
+		label TEXT NOT NULL DEFAULT '',
+		value REAL,
+		min REAL,
+		max REAL,
+		samples INTEGER NOT NULL DEFAULT 1
+	);
+	CREATE INDEX IF NOT EXISTS idx_metrics_name ON metrics(name, sampled_at);
+	CREATE INDEX IF NOT EXISTS idx_metrics_resolution ON metrics(resolution, sampled_at);
+	`
+
+	_, err = db.Exec(schema)
+	if err != nil {
+		db.Close()
+		log.Println(err)
+		return nil, errors.New("database init failed")
+	}
+
+	return &Store{db: db}, nil
+}
+
+// Insert writes the samples of one point in time.
+func (st *Store) Insert(at time.Time, samples []Sample) error {
+
+	tx, err := st.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, s := range samples {
+		var value interface{}
+		if s.Label == "" {
+			value = s.Value
+		}
+		_, err := tx.Exec("INSERT INTO metrics (sampled_at, name, label, value, min, max) VALUES (?, ?, ?, ?, ?, ?)",
+			at.Unix(), s.Name, s.Label, value, value, value)
+		if err != nil {
+			return fmt.Errorf("insert metric %s failed: %w", s.Name, err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// Summarize returns min/avg/max of a numeric metric in [from, to).
+func (st *Store) Summarize(name string, from time.Time, to time.Time) (Summary, error) {
+
+	summary := Summary{Name: name}
+	var min, avg, max sql.NullFloat64
+
+	err := st.db.QueryRow(`
+	SELECT MIN(min), SUM(value * samples) / SUM(samples), MAX(max), COALESCE(SUM(samples), 0)
+	FROM metrics
+	WHERE name = ? AND label = '' AND sampled_at >= ? AND sampled_at < ?
+	`, name, from.Unix(), to.Unix()).Scan(&min, &avg, &max, &summary.Samples)
+	if err != nil {
+		return summary, err
+	}
+
+	summary.Min, summary.Avg, summary.Max = min.Float64, avg.Float64, max.Float64
+	return summary, nil
+}
+
+// Increase sums the growth of a counter such as upload_bytes in [from, to).
+// A drop between samples is taken as a reset of the counter to zero.
+func (st *Store) Increase(name string, from time.Time, to time.Time) (float64, error) {
+
+	rows, err := st.db.Query(`
+	SELECT min, max FROM metrics
+	WHERE name = ? AND label = '' AND sampled_at >= ? AND sampled_at < ?
+	ORDER BY sampled_at
+	`, name, from.Unix(), to.Unix())
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	var total, prev float64
+	first := true
+	for rows.Next() {
+		var min, max float64
+		if err := rows.Scan(&min, &max); err != nil {
+			return 0, err
+		}
+		if !first {
+			if min >= prev {
+				total += min - prev
+			} else {
+				total += min
+			}
+		}
+		total += max - min
+		prev = max
+		first = false
+	}
+
+	return total, rows.Err()
+}
+
+// LabelShares counts the samples per label of a label metric in [from, to),
+// most frequent first.
+func (st *Store) LabelShares(name string, from time.Time, to time.Time) ([]LabelShare, error) {
+
+	rows, err := st.db.Query(`
+	SELECT label, SUM(samples) FROM metrics
+	WHERE name = ? AND label != '' AND sampled_at >= ? AND sampled_at < ?
+	GROUP BY label
+	ORDER BY 2 DESC, label
+	`, name, from.Unix(), to.Unix())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var shares []LabelShare
+	for rows.Next() {
+		var share LabelShare
+		if err := rows.Scan(&share.Label, &share.Samples); err != nil {
+			return nil, err
+		}
+		shares = append(shares, share)
+	}
+
+	return shares, rows.Err()
+}
+
+// Downsample merges the raw samples of the full hours before cutoff into one
+// row per hour, metric and label.
+func (st *Store) Downsample(cutoff time.Time) (int64, error) {
+
+	end := cutoff.Truncate(time.Hour).Unix()
+
+	tx, err := st.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+	INSERT INTO metrics (sampled_at, resolution, name, label, value, min, max, samples)
+	SELECT sampled_at / ? * ?, ?, name, label, SUM(value * samples) / SUM(samples), MIN(min), MAX(max), SUM(samples)
+	FROM metrics
+	WHERE resolution = 0 AND sampled_at < ?
+	GROUP BY sampled_at / ?, name, label
+	`, hourResolution, hourResolution, hourResolution, end, hourResolution)
+	if err != nil {
+		return 0, fmt.Errorf("downsample metrics failed: %w", err)
+	}
+
+	result, err := tx.Exec("DELETE FROM metrics WHERE resolution = 0 AND sampled_at < ?", end)
+	if err != nil {
+		return 0, fmt.Errorf("delete raw metrics failed: %w", err)
+	}
+	merged, _ := result.RowsAffected()
+
+	return merged, tx.Commit()
+}
+
+// Prune deletes all rows before cutoff.
+func (st *Store) Prune(cutoff time.Time) (int64, error) {
+
+	result, err := st.db.Exec("DELETE FROM metrics WHERE sampled_at < ?", cutoff.Unix())
+	if err != nil {
+		return 0, fmt.Errorf("prune metrics failed: %w", err)
+	}
+	return result.RowsAffected()
+}
+
+func (st *Store) Close() error {
+	return st.db.Close()
+}
@@ -0,0 +1,397 @@
+package simulator
+
+import (
+	"io"
+	"os"
+	"log"
+	"sort"
+	"sync"
+	"time"
+	"strings"
+)
+
+// Reply is the answer to one command of a (possibly chained) command line.
+type Reply struct {
+	// Lines are the information lines written before the final result
+	Lines []string
+	// Final is the final result code, "OK" when empty
+	Final string
+	// Delay is waited before the reply is written
+	Delay time.Duration
+	// Noise is written to the port right away, before any line of the
+	// command line is answered
+	Noise string
+	// Abortable lets any character received during Delay abort the
+	// command, which then ends with OK and no lines
+	Abortable bool
+}
+
+func (r Reply) failed() bool {
+	return r.Final != "" && r.Final != "OK"
+}
+
+// HandlerFunc answers a single command such as `AT+CMGR=3`. cmd is given
+// in the case it was received, handlers are looked up case-insensitively.
+type HandlerFunc func(m *Modem, cmd string) Reply
+
+// Canned returns a handler that always answers with lines and OK.
+func Canned(lines ...string) HandlerFunc {
+
+	return func(m *Modem, cmd string) Reply {
+		return Reply{Lines: lines}
+	}
+}
+
+// Fail returns a handler that always answers with the given final result,
+// e.g. "ERROR" or "+CME ERROR: 10".
+func Fail(final string) HandlerFunc {
+
+	return func(m *Modem, cmd string) Reply {
+		return Reply{Final: final}
+	}
+}
+
+// Modem is a scripted AT modem on the master side of a PTY. Point
+// OpenPosixSerial (or serial.port) at Path() to talk to it.
+type Modem struct {
+	master *os.File
+	slave  *os.File
+	path   string
+
+	mu       sync.Mutex
+	writeMu  sync.Mutex
+	handlers map[string]HandlerFunc
+	exact    map[string]HandlerFunc
+	latency  time.Duration
+	commands []string
+
+	sms *smsStore
+
+	// set while waiting for the PDU after a +CMGS prompt
+	awaitingPDU bool
+	// closed by the next received character while an abortable command runs
+	abort chan struct{}
+
+	quit chan struct{}
+	done chan struct{}
+}
+
+// New opens a PTY and starts serving it. Without handlers every command is
+// answered with ERROR; use NewQuectel for a preconfigured modem.
+func New() (*Modem, error) {
+
+	master, slave, path, err := openPTY()
+	if err != nil {
+		return nil, err
+	}
+
+	m := &Modem{
+		master:   master,
+		slave:    slave,
+		path:     path,
+		handlers: make(map[string]HandlerFunc),
+		exact:    make(map[string]HandlerFunc),
+		sms:      newSMSStore(),
+		quit:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go m.serve()
+
+	log.Println("[Simulator] modem listening on", path)
+	return m, nil
+}
+
+func (m *Modem) Path() string {
+	return m.path
+}
+
+// Handle registers h for every command starting with prefix (e.g.
+// `AT+QENG="servingcell"`). The longest matching prefix wins.
+func (m *Modem) Handle(prefix string, h HandlerFunc) {
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.handlers[strings.ToUpper(prefix)] = h
+}
+
+// HandleExact registers h for cmd only, e.g. plain `AT`.
+func (m *Modem) HandleExact(cmd string, h HandlerFunc) {
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.exact[strings.ToUpper(cmd)] = h
+}
+
+// SetLatency delays every reply by d.
+func (m *Modem) SetLatency(d time.Duration) {
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.latency = d
+}
+
+// Commands returns every command line received so far.
+func (m *Modem) Commands() []string {
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return append([]string(nil), m.commands...)
+}
+
+// InjectURC writes unsolicited lines, e.g. `+CMTI: "ME",3`.
+func (m *Modem) InjectURC(lines ...string) {
+
+	m.write(formatLines(lines))
+}
+
+// InjectRaw writes data as is, e.g. line noise or a truncated response.
+func (m *Modem) InjectRaw(data string) {
+	m.write(data)
+}
+
+func (m *Modem) Close() error {
+
+	close(m.quit)
+	m.master.Close()
+	err := m.slave.Close()
+	<-m.done
+
+	return err
+}
+
+func (m *Modem) write(data string) {
+
+	m.writeMu.Lock()
+	defer m.writeMu.Unlock()
+
+	if _, err := m.master.Write([]byte(data)); err != nil {
+		log.Println("[Simulator] write failed:", err)
+	}
+}
+
+func (m *Modem) serve() {
+
+	defer close(m.done)
+
+	buf := make([]byte, 1024)
+	var pending []byte
+
+	for {
+		n, err := m.master.Read(buf)
+		if err != nil {
+			select {
+			case <-m.quit:
+			default:
+				if err != io.EOF {
+					log.Println("[Simulator] read failed:", err)
+				}
+			}
+			return
+		}
+		pending = append(pending, buf[:n]...)
+		pending = m.consume(pending)
+	}
+}
+
+// consume handles every complete command line (or PDU after a +CMGS prompt)
+// in data and returns the unprocessed rest.
+func (m *Modem) consume(data []byte) []byte {
+
+	m.mu.Lock()
+	if m.abort != nil && len(data) > 0 {
+		close(m.abort)
+		m.abort = nil
+		data = data[1:]
+	}
+	m.mu.Unlock()
+
+	for {
+		if m.awaitingPDU {
+			end := strings.IndexAny(string(data), "\x1a\x1b")
+			if end < 0 {
+				return data
+			}
+			pdu, cancelled := string(data[:end]), data[end] == 0x1b
+			data = data[end+1:]
+			m.awaitingPDU = false
+			if !cancelled {
+				m.respond(m.submitSMS(strings.TrimSpace(pdu)), nil)
+			}
+			continue
+		}
+
+		end := strings.IndexByte(string(data), '\r')
+		if end < 0 {
+			return data
+		}
+		line := strings.TrimSpace(string(data[:end]))
+		data = data[end+1:]
+
+		if line != "" {
+			m.execute(line)
+		}
+	}
+}
+
+func (m *Modem) execute(line string) {
+
+	m.mu.Lock()
+	m.commands = append(m.commands, line)
+	m.mu.Unlock()
+
+	if len(line) < 2 || !strings.EqualFold(line[:2], "AT") {
+		m.respond(Reply{Final: "ERROR"}, nil)
+		return
+	}
+
+	var lines []string
+	for _, cmd := range splitCommandLine(line) {
+		if strings.HasPrefix(strings.ToUpper(cmd), "AT+CMGS=") {
+			m.awaitingPDU = true
+			m.write(formatLines(lines) + "\r\n> ")
+			return
+		}
+
+		reply := m.dispatch(cmd)
+		if reply.Noise != "" {
+			m.write(reply.Noise)
+		}
+		if reply.Abortable && reply.Delay > 0 {
+			m.runAbortable(reply, lines)
+			return
+		}
+		if reply.Delay > 0 {
+			time.Sleep(reply.Delay)
+		}
+		lines = append(lines, reply.Lines...)
+		if reply.failed() {
+			m.respond(Reply{Final: reply.Final}, lines)
+			return
+		}
+	}
+
+	m.respond(Reply{}, lines)
+}
+
+// runAbortable answers reply after its delay unless a character arrives
+// first. The rest of the command line is dropped.
+func (m *Modem) runAbortable(reply Reply, lines []string) {
+
+	abort := make(chan struct{})
+	m.mu.Lock()
+	m.abort = abort
+	m.mu.Unlock()
+
+	go func() {
+
+		timer := time.NewTimer(reply.Delay)
+		defer timer.Stop()
+
+		select {
+		case <-abort:
+			m.respond(Reply{}, nil)
+			return
+		case <-timer.C:
+		}
+
+		m.mu.Lock()
+		aborted := m.abort != abort
+		m.abort = nil
+		m.mu.Unlock()
+		if aborted {
+			m.respond(Reply{}, nil)
+			return
+		}
+		m.respond(Reply{Final: reply.Final}, append(lines, reply.Lines...))
+	}()
+}
+
+func (m *Modem) dispatch(cmd string) Reply {
+
+	m.mu.Lock()
+	upper := strings.ToUpper(cmd)
+	if h, ok := m.exact[upper]; ok {
+		m.mu.Unlock()
+		return h(m, cmd)
+	}
+	prefixes := make([]string, 0, len(m.handlers))
+	for prefix := range m.handlers {
+		if strings.HasPrefix(upper, prefix) {
+			prefixes = append(prefixes, prefix)
+		}
+	}
+	sort.Slice(prefixes, func(i, j int) bool { return len(prefixes[i]) > len(prefixes[j]) })
+
+	var h HandlerFunc
+	if len(prefixes) > 0 {
+		h = m.handlers[prefixes[0]]
+	}
+	m.mu.Unlock()
+
+	if h == nil {
+		return Reply{Final: "ERROR"}
+	}
+	return h(m, cmd)
+}
+
+func (m *Modem) respond(reply Reply, lines []string) {
+
+	m.mu.Lock()
+	latency := m.latency
+	m.mu.Unlock()
+
+	if latency > 0 {
+		time.Sleep(latency)
+	}
+
+	final := reply.Final
+	if final == "" {
+		final = "OK"
+	}
+
+	m.write(formatLines(append(lines, reply.Lines...)) + "\r\n" + final + "\r\n")
+}
+
+func formatLines(lines []string) string {
+
+	if len(lines) == 0 {
+		return ""
+	}
+	return "\r\n" + strings.Join(lines, "\r\n") + "\r\n"
+}
+
+// splitCommandLine turns `AT+CMGF=0;+CMGL=4` into `AT+CMGF=0` and
+// `AT+CMGL=4`, leaving semicolons inside quotes alone.
+func splitCommandLine(line string) []string {
+
+	body := line[2:]
+	if body == "" {
+		return []string{"AT"}
+	}
+
+	var cmds []string
+	var cur strings.Builder
+	inQuote := false
+
+	for _, r := range body {
+		switch {
+		case r == '"':
+			inQuote = !inQuote
+			cur.WriteRune(r)
+		case r == ';' && !inQuote:
+			cmds = append(cmds, "AT"+strings.TrimSpace(cur.String()))
+			cur.Reset()
+		default:
+			cur.WriteRune(r)
+		}
+	}
+	if strings.TrimSpace(cur.String()) != "" {
+		cmds = append(cmds, "AT"+strings.TrimSpace(cur.String()))
+	}
+
+	return cmds
+}
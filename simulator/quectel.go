@@ -0,0 +1,197 @@
+package simulator
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Sample +QENG="servingcell" answers of an RM5xx in the different modes.
+const (
+	ServingCellLTE    = `+QENG: "servingcell","NOCONN","LTE","FDD",460,01,5F1A2B3,123,1850,3,5,5,1A2B,-95,-10,-65,12,10,20,40`
+	ServingCellNR5GSA = `+QENG: "servingcell","NOCONN","NR5G-SA","TDD",460,00,1A2B3C4D5,123,1A2B3C,627264,78,12,-85,-11,15,1,-`
+)
+
+// NeighbourCells is a sample +QENG="neighbourcell" answer with LTE intra and
+// inter frequency and NR neighbours.
+var NeighbourCells = []string{
+	`+QENG: "neighbourcell intra","LTE",1850,124,-12,-101,-70,8,30,5,-,-,-`,
+	`+QENG: "neighbourcell intra","LTE",1850,301,-15,-108,-76,2,22,5,-,-,-`,
+	`+QENG: "neighbourcell inter","LTE",100,52,-9,-92,-62,14,40,3,-,-`,
+	`+QENG: "neighbourcell","NR",627264,501,-96,-12,9`,
+}
+
+// CarrierAggregation is a sample +QCAINFO answer for the LTE serving cell with
+// one secondary carrier.
+var CarrierAggregation = []string{
+	`+QCAINFO: "PCC",1850,100,"LTE BAND 3",1,123,-95,-10,-65,12`,
+	`+QCAINFO: "SCC",100,75,"LTE BAND 1",1,52,-99,-12,-68,9,0,-,-`,
+}
+
+// ServingCellENDC is the three line answer while attached to LTE with an NR
+// secondary cell group.
+var ServingCellENDC = []string{
+	`+QENG: "servingcell","NOCONN"`,
+	`+QENG: "LTE","FDD",460,01,5F1A2B3,123,1850,3,5,5,1A2B,-95,-10,-65,12,10,20,40`,
+	`+QENG: "NR5G-NSA",460,01,500,-88,20,-11,627264,78,12,1`,
+}
+
+// Quectel is a Modem preloaded with the commands the daemon, the info
+// providers and the SMS manager use, answered like an RM520N-GL.
+type Quectel struct {
+	*Modem
+
+	mu          sync.Mutex
+	servingCell []string
+	neighbours  []string
+	carriers    []string
+	prefCfg     map[string]string
+	cellLocks   map[string]string
+	registered  bool
+	simInserted bool
+	scanDelay   time.Duration
+	rxBytes     int64
+	txBytes     int64
+}
+
+func NewQuectel() (*Quectel, error) {
+
+	m, err := New()
+	if err != nil {
+		return nil, err
+	}
+
+	q := &Quectel{
+		Modem:       m,
+		servingCell: []string{ServingCellLTE},
+		neighbours:  NeighbourCells,
+		carriers:    CarrierAggregation,
+		prefCfg:     make(map[string]string),
+		cellLocks:   map[string]string{"common/4g": "0", "common/5g": "0"},
+		registered:  true,
+		simInserted: true,
+		scanDelay:   5 * time.Second,
+		rxBytes:     1 << 20,
+		txBytes:     1 << 18,
+	}
+
+	m.HandleExact("AT", Canned())
+	m.HandleExact("ATE0", Canned())
+	m.HandleExact("ATE1", Canned())
+	m.Handle("AT+QURCCFG", Canned())
+	m.HandleExact("ATI", Canned("Quectel", "RM520N-GL", "Revision: RM520NGLAAR03A03M4G"))
+	m.Handle("AT+QTEMP", Canned(`+QTEMP: "modem-ambient-usr","38"`, `+QTEMP: "cpu0-a7-usr","45"`))
+	m.Handle("AT+QUIMSLOT?", Canned("+QUIMSLOT: 1"))
+	m.Handle("AT+CGCONTRDP", Canned(`+CGCONTRDP: 1,5,"cmnet","10.12.34.56.255.255.255.0","","211.138.180.2","211.138.180.3"`))
+	m.Handle(`AT+QMAP="WWAN"`, Canned(`+QMAP: "WWAN",1,1,"IPV4","10.12.34.56"`, `+QMAP: "WWAN",1,1,"IPV6","2409:8a00:1234::1"`))
+	m.Handle("AT+QSPN", Canned(`+QSPN: "CMCC","CMCC","",0,"46000"`))
+	m.Handle("AT+CREG?", q.handleRegistration("+CREG"))
+	m.Handle("AT+CEREG?", q.handleRegistration("+CEREG"))
+	m.Handle("AT+C5GREG?", q.handleRegistration("+C5GREG"))
+	m.Handle("AT+CPIN?", Canned("+CPIN: READY"))
+
+	m.Handle(`AT+QENG="servingcell"`, q.handleServingCell)
+	m.Handle(`AT+QENG="neighbourcell"`, q.handleNeighbourCells)
+	m.Handle("AT+QCAINFO", q.handleCarrierAggregation)
+	m.Handle("AT+QNWPREFCFG=", q.handlePrefCfg)
+	m.Handle("AT+QNWLOCK=", q.handleCellLock)
+	m.Handle("AT+COPS=?", q.handleScan(OperatorScan))
+	m.Handle("AT+QSCAN", q.handleScan(CellScan...))
+	m.Handle("AT+QSIMSTAT?", q.handleSIMStatus)
+	m.Handle("AT+QGDCNT?", q.handleDataCounter("+QGDCNT", 1))
+	m.Handle("AT+QGDNRCNT?", q.handleDataCounter("+QGDNRCNT", 3))
+
+	for setting, value := range defaultPrefCfg {
+		q.prefCfg[setting] = value
+	}
+
+	m.registerSMSHandlers()
+
+	return q, nil
+}
+
+// SetServingCell replaces the +QENG="servingcell" answer, e.g. with
+// ServingCellNR5GSA or ServingCellENDC.
+func (q *Quectel) SetServingCell(lines ...string) {
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.servingCell = lines
+}
+
+// SetNeighbourCells replaces the +QENG="neighbourcell" answer.
+func (q *Quectel) SetNeighbourCells(lines ...string) {
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.neighbours = lines
+}
+
+// SetCarrierAggregation replaces the +QCAINFO answer.
+func (q *Quectel) SetCarrierAggregation(lines ...string) {
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.carriers = lines
+}
+
+func (q *Quectel) SetSIMInserted(inserted bool) {
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.simInserted = inserted
+}
+
+func (q *Quectel) handleServingCell(m *Modem, cmd string) Reply {
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return Reply{Lines: append([]string(nil), q.servingCell...)}
+}
+
+func (q *Quectel) handleNeighbourCells(m *Modem, cmd string) Reply {
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return Reply{Lines: append([]string(nil), q.neighbours...)}
+}
+
+func (q *Quectel) handleCarrierAggregation(m *Modem, cmd string) Reply {
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return Reply{Lines: append([]string(nil), q.carriers...)}
+}
+
+func (q *Quectel) handleSIMStatus(m *Modem, cmd string) Reply {
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.simInserted {
+		return Reply{Lines: []string{"+QSIMSTAT: 0,1"}}
+	}
+	return Reply{Lines: []string{"+QSIMSTAT: 0,0"}}
+}
+
+// handleDataCounter answers with byte counters that grow on every query.
+func (q *Quectel) handleDataCounter(name string, factor int64) HandlerFunc {
+
+	return func(m *Modem, cmd string) Reply {
+
+		q.mu.Lock()
+		defer q.mu.Unlock()
+
+		q.rxBytes += 4096 * factor
+		q.txBytes += 1024 * factor
+
+		return Reply{Lines: []string{fmt.Sprintf("%s: %d,%d", name, q.rxBytes*factor, q.txBytes*factor)}}
+	}
+}
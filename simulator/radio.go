@@ -0,0 +1,142 @@
+package simulator
+
+import (
+	"fmt"
+	"time"
+	"strings"
+)
+
+// ue_capability_band of an RM520N-GL (abridged).
+var capabilityBands = []string{"lte_band", "nsa_nr5g_band", "nr5g_band"}
+
+var defaultPrefCfg = map[string]string{
+	"lte_band":          "1:3:5:7:8:20:28:34:38:39:40:41",
+	"nsa_nr5g_band":     "1:3:28:41:77:78:79",
+	"nr5g_band":         "1:3:28:41:77:78:79",
+	"mode_pref":         "AUTO",
+	"nr5g_disable_mode": "0",
+}
+
+// PrefCfg returns the current AT+QNWPREFCFG value of setting.
+func (q *Quectel) PrefCfg(setting string) string {
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return q.prefCfg[setting]
+}
+
+func (q *Quectel) handlePrefCfg(m *Modem, cmd string) Reply {
+
+	args := commandArgs(cmd)
+	if len(args) == 0 {
+		return Reply{Final: "ERROR"}
+	}
+	setting := strings.ToLower(args[0])
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if setting == "ue_capability_band" {
+		lines := make([]string, 0, len(capabilityBands))
+		for _, name := range capabilityBands {
+			lines = append(lines, fmt.Sprintf("+QNWPREFCFG: \"%s\",%s", name, defaultPrefCfg[name]))
+		}
+		return Reply{Lines: lines}
+	}
+
+	if _, ok := q.prefCfg[setting]; !ok {
+		return Reply{Final: "ERROR"}
+	}
+	if len(args) > 1 {
+		q.prefCfg[setting] = args[1]
+		return Reply{}
+	}
+	return Reply{Lines: []string{fmt.Sprintf("+QNWPREFCFG: \"%s\",%s", setting, q.prefCfg[setting])}}
+}
+
+// OperatorScan is a sample AT+COPS=? answer.
+const OperatorScan = `+COPS: (2,"CHINA MOBILE","CMCC","46000",7),(1,"CHN-UNICOM","UNICOM","46001",7),(3,"CHN-CT","CT","46011",7),(1,"CHINA MOBILE","CMCC","46000",12),,(0,1,2,3,4),(0,1,2)`
+
+// CellScan is a sample AT+QSCAN=3 answer.
+var CellScan = []string{
+	`+QSCAN: "LTE",460,00,1850,123,-95,-10,30,20`,
+	`+QSCAN: "LTE",460,01,100,52,-92,-9,33,22`,
+	`+QSCAN: "NR5G",460,00,627264,501,-88,-11,25,1`,
+}
+
+// SetScanDuration sets how long AT+COPS=? and AT+QSCAN take. Like on the
+// module any character aborts them.
+func (q *Quectel) SetScanDuration(d time.Duration) {
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.scanDelay = d
+}
+
+func (q *Quectel) handleScan(lines ...string) HandlerFunc {
+
+	return func(m *Modem, cmd string) Reply {
+
+		q.mu.Lock()
+		defer q.mu.Unlock()
+
+		return Reply{Lines: lines, Delay: q.scanDelay, Abortable: true}
+	}
+}
+
+// CellLock returns the current AT+QNWLOCK parameters of target, "0" when
+// unlocked.
+func (q *Quectel) CellLock(target string) string {
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return q.cellLocks[target]
+}
+
+// SetRegistered switches the +CREG/+CEREG/+C5GREG answers between registered
+// and searching, e.g. to simulate a cell lock on a cell that is not there.
+func (q *Quectel) SetRegistered(registered bool) {
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.registered = registered
+}
+
+func (q *Quectel) handleRegistration(name string) HandlerFunc {
+
+	return func(m *Modem, cmd string) Reply {
+
+		q.mu.Lock()
+		defer q.mu.Unlock()
+
+		if q.registered {
+			return Reply{Lines: []string{name + ": 0,1"}}
+		}
+		return Reply{Lines: []string{name + ": 0,2"}}
+	}
+}
+
+func (q *Quectel) handleCellLock(m *Modem, cmd string) Reply {
+
+	args := commandArgs(cmd)
+	if len(args) == 0 {
+		return Reply{Final: "ERROR"}
+	}
+	target := strings.ToLower(args[0])
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if _, ok := q.cellLocks[target]; !ok {
+		return Reply{Final: "ERROR"}
+	}
+	if len(args) > 1 {
+		q.cellLocks[target] = strings.Join(args[1:], ",")
+		return Reply{}
+	}
+	return Reply{Lines: []string{fmt.Sprintf("+QNWLOCK: \"%s\",%s", target, q.cellLocks[target])}}
+}
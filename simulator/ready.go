@@ -0,0 +1,39 @@
+package simulator
+
+import (
+	"time"
+	"testing"
+
+	"nrmodule/atserial"
+)
+
+// NewReadyInterface starts a Quectel and connects an NRInterface to it,
+// waiting until the modem answers AT. The test is skipped when no pseudo
+// terminal can be opened; both are closed when the test ends.
+func NewReadyInterface(t testing.TB) (*Quectel, *atserial.NRInterface) {
+
+	t.Helper()
+
+	q, err := NewQuectel()
+	if err != nil {
+		t.Skip("simulator unavailable:", err)
+	}
+	nri := atserial.NewNRInterface(atserial.NRInterfacePort{LocalPort: q.Path(), LocalBaudRate: 115200}, true)
+	t.Cleanup(func() {
+		nri.Close()
+		q.Close()
+	})
+
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		if nri.Health() == nil {
+			if _, err := nri.Execute("AT\r\n", time.Second); err == nil {
+				return q, nri
+			}
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("simulated modem not ready")
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
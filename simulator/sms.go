@@ -0,0 +1,373 @@
+package simulator
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+	"errors"
+	"strconv"
+	"strings"
+	"math/rand"
+	"encoding/hex"
+
+	"nrmodule/atserial"
+)
+
+const (
+	statUnread = 0
+	statRead   = 1
+)
+
+type storedSMS struct {
+	stat int
+	pdu  string
+}
+
+// SentSMS is a message submitted to the simulator through +CMGS.
+type SentSMS struct {
+	Reference int
+	PDU       string
+	Decoded   *atserial.SMSPDU
+	Time      time.Time
+}
+
+type smsStore struct {
+	mu       sync.Mutex
+	messages map[int]*storedSMS
+	capacity int
+	smsc     string
+	sent     []SentSMS
+	nextRef  int
+
+	reportDelay  time.Duration
+	reportStatus atserial.SMSReportStatus
+	reports      bool
+
+	failAfter int
+	failArmed bool
+}
+
+func newSMSStore() *smsStore {
+
+	return &smsStore{
+		messages: make(map[int]*storedSMS),
+		capacity: 255,
+		smsc:     "+8613800100500",
+	}
+}
+
+func (s *smsStore) store(pdu string) (int, error) {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := 0; i < s.capacity; i++ {
+		if _, used := s.messages[i]; !used {
+			s.messages[i] = &storedSMS{stat: statUnread, pdu: pdu}
+			return i, nil
+		}
+	}
+	return 0, errors.New("sms storage full")
+}
+
+func tpduLength(pdu string) int {
+
+	raw, err := hex.DecodeString(pdu)
+	if err != nil || len(raw) == 0 {
+		return 0
+	}
+	return len(raw) - int(raw[0]) - 1
+}
+
+// ReceivePDU stores an SMS-DELIVER (or status report) PDU in ME and
+// announces it with +CMTI.
+func (m *Modem) ReceivePDU(pdu string) (int, error) {
+
+	if _, err := atserial.DecodeSMSPDU(pdu); err != nil {
+		return 0, err
+	}
+
+	index, err := m.sms.store(strings.ToUpper(pdu))
+	if err != nil {
+		return 0, err
+	}
+	m.InjectURC(fmt.Sprintf("+CMTI: \"ME\",%d", index))
+
+	return index, nil
+}
+
+// ReceiveSMS delivers text from sender, split into concatenated parts when
+// it does not fit a single message. It returns the storage indices used.
+func (m *Modem) ReceiveSMS(sender string, text string) ([]int, error) {
+
+	encoding, segments := atserial.SplitSMS(text)
+	ref := byte(rand.Intn(256))
+
+	m.sms.mu.Lock()
+	smsc := m.sms.smsc
+	m.sms.mu.Unlock()
+
+	var indices []int
+	for i, segment := range segments {
+		pdu := &atserial.SMSPDU{
+			SMSC:      atserial.NewSMSAddress(smsc),
+			Address:   atserial.NewSMSAddress(sender),
+			Encoding:  encoding,
+			Text:      segment,
+			Timestamp: time.Now(),
+		}
+		if len(segments) > 1 {
+			pdu.UDH = []atserial.UDHElement{{ID: 0x00, Data: []byte{ref, byte(len(segments)), byte(i + 1)}}}
+		}
+
+		hexPDU, err := pdu.EncodeDeliver()
+		if err != nil {
+			return indices, err
+		}
+		index, err := m.ReceivePDU(hexPDU)
+		if err != nil {
+			return indices, err
+		}
+		indices = append(indices, index)
+	}
+
+	return indices, nil
+}
+
+// SetDeliveryReports makes the simulator answer every submitted message that
+// requests a status report with a +CDSI after delay.
+func (m *Modem) SetDeliveryReports(delay time.Duration, status atserial.SMSReportStatus) {
+
+	m.sms.mu.Lock()
+	defer m.sms.mu.Unlock()
+
+	m.sms.reports = true
+	m.sms.reportDelay = delay
+	m.sms.reportStatus = status
+}
+
+// FailSubmitAfter lets the next n messages go through and answers the one
+// after them with +CMS ERROR: 332, like a network timeout on the module.
+func (m *Modem) FailSubmitAfter(n int) {
+
+	m.sms.mu.Lock()
+	defer m.sms.mu.Unlock()
+
+	m.sms.failAfter = n
+	m.sms.failArmed = true
+}
+
+// Sent returns the messages submitted so far.
+func (m *Modem) Sent() []SentSMS {
+
+	m.sms.mu.Lock()
+	defer m.sms.mu.Unlock()
+
+	return append([]SentSMS(nil), m.sms.sent...)
+}
+
+// Stored returns the number of messages in ME storage.
+func (m *Modem) Stored() int {
+
+	m.sms.mu.Lock()
+	defer m.sms.mu.Unlock()
+
+	return len(m.sms.messages)
+}
+
+func (m *Modem) submitSMS(pdu string) Reply {
+
+	decoded, err := atserial.DecodeSMSPDU(pdu)
+	if err != nil || decoded.Type != atserial.SMSSubmit {
+		return Reply{Final: "+CMS ERROR: 304"}
+	}
+
+	m.sms.mu.Lock()
+	if m.sms.failArmed {
+		if m.sms.failAfter == 0 {
+			m.sms.failArmed = false
+			m.sms.mu.Unlock()
+			return Reply{Final: "+CMS ERROR: 332"}
+		}
+		m.sms.failAfter--
+	}
+	m.sms.nextRef = (m.sms.nextRef + 1) % 256
+	ref := m.sms.nextRef
+	m.sms.sent = append(m.sms.sent, SentSMS{Reference: ref, PDU: pdu, Decoded: decoded, Time: time.Now()})
+	reports, delay, status := m.sms.reports, m.sms.reportDelay, m.sms.reportStatus
+	m.sms.mu.Unlock()
+
+	if reports && decoded.StatusReportRequest {
+		submitted := time.Now()
+		time.AfterFunc(delay, func() {
+			m.deliverReport(ref, decoded.Address, submitted, status)
+		})
+	}
+
+	return Reply{Lines: []string{fmt.Sprintf("+CMGS: %d", ref)}}
+}
+
+func (m *Modem) deliverReport(ref int, recipient atserial.SMSAddress, submitted time.Time, status atserial.SMSReportStatus) {
+
+	report := &atserial.SMSPDU{
+		MessageRef:    ref,
+		Address:       recipient,
+		Timestamp:     submitted,
+		DischargeTime: time.Now(),
+		ReportStatus:  status,
+	}
+
+	hexPDU, err := report.EncodeStatusReport()
+	if err != nil {
+		return
+	}
+
+	index, err := m.sms.store(hexPDU)
+	if err != nil {
+		return
+	}
+	m.InjectURC(fmt.Sprintf("+CDSI: \"ME\",%d", index))
+}
+
+func commandArgs(cmd string) []string {
+
+	idx := strings.IndexAny(cmd, "=?")
+	if idx < 0 || cmd[idx] == '?' {
+		return nil
+	}
+
+	args := strings.Split(cmd[idx+1:], ",")
+	for i := range args {
+		args[i] = strings.Trim(strings.TrimSpace(args[i]), "\"")
+	}
+	return args
+}
+
+func handleCMGL(m *Modem, cmd string) Reply {
+
+	args := commandArgs(cmd)
+	stat := 4
+	if len(args) > 0 && args[0] != "" {
+		n, err := strconv.Atoi(args[0])
+		if err != nil {
+			// text mode listing is not simulated
+			return Reply{Final: "+CMS ERROR: 303"}
+		}
+		stat = n
+	}
+
+	m.sms.mu.Lock()
+	defer m.sms.mu.Unlock()
+
+	indices := make([]int, 0, len(m.sms.messages))
+	for index := range m.sms.messages {
+		indices = append(indices, index)
+	}
+	sort.Ints(indices)
+
+	var lines []string
+	for _, index := range indices {
+		msg := m.sms.messages[index]
+		if stat != 4 && msg.stat != stat {
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("+CMGL: %d,%d,,%d", index, msg.stat, tpduLength(msg.pdu)), msg.pdu)
+		if msg.stat == statUnread {
+			msg.stat = statRead
+		}
+	}
+
+	return Reply{Lines: lines}
+}
+
+func handleCMGR(m *Modem, cmd string) Reply {
+
+	args := commandArgs(cmd)
+	if len(args) < 1 {
+		return Reply{Final: "ERROR"}
+	}
+	index, err := strconv.Atoi(args[0])
+	if err != nil {
+		return Reply{Final: "ERROR"}
+	}
+
+	m.sms.mu.Lock()
+	defer m.sms.mu.Unlock()
+
+	msg, ok := m.sms.messages[index]
+	if !ok {
+		return Reply{Final: "+CMS ERROR: 321"}
+	}
+
+	stat := msg.stat
+	if msg.stat == statUnread {
+		msg.stat = statRead
+	}
+
+	return Reply{Lines: []string{fmt.Sprintf("+CMGR: %d,,%d", stat, tpduLength(msg.pdu)), msg.pdu}}
+}
+
+func handleCMGD(m *Modem, cmd string) Reply {
+
+	args := commandArgs(cmd)
+	if len(args) < 1 {
+		return Reply{Final: "ERROR"}
+	}
+	index, err := strconv.Atoi(args[0])
+	if err != nil {
+		return Reply{Final: "ERROR"}
+	}
+
+	m.sms.mu.Lock()
+	defer m.sms.mu.Unlock()
+
+	if len(args) > 1 && args[1] == "4" {
+		m.sms.messages = make(map[int]*storedSMS)
+		return Reply{}
+	}
+	delete(m.sms.messages, index)
+
+	return Reply{}
+}
+
+func handleCPMS(m *Modem, cmd string) Reply {
+
+	m.sms.mu.Lock()
+	used, capacity := len(m.sms.messages), m.sms.capacity
+	m.sms.mu.Unlock()
+
+	if strings.HasSuffix(cmd, "?") {
+		return Reply{Lines: []string{fmt.Sprintf("+CPMS: \"ME\",%d,%d,\"ME\",%d,%d,\"ME\",%d,%d",
+			used, capacity, used, capacity, used, capacity)}}
+	}
+	return Reply{Lines: []string{fmt.Sprintf("+CPMS: %d,%d,%d,%d,%d,%d", used, capacity, used, capacity, used, capacity)}}
+}
+
+func handleCSCA(m *Modem, cmd string) Reply {
+
+	m.sms.mu.Lock()
+	defer m.sms.mu.Unlock()
+
+	if args := commandArgs(cmd); len(args) > 0 {
+		m.sms.smsc = args[0]
+		return Reply{}
+	}
+	return Reply{Lines: []string{fmt.Sprintf("+CSCA: \"%s\",145", m.sms.smsc)}}
+}
+
+func (m *Modem) registerSMSHandlers() {
+
+	m.Handle("AT+CMGL", handleCMGL)
+	m.Handle("AT+CMGR=", handleCMGR)
+	m.Handle("AT+CMGD=", handleCMGD)
+	m.Handle("AT+CPMS", handleCPMS)
+	m.Handle("AT+CSCA", handleCSCA)
+	m.Handle("AT+CSMS=", Canned("+CSMS: 1,1,1"))
+	m.Handle("AT+CMGF", Canned())
+	m.Handle("AT+CNMI", Canned())
+	m.Handle("AT+CSDH", Canned())
+	m.Handle("AT+CSCS", Canned())
+	m.Handle("AT+CSMP", Canned())
+	m.Handle("AT+CNMA", Canned())
+}
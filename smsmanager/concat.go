@@ -0,0 +1,142 @@
+package smsmanager
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"nrmodule/atserial"
+)
+
+type concatGroup struct {
+	firstSeen time.Time
+	total     int
+	parts     map[int]atserial.NRModuleSMS
+}
+
+// ConcatBuffer holds the parts of multipart messages until every part has
+// arrived or the group times out.
+type ConcatBuffer struct {
+	timeout time.Duration
+	groups  map[string]*concatGroup
+}
+
+func NewConcatBuffer(timeout time.Duration) *ConcatBuffer {
+
+	return &ConcatBuffer{
+		timeout: timeout,
+		groups:  make(map[string]*concatGroup),
+	}
+}
+
+func concatKey(sms atserial.NRModuleSMS) string {
+	return fmt.Sprintf("%s|%d|%d", sms.Sender, sms.Concat.Ref, sms.Concat.Total)
+}
+
+// Add buffers one part and returns the reassembled message once the group is
+// complete. Parts seen again on a later poll simply replace the buffered copy.
+func (cb *ConcatBuffer) Add(sms atserial.NRModuleSMS) *atserial.NRModuleSMS {
+
+	key := concatKey(sms)
+
+	group, exists := cb.groups[key]
+	if !exists {
+		group = &concatGroup{
+			firstSeen: time.Now(),
+			total:     sms.Concat.Total,
+			parts:     make(map[int]atserial.NRModuleSMS),
+		}
+		cb.groups[key] = group
+	}
+	group.parts[sms.Concat.Seq] = sms
+
+	log.Printf("[ConcatBuffer] part %d/%d ref %d from %s buffered (%d received)",
+		sms.Concat.Seq, sms.Concat.Total, sms.Concat.Ref, sms.Sender, len(group.parts))
+
+	if len(group.parts) < group.total {
+		return nil
+	}
+
+	delete(cb.groups, key)
+	merged := mergeConcatParts(group)
+	return &merged
+}
+
+// Expired returns the groups that waited longer than the timeout, merged with
+// placeholders for the missing parts.
+func (cb *ConcatBuffer) Expired(now time.Time) []atserial.NRModuleSMS {
+
+	var expired []atserial.NRModuleSMS
+
+	for key, group := range cb.groups {
+		if now.Sub(group.firstSeen) < cb.timeout {
+			continue
+		}
+		log.Printf("[ConcatBuffer] group %s timed out with %d/%d parts", key, len(group.parts), group.total)
+		expired = append(expired, mergeConcatParts(group))
+		delete(cb.groups, key)
+	}
+
+	return expired
+}
+
+func (cb *ConcatBuffer) Pending() int {
+	return len(cb.groups)
+}
+
+func mergeConcatParts(group *concatGroup) atserial.NRModuleSMS {
+
+	seqs := make([]int, 0, len(group.parts))
+	for seq := range group.parts {
+		seqs = append(seqs, seq)
+	}
+	sort.Ints(seqs)
+
+	first := group.parts[seqs[0]]
+	merged := atserial.NRModuleSMS{
+		Sender:     first.Sender,
+		SenderType: first.SenderType,
+		SMSC:       first.SMSC,
+		Status:     first.Status,
+		Date:       first.Date,
+		Indices:    first.Indices,
+		Concat:     &atserial.SMSConcat{Ref: first.Concat.Ref, Total: group.total},
+	}
+
+	var sb strings.Builder
+	for seq := 1; seq <= group.total; seq++ {
+		part, ok := group.parts[seq]
+		if !ok {
+			sb.WriteString(fmt.Sprintf("[part %d/%d missing]", seq, group.total))
+			continue
+		}
+		sb.WriteString(part.Text)
+		merged.Parts = append(merged.Parts, atserial.SMSPart{
+			Seq:     seq,
+			Indices: part.Indices,
+			Text:    part.Text,
+		})
+		if part.Date.Before(merged.Date) {
+			merged.Date = part.Date
+		}
+	}
+	merged.Text = sb.String()
+
+	return merged
+}
+
+// partIndices lists the module storage indices that make up a message.
+func partIndices(sms atserial.NRModuleSMS) []int {
+
+	if len(sms.Parts) == 0 {
+		return []int{sms.Indices}
+	}
+
+	indices := make([]int, 0, len(sms.Parts))
+	for _, part := range sms.Parts {
+		indices = append(indices, part.Indices)
+	}
+	return indices
+}
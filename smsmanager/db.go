@@ -23,7 +23,9 @@ type SMSDatabase struct {
 
 func NewSMSDatabase(dbPath string) (*SMSDatabase, error) {
 
-	db, err := sql.Open("sqlite3", dbPath)
+	// the metrics store writes to the same file, wait for its lock instead of
+	// failing with SQLITE_BUSY
+	db, err := sql.Open("sqlite3", dbPath+"?_busy_timeout=5000")
 	if err != nil {
 		return nil, errors.New("database not found")
 	}
@@ -40,6 +42,54 @@ func NewSMSDatabase(dbPath string) (*SMSDatabase, error) {
 		UNIQUE(sender, content, received_at)
 	);
 	CREATE INDEX IF NOT EXISTS idx_received_at ON sms(received_at);
+	CREATE TABLE IF NOT EXISTS sms_parts (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		sms_id INTEGER NOT NULL REFERENCES sms(id),
+		seq INTEGER NOT NULL,
+		total INTEGER NOT NULL,
+		ref INTEGER NOT NULL,
+		module_indices INTEGER,
+		content TEXT NOT NULL,
+		UNIQUE(sms_id, seq)
+	);
+	CREATE TABLE IF NOT EXISTS outbox (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		recipient TEXT NOT NULL,
+		content TEXT NOT NULL,
+		status TEXT NOT NULL,
+		attempts INTEGER NOT NULL DEFAULT 0,
+		last_error TEXT NOT NULL DEFAULT '',
+		encoding TEXT NOT NULL DEFAULT '',
+		segments INTEGER NOT NULL DEFAULT 0,
+		concat_ref INTEGER NOT NULL DEFAULT 0,
+		next_attempt_at DATETIME NOT NULL,
+		created_at DATETIME NOT NULL,
+		updated_at DATETIME NOT NULL,
+		sent_at DATETIME
+	);
+	CREATE INDEX IF NOT EXISTS idx_outbox_status ON outbox(status, next_attempt_at);
+	CREATE TABLE IF NOT EXISTS outbox_parts (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		outbox_id INTEGER NOT NULL REFERENCES outbox(id),
+		seq INTEGER NOT NULL,
+		reference INTEGER NOT NULL,
+		status TEXT NOT NULL,
+		delivered_at DATETIME,
+		UNIQUE(outbox_id, seq)
+	);
+	CREATE INDEX IF NOT EXISTS idx_outbox_parts_reference ON outbox_parts(reference);
+	CREATE TABLE IF NOT EXISTS delivery_reports (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		outbox_id INTEGER REFERENCES outbox(id),
+		seq INTEGER,
+		reference INTEGER NOT NULL,
+		recipient TEXT NOT NULL,
+		status INTEGER NOT NULL,
+		status_text TEXT NOT NULL,
+		submitted_at DATETIME,
+		discharged_at DATETIME,
+		received_at DATETIME NOT NULL
+	);
 	`
 
 	_, err = db.Exec(schema)
@@ -101,6 +151,19 @@ func (sdb *SMSDatabase) InsertSMS(sms atserial.NRModuleSMS) (dbID int64, isNew b
         return 0, false, err
     }
 
+    ref, total := 0, len(sms.Parts)
+    if sms.Concat != nil {
+        ref, total = sms.Concat.Ref, sms.Concat.Total
+    }
+
+    for _, part := range sms.Parts {
+        _, err = tx.Exec("INSERT INTO sms_parts (sms_id, seq, total, ref, module_indices, content) VALUES (?, ?, ?, ?, ?, ?)",
+            id, part.Seq, total, ref, part.Indices, part.Text)
+        if err != nil {
+            return 0, false, err
+        }
+    }
+
     err = tx.Commit()
     return id, true, err
 }
@@ -127,9 +190,30 @@ func (sdb *SMSDatabase) GetSMSByID(id int64) (*SMSRecord, error) {
 		return nil, errors.New("sms doesn't exist")
 	}
 
+	record.Parts, err = sdb.GetSMSParts(record.DBID)
 	return &record, err
 }
 
+func (sdb *SMSDatabase) GetSMSParts(smsID int64) ([]atserial.SMSPart, error) {
+
+	rows, err := sdb.db.Query("SELECT seq, module_indices, content FROM sms_parts WHERE sms_id = ? ORDER BY seq ASC", smsID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var parts []atserial.SMSPart
+	for rows.Next() {
+		var part atserial.SMSPart
+		if err := rows.Scan(&part.Seq, &part.Indices, &part.Text); err != nil {
+			return nil, err
+		}
+		parts = append(parts, part)
+	}
+	return parts, rows.Err()
+}
+
+
 func (sdb *SMSDatabase) GetSMSByRange(startID int64, endID int64) ([]*SMSRecord, error) {
 
 	if startID > endID {
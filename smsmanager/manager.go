@@ -1,6 +1,7 @@
 package smsmanager
 
 import (
+	"context"
 	"log"
 	"sync"
 	"time"
@@ -21,15 +22,33 @@ type Manager struct {
 	running  bool
 	stopChan chan struct{}
 	triggerChan chan struct{}
+
+	// ctx is cancelled by Stop so that module requests still waiting for the
+	// serial port are dropped
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	smsEvents    <-chan atserial.URCEvent
+	cancelEvents func()
+
+	concat *ConcatBuffer
+
+	outboxWake chan struct{}
 }
 
-func NewManager(nri *atserial.NRInterface, dbPath string, checkInterval time.Duration) (*Manager, error) {
+const defaultConcatTimeout = 10 * time.Minute
+
+func NewManager(nri *atserial.NRInterface, dbPath string, checkInterval time.Duration, concatTimeout time.Duration) (*Manager, error) {
 
 	db, err := NewSMSDatabase(dbPath)
 	if err != nil {
 		return nil, err
 	}
 
+	if concatTimeout <= 0 {
+		concatTimeout = defaultConcatTimeout
+	}
+
 	manager := &Manager{
 		nri:             nri,
 		db:              db,
@@ -37,7 +56,10 @@ func NewManager(nri *atserial.NRInterface, dbPath string, checkInterval time.Dur
 		checkInterval:   checkInterval,
 		stopChan:        make(chan struct{}),
 		triggerChan:     make(chan struct{}, 1),
+		concat:          NewConcatBuffer(concatTimeout),
+		outboxWake:      make(chan struct{}, 1),
 	}
+	manager.ctx, manager.cancel = context.WithCancel(context.Background())
 
 	return manager, nil
 }
@@ -55,11 +77,14 @@ func (m *Manager) Start() error {
 	}
 
 	m.running = true
+	m.smsEvents, m.cancelEvents = m.nri.SubscribeURC(atserial.URCNewSMS,
+		atserial.URCStatusReportIndex, atserial.URCStatusReport)
 	m.mu.Unlock()
 
-	log.Println("[SMSManager] start listening")
+	log.Println("[SMSManager] start listening, safety poll every", m.checkInterval)
 
 	go m.monitorLoop()
+	go m.outboxLoop()
 	return nil
 }
 
@@ -72,6 +97,11 @@ func (m *Manager) Stop() {
 		return
 	}
 	close(m.stopChan)
+	m.cancel()
+	m.running = false
+	if m.cancelEvents != nil {
+		m.cancelEvents()
+	}
 	log.Println("[SMSManager] stop listening")
 }
 
@@ -89,6 +119,9 @@ func (m *Manager) monitorLoop() {
 	ticker := time.NewTicker(m.checkInterval)
 	defer ticker.Stop()
 
+	concatTicker := time.NewTicker(30 * time.Second)
+	defer concatTicker.Stop()
+
 	m.checkAndProcessSMS()
 
 	for {
@@ -98,6 +131,20 @@ func (m *Manager) monitorLoop() {
 
 		case <-m.triggerChan:
 			m.checkAndProcessSMS()
+
+		case ev, ok := <-m.smsEvents:
+			if !ok {
+				m.smsEvents = nil
+				continue
+			}
+			if ev.Type == atserial.URCNewSMS {
+				m.processNewSMSEvent(ev)
+			} else {
+				m.processStatusReportEvent(ev)
+			}
+
+		case <-concatTicker.C:
+			m.flushExpiredConcat()
 			
 		case <-m.stopChan:
 			log.Println("[SMSManager] exiting the monitor loop")
@@ -120,7 +167,7 @@ func (m *Manager) checkAndProcessSMS() {
 	
 	//log.Println("[SMSManager] checking SMS")
 
-	smsList, err := m.nri.FetchSMS()
+	smsList, err := m.nri.FetchSMSContext(m.ctx)
 	if err != nil {
 		log.Println("[SMSManager] fetch sms failed,", err)
 		return
@@ -136,26 +183,64 @@ func (m *Manager) checkAndProcessSMS() {
 	var indicesToDelete []int
 	newSMSCount := 0
 
-	for _, sms := range smsList {
-
-		dbID, isNew, err := m.db.InsertSMS(sms)
-		if err != nil {
-			log.Println("[SMSManager] insert sms to database failed,", err)
+	for _, part := range smsList {
+		if part.Report != nil {
+			m.handleDeliveryReport(*part.Report)
+			indicesToDelete = append(indicesToDelete, part.Indices)
 			continue
 		}
-		if isNew {
-			log.Println("[SMSManager] new sms", dbID, " from", sms.Sender)
-			m.observerManager.NotifyNewSMS(sms)
-			newSMSCount++
-		} else {
-			log.Println("[SMSManager] existed sms", dbID, " from", sms.Sender)
+		for _, sms := range m.collectSMS(part) {
+
+			isNew, err := m.storeSMS(sms)
+			if err != nil {
+				continue
+			}
+			if isNew {
+				newSMSCount++
+			}
+
+			indicesToDelete = append(indicesToDelete, partIndices(sms)...)
 		}
+	}
+
+	m.deleteIndices(indicesToDelete)
+
+	log.Println("[SMSManager] process complete, sms count:", len(smsList), ", new sms count", newSMSCount,
+		", pending multipart groups", m.concat.Pending())
+}
 
-		indicesToDelete = append(indicesToDelete, sms.Indices)
+// collectSMS routes multipart messages through the concat buffer and returns
+// the logical messages that are ready to be stored.
+func (m *Manager) collectSMS(sms atserial.NRModuleSMS) []atserial.NRModuleSMS {
+
+	if sms.Concat == nil || sms.Concat.Total <= 1 {
+		return []atserial.NRModuleSMS{sms}
 	}
-	
+
+	if merged := m.concat.Add(sms); merged != nil {
+		return []atserial.NRModuleSMS{*merged}
+	}
+	return nil
+}
+
+func (m *Manager) flushExpiredConcat() {
+
+	var indicesToDelete []int
+
+	for _, sms := range m.concat.Expired(time.Now()) {
+		if _, err := m.storeSMS(sms); err != nil {
+			continue
+		}
+		indicesToDelete = append(indicesToDelete, partIndices(sms)...)
+	}
+
+	m.deleteIndices(indicesToDelete)
+}
+
+func (m *Manager) deleteIndices(indicesToDelete []int) {
+
 	if len(indicesToDelete) > 0 && len(indicesToDelete) <= 10 {
-		err := m.nri.DeleteSMS(indicesToDelete)
+		err := m.nri.DeleteSMSContext(m.ctx, indicesToDelete)
 		if err != nil {
 			log.Println("[SMSManager] delete incoming sms failed", err)
 		}
@@ -167,14 +252,78 @@ func (m *Manager) checkAndProcessSMS() {
 			if end > lenDel {
 				end = lenDel
 			}
-			err := m.nri.DeleteSMS(indicesToDelete[i:end])
+			err := m.nri.DeleteSMSContext(m.ctx, indicesToDelete[i:end])
 			if err != nil {
 				log.Println("[SMSManager] delete incoming sms failed", err)
 			}
 		}
 	}
+}
+
+func (m *Manager) processNewSMSEvent(ev atserial.URCEvent) {
+
+	if len(m.observerManager.observers) == 0 {
+		log.Println("[SMSManager] no observer registed, skip new sms event")
+		return
+	}
+
+	storage, index, err := ev.MessageIndex()
+	if err != nil {
+		log.Println("[SMSManager] invalid new sms event,", err)
+		return
+	}
+
+	if storage != "" && storage != "ME" {
+		log.Println("[SMSManager] new sms stored in", storage, "instead of ME, fall back to full check")
+		m.checkAndProcessSMS()
+		return
+	}
+
+	part, err := m.nri.ReadSMSContext(m.ctx, index)
+	if atserial.IsRetryable(err) {
+		// the SIM is often still busy storing the message right after +CMTI
+		log.Println("[SMSManager] read new sms", index, "failed,", err, "retrying")
+		time.Sleep(time.Second)
+		part, err = m.nri.ReadSMSContext(m.ctx, index)
+	}
+	if err != nil {
+		log.Println("[SMSManager] read new sms", index, "failed,", err)
+		return
+	}
+
+	if part.Report != nil {
+		m.handleDeliveryReport(*part.Report)
+		m.deleteIndices([]int{index})
+		return
+	}
+
+	var indicesToDelete []int
+	for _, sms := range m.collectSMS(*part) {
+		if _, err := m.storeSMS(sms); err != nil {
+			continue
+		}
+		indicesToDelete = append(indicesToDelete, partIndices(sms)...)
+	}
+
+	m.deleteIndices(indicesToDelete)
+}
+
+func (m *Manager) storeSMS(sms atserial.NRModuleSMS) (bool, error) {
+
+	dbID, isNew, err := m.db.InsertSMS(sms)
+	if err != nil {
+		log.Println("[SMSManager] insert sms to database failed,", err)
+		return false, err
+	}
+
+	if isNew {
+		log.Println("[SMSManager] new sms", dbID, " from", sms.Sender)
+		m.observerManager.NotifyNewSMS(sms)
+	} else {
+		log.Println("[SMSManager] existed sms", dbID, " from", sms.Sender)
+	}
 
-	log.Println("[SMSManager] process complete, sms count:", len(smsList), ", new sms count", newSMSCount)
+	return isNew, nil
 }
 
 func (m *Manager) Close() error {
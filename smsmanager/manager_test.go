@@ -0,0 +1,188 @@
+package smsmanager
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"nrmodule/atserial"
+	"nrmodule/simulator"
+)
+
+type chanObserver chan atserial.NRModuleSMS
+
+func (c chanObserver) OnNewSMS(sms atserial.NRModuleSMS) {
+	c <- sms
+}
+
+// newSimulatedManager starts a Manager on a simulated RM520N-GL. The safety
+// poll is an hour, so incoming messages are only picked up through +CMTI.
+func newSimulatedManager(t *testing.T) (*simulator.Quectel, *Manager, chanObserver) {
+
+	t.Helper()
+
+	q, nri := simulator.NewReadyInterface(t)
+	nri.SMSPDUMode = true
+
+	manager, err := NewManager(nri, filepath.Join(t.TempDir(), "sms.db"), time.Hour, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	observer := make(chanObserver, 4)
+	manager.RegisterObserver(observer)
+	if err := manager.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		manager.Close()
+	})
+	return q, manager, observer
+}
+
+func TestManagerReceivesMultipartSMS(t *testing.T) {
+
+	q, manager, observer := newSimulatedManager(t)
+
+	text := strings.Repeat("Multipart message over +CMTI. ", 8)
+	if _, err := q.ReceiveSMS("+10086", text); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case sms := <-observer:
+		if sms.Sender != "+10086" || sms.Text != text || len(sms.Parts) != 2 {
+			t.Fatalf("got sms %+v", sms)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("no sms delivered to the observer")
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for q.Stored() != 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d messages left in ME storage", q.Stored())
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	if count, err := manager.GetDBStats(); err != nil || count != 1 {
+		t.Fatalf("got %d stored messages, %v", count, err)
+	}
+
+	select {
+	case sms := <-observer:
+		t.Fatalf("sms delivered twice: %+v", sms)
+	case <-time.After(200 * time.Millisecond):
+	}
+}
+
+func TestManagerSendsMultipartSMS(t *testing.T) {
+
+	q, manager, _ := newSimulatedManager(t)
+
+	text := strings.Repeat("长短信测试", 20)
+	id, err := manager.EnqueueSMS("+8613912345678", text)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var record *OutboxRecord
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		if record, err = manager.GetOutboxByID(id); err != nil {
+			t.Fatal(err)
+		}
+		if record.Status == OutboxSent {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("outbox %d still %s: %s", id, record.Status, record.LastError)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	if record.Encoding != atserial.EncodingUCS2.String() || record.Segments != 2 || len(record.Parts) != 2 {
+		t.Fatalf("got record %+v", record)
+	}
+
+	sent := q.Sent()
+	if len(sent) != 2 {
+		t.Fatalf("simulator got %d messages", len(sent))
+	}
+	var joined string
+	for i, sms := range sent {
+		if record.Parts[i].Reference != sms.Reference {
+			t.Errorf("part %d reference %d, simulator %d", i, record.Parts[i].Reference, sms.Reference)
+		}
+		joined += sms.Decoded.Text
+	}
+	if joined != text {
+		t.Fatalf("got %q", joined)
+	}
+}
+
+func TestManagerResumesPartialMultipartSMS(t *testing.T) {
+
+	q, manager, _ := newSimulatedManager(t)
+	q.FailSubmitAfter(1)
+
+	text := strings.Repeat("0123456789", 40)
+	id, err := manager.EnqueueSMS("+8613912345678", text)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	waitOutbox := func(done func(*OutboxRecord) bool) *OutboxRecord {
+		deadline := time.Now().Add(10 * time.Second)
+		for {
+			record, err := manager.GetOutboxByID(id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if done(record) {
+				return record
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("outbox %d still %s: %+v", id, record.Status, record)
+			}
+			time.Sleep(50 * time.Millisecond)
+		}
+	}
+
+	record := waitOutbox(func(r *OutboxRecord) bool { return r.Attempts == 1 && r.Status == OutboxQueued })
+	if record.Segments != 3 || len(record.Parts) != 1 || record.LastError == "" {
+		t.Fatalf("got record after the failed attempt %+v", record)
+	}
+
+	// make the retry due right away instead of after the backoff
+	if _, err := manager.db.db.Exec("UPDATE outbox SET next_attempt_at = ? WHERE id = ?", time.Now(), id); err != nil {
+		t.Fatal(err)
+	}
+	manager.outboxWake <- struct{}{}
+
+	record = waitOutbox(func(r *OutboxRecord) bool { return r.Status == OutboxSent })
+	if record.Attempts != 2 || len(record.Parts) != 3 {
+		t.Fatalf("got record %+v", record)
+	}
+
+	sent := q.Sent()
+	if len(sent) != 3 {
+		t.Fatalf("simulator got %d messages", len(sent))
+	}
+	var joined string
+	for i, sms := range sent {
+		concat := sms.Decoded.Concat()
+		if concat == nil || concat.Seq != i+1 || concat.Total != 3 || concat.Ref != record.ConcatRef {
+			t.Fatalf("part %d has concat %+v, outbox ref %d", i, concat, record.ConcatRef)
+		}
+		if record.Parts[i].Reference != sms.Reference {
+			t.Errorf("part %d reference %d, simulator %d", i, record.Parts[i].Reference, sms.Reference)
+		}
+		joined += sms.Decoded.Text
+	}
+	if joined != text {
+		t.Fatalf("got %q", joined)
+	}
+}
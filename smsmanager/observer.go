@@ -8,6 +8,12 @@ type SMSToObserver interface {
 	OnNewSMS(sms atserial.NRModuleSMS)
 }
 
+// DeliveryReportObserver is optionally implemented by observers that want to
+// hear about status reports of sent messages.
+type DeliveryReportObserver interface {
+	OnDeliveryReport(report DeliveryReport)
+}
+
 type SMSObserverManager struct {
 	observers []SMSToObserver
 }
@@ -29,3 +35,12 @@ func (om *SMSObserverManager) NotifyNewSMS(sms atserial.NRModuleSMS) {
 		go ob.OnNewSMS(sms)
 	}
 }
+
+func (om *SMSObserverManager) NotifyDeliveryReport(report DeliveryReport) {
+
+	for _, ob := range om.observers {
+		if ro, ok := ob.(DeliveryReportObserver); ok {
+			go ro.OnDeliveryReport(report)
+		}
+	}
+}
@@ -0,0 +1,486 @@
+package smsmanager
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"nrmodule/atserial"
+)
+
+const (
+	OutboxQueued    = "queued"
+	OutboxSending   = "sending"
+	OutboxSent      = "sent"
+	OutboxFailed    = "failed"
+	OutboxDelivered = "delivered"
+)
+
+const (
+	outboxMaxAttempts = 5
+	outboxBaseBackoff = 30 * time.Second
+	outboxMaxBackoff  = 30 * time.Minute
+	outboxIdlePoll    = time.Minute
+)
+
+type OutboxPart struct {
+	Seq         int
+	Reference   int
+	Status      string
+	DeliveredAt *time.Time
+}
+
+type OutboxRecord struct {
+	ID          int64
+	Recipient   string
+	Text        string
+	Status      string
+	Attempts    int
+	LastError   string
+	Encoding    string
+	Segments    int
+	ConcatRef   int
+	NextAttempt time.Time
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	SentAt      *time.Time
+	Parts       []OutboxPart
+}
+
+// outboxBackoff returns the wait before the next attempt after the given
+// number of failed attempts.
+func outboxBackoff(attempts int) time.Duration {
+
+	backoff := outboxBaseBackoff
+	for i := 1; i < attempts; i++ {
+		backoff *= 2
+		if backoff >= outboxMaxBackoff {
+			return outboxMaxBackoff
+		}
+	}
+	return backoff
+}
+
+const outboxColumns = `id, recipient, content, status, attempts, last_error, encoding, segments, concat_ref,
+	next_attempt_at, created_at, updated_at, sent_at`
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanOutbox(row rowScanner) (*OutboxRecord, error) {
+
+	var record OutboxRecord
+	var sentAt sql.NullTime
+
+	err := row.Scan(
+		&record.ID,
+		&record.Recipient,
+		&record.Text,
+		&record.Status,
+		&record.Attempts,
+		&record.LastError,
+		&record.Encoding,
+		&record.Segments,
+		&record.ConcatRef,
+		&record.NextAttempt,
+		&record.CreatedAt,
+		&record.UpdatedAt,
+		&sentAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if sentAt.Valid {
+		record.SentAt = &sentAt.Time
+	}
+
+	return &record, nil
+}
+
+func (sdb *SMSDatabase) EnqueueOutbox(recipient string, text string) (int64, error) {
+
+	now := time.Now()
+	result, err := sdb.db.Exec(`INSERT INTO outbox (recipient, content, status, next_attempt_at, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?)`, recipient, text, OutboxQueued, now, now, now)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.LastInsertId()
+}
+
+// NextDueOutbox returns the oldest queued message whose retry time has come,
+// or nil when nothing is due.
+func (sdb *SMSDatabase) NextDueOutbox(now time.Time) (*OutboxRecord, error) {
+
+	row := sdb.db.QueryRow(`SELECT `+outboxColumns+` FROM outbox
+		WHERE status = ? AND next_attempt_at <= ?
+		ORDER BY next_attempt_at ASC, id ASC LIMIT 1`, OutboxQueued, now)
+
+	record, err := scanOutbox(row)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return record, err
+}
+
+// NextOutboxAttempt returns when the next queued message becomes due.
+func (sdb *SMSDatabase) NextOutboxAttempt() (time.Time, bool, error) {
+
+	var next time.Time
+	err := sdb.db.QueryRow("SELECT next_attempt_at FROM outbox WHERE status = ? ORDER BY next_attempt_at ASC LIMIT 1",
+		OutboxQueued).Scan(&next)
+	if err == sql.ErrNoRows {
+		return time.Time{}, false, nil
+	}
+	if err != nil {
+		return time.Time{}, false, err
+	}
+
+	return next, true, nil
+}
+
+func (sdb *SMSDatabase) MarkOutboxSending(id int64) error {
+
+	_, err := sdb.db.Exec("UPDATE outbox SET status = ?, attempts = attempts + 1, updated_at = ? WHERE id = ?",
+		OutboxSending, time.Now(), id)
+	return err
+}
+
+// MarkOutboxSent stores the message references of the segments that went out.
+// Parts kept from an earlier partial attempt keep their delivery status.
+func (sdb *SMSDatabase) MarkOutboxSent(id int64, encoding string, segments int, concatRef int, references []int) error {
+
+	tx, err := sdb.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	_, err = tx.Exec(`UPDATE outbox SET status = ?, encoding = ?, segments = ?, concat_ref = ?, last_error = '', updated_at = ?, sent_at = ?
+		WHERE id = ?`, OutboxSent, encoding, segments, concatRef, now, now, id)
+	if err != nil {
+		return err
+	}
+
+	if err = saveOutboxParts(tx, id, references); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// MarkOutboxFailed requeues the message with a backoff, or gives up once the
+// attempts are exhausted. It returns the resulting status. The references of
+// segments that went out before the failure are kept, so the next attempt
+// resumes after them instead of sending them again.
+func (sdb *SMSDatabase) MarkOutboxFailed(record *OutboxRecord, references []int, sendErr error) (string, error) {
+
+	tx, err := sdb.db.Begin()
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	status := OutboxQueued
+	if record.Attempts >= outboxMaxAttempts {
+		status = OutboxFailed
+	}
+
+	_, err = tx.Exec(`UPDATE outbox SET status = ?, last_error = ?, encoding = ?, segments = ?, concat_ref = ?,
+		next_attempt_at = ?, updated_at = ? WHERE id = ?`, status, sendErr.Error(), record.Encoding, record.Segments,
+		record.ConcatRef, now.Add(outboxBackoff(record.Attempts)), now, record.ID)
+	if err != nil {
+		return "", err
+	}
+
+	if len(references) > 0 {
+		if err = saveOutboxParts(tx, record.ID, references); err != nil {
+			return "", err
+		}
+	}
+
+	return status, tx.Commit()
+}
+
+// SaveOutboxProgress keeps the references of the segments sent so far for a
+// message whose send was interrupted, without touching its status.
+func (sdb *SMSDatabase) SaveOutboxProgress(record *OutboxRecord, references []int) error {
+
+	tx, err := sdb.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec("UPDATE outbox SET encoding = ?, segments = ?, concat_ref = ?, updated_at = ? WHERE id = ?",
+		record.Encoding, record.Segments, record.ConcatRef, time.Now(), record.ID)
+	if err != nil {
+		return err
+	}
+
+	if err = saveOutboxParts(tx, record.ID, references); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// saveOutboxParts stores one part per reference. A part that already has the
+// same reference is left as it is, so its delivery status survives a resume.
+func saveOutboxParts(tx *sql.Tx, id int64, references []int) error {
+
+	if _, err := tx.Exec("DELETE FROM outbox_parts WHERE outbox_id = ? AND seq > ?", id, len(references)); err != nil {
+		return err
+	}
+	for i, ref := range references {
+		_, err := tx.Exec(`INSERT INTO outbox_parts (outbox_id, seq, reference, status) VALUES (?, ?, ?, ?)
+			ON CONFLICT(outbox_id, seq) DO UPDATE SET reference = excluded.reference, status = excluded.status, delivered_at = NULL
+			WHERE reference != excluded.reference`, id, i+1, ref, OutboxSent)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ResetStaleOutbox requeues messages left in the sending state by a previous
+// run that stopped in the middle of a send.
+func (sdb *SMSDatabase) ResetStaleOutbox() (int64, error) {
+
+	result, err := sdb.db.Exec("UPDATE outbox SET status = ?, updated_at = ? WHERE status = ?",
+		OutboxQueued, time.Now(), OutboxSending)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+func (sdb *SMSDatabase) GetOutboxByID(id int64) (*OutboxRecord, error) {
+
+	record, err := scanOutbox(sdb.db.QueryRow("SELECT "+outboxColumns+" FROM outbox WHERE id = ?", id))
+	if err != nil {
+		return nil, errors.New("outbox message doesn't exist")
+	}
+
+	record.Parts, err = sdb.GetOutboxParts(id)
+	return record, err
+}
+
+func (sdb *SMSDatabase) GetOutboxParts(outboxID int64) ([]OutboxPart, error) {
+
+	rows, err := sdb.db.Query("SELECT seq, reference, status, delivered_at FROM outbox_parts WHERE outbox_id = ? ORDER BY seq ASC", outboxID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var parts []OutboxPart
+	for rows.Next() {
+		var part OutboxPart
+		var deliveredAt sql.NullTime
+		if err := rows.Scan(&part.Seq, &part.Reference, &part.Status, &deliveredAt); err != nil {
+			return nil, err
+		}
+		if deliveredAt.Valid {
+			part.DeliveredAt = &deliveredAt.Time
+		}
+		parts = append(parts, part)
+	}
+	return parts, rows.Err()
+}
+
+func (sdb *SMSDatabase) GetRecentOutbox(limit int) ([]*OutboxRecord, error) {
+
+	rows, err := sdb.db.Query("SELECT "+outboxColumns+" FROM outbox ORDER BY id DESC LIMIT ?", limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var records []*OutboxRecord
+	for rows.Next() {
+		record, err := scanOutbox(rows)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+	return records, rows.Err()
+}
+
+// EnqueueSMS stores an outgoing message and wakes the outbox worker. The
+// message is sent in the background; its state can be followed by ID.
+func (m *Manager) EnqueueSMS(recipient string, text string) (int64, error) {
+
+	recipient = strings.TrimSpace(recipient)
+	if recipient == "" {
+		return 0, errors.New("empty recipient")
+	}
+	if text == "" {
+		return 0, errors.New("empty sms content")
+	}
+
+	id, err := m.db.EnqueueOutbox(recipient, text)
+	if err != nil {
+		return 0, fmt.Errorf("enqueue sms failed: %w", err)
+	}
+	log.Println("[SMSManager] outbox", id, "queued for", recipient)
+
+	select {
+	case m.outboxWake <- struct{}{}:
+	default:
+	}
+
+	return id, nil
+}
+
+func (m *Manager) GetOutboxByID(id int64) (*OutboxRecord, error) {
+	return m.db.GetOutboxByID(id)
+}
+
+func (m *Manager) GetRecentOutbox(limit int) ([]*OutboxRecord, error) {
+	return m.db.GetRecentOutbox(limit)
+}
+
+func (m *Manager) outboxLoop() {
+
+	if n, err := m.db.ResetStaleOutbox(); err != nil {
+		log.Println("[SMSManager] reset stale outbox failed,", err)
+	} else if n > 0 {
+		log.Println("[SMSManager] requeued", n, "outbox messages interrupted while sending")
+	}
+
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-timer.C:
+		case <-m.outboxWake:
+			if !timer.Stop() {
+				select {
+				case <-timer.C:
+				default:
+				}
+			}
+		case <-m.stopChan:
+			log.Println("[SMSManager] exiting the outbox loop")
+			return
+		}
+
+		m.drainOutbox()
+		timer.Reset(m.nextOutboxWait())
+	}
+}
+
+func (m *Manager) drainOutbox() {
+
+	for {
+		select {
+		case <-m.stopChan:
+			return
+		default:
+		}
+
+		record, err := m.db.NextDueOutbox(time.Now())
+		if err != nil {
+			log.Println("[SMSManager] query outbox failed,", err)
+			return
+		}
+		if record == nil {
+			return
+		}
+
+		m.sendOutbox(record)
+	}
+}
+
+func (m *Manager) sendOutbox(record *OutboxRecord) {
+
+	if err := m.db.MarkOutboxSending(record.ID); err != nil {
+		log.Println("[SMSManager] mark outbox", record.ID, "sending failed,", err)
+		return
+	}
+	record.Attempts++
+
+	parts, err := m.db.GetOutboxParts(record.ID)
+	if err != nil {
+		log.Println("[SMSManager] load outbox", record.ID, "parts failed,", err)
+		return
+	}
+
+	var result *atserial.SMSSendResult
+	var sendErr error
+	if len(parts) > 0 && len(parts) < record.Segments {
+		sent := &atserial.SMSSendResult{Segments: record.Segments, ConcatRef: record.ConcatRef}
+		for _, part := range parts {
+			sent.References = append(sent.References, part.Reference)
+		}
+		log.Println("[SMSManager] outbox", record.ID, "resumes after segment", len(parts), "of", record.Segments)
+		result, sendErr = m.nri.ResumeRawSMSContext(m.ctx, record.Recipient, record.Text, sent)
+	} else {
+		result, sendErr = m.nri.SendRawSMSContext(m.ctx, record.Recipient, record.Text)
+	}
+
+	if sendErr == nil {
+		err := m.db.MarkOutboxSent(record.ID, result.Encoding.String(), result.Segments, result.ConcatRef, result.References)
+		if err != nil {
+			log.Println("[SMSManager] mark outbox", record.ID, "sent failed,", err)
+			return
+		}
+		log.Println("[SMSManager] outbox", record.ID, "sent, references", result.References)
+		return
+	}
+
+	var references []int
+	if result != nil {
+		record.Encoding = result.Encoding.String()
+		record.Segments = result.Segments
+		record.ConcatRef = result.ConcatRef
+		references = result.References
+	}
+
+	if m.ctx.Err() != nil && errors.Is(sendErr, m.ctx.Err()) {
+		// left in the sending state, ResetStaleOutbox requeues it on the next start
+		if len(references) > 0 {
+			if err := m.db.SaveOutboxProgress(record, references); err != nil {
+				log.Println("[SMSManager] save outbox", record.ID, "progress failed,", err)
+			}
+		}
+		log.Println("[SMSManager] outbox", record.ID, "interrupted by shutdown")
+		return
+	}
+
+	status, err := m.db.MarkOutboxFailed(record, references, sendErr)
+	if err != nil {
+		log.Println("[SMSManager] mark outbox", record.ID, "failed,", err)
+		return
+	}
+	log.Printf("[SMSManager] outbox %d attempt %d/%d failed (%v) after %d/%d segments, now %s",
+		record.ID, record.Attempts, outboxMaxAttempts, sendErr, len(references), record.Segments, status)
+}
+
+func (m *Manager) nextOutboxWait() time.Duration {
+
+	next, ok, err := m.db.NextOutboxAttempt()
+	if err != nil || !ok {
+		return outboxIdlePoll
+	}
+
+	wait := time.Until(next)
+	if wait < 0 {
+		return 0
+	}
+	if wait > outboxIdlePoll {
+		return outboxIdlePoll
+	}
+	return wait
+}
@@ -0,0 +1,206 @@
+package smsmanager
+
+import (
+	"database/sql"
+	"log"
+	"strings"
+	"time"
+
+	"nrmodule/atserial"
+)
+
+// Message references wrap at 256, reports are only matched against messages
+// sent within this window.
+const reportMatchWindow = 7 * 24 * time.Hour
+
+// DeliveryReport is a status report together with the outbox message it was
+// matched to. OutboxID is 0 when no sent message matched.
+type DeliveryReport struct {
+	atserial.SMSDeliveryReport
+	OutboxID     int64
+	Seq          int
+	Segments     int
+	OutboxStatus string
+}
+
+func normalizeNumber(number string) string {
+
+	var sb strings.Builder
+	for _, r := range number {
+		if r >= '0' && r <= '9' {
+			sb.WriteRune(r)
+		}
+	}
+	return sb.String()
+}
+
+// sameNumber compares two phone numbers, tolerating a missing country code
+// on either side.
+func sameNumber(a string, b string) bool {
+
+	a, b = normalizeNumber(a), normalizeNumber(b)
+	if a == b {
+		return a != ""
+	}
+	if len(a) > len(b) {
+		a, b = b, a
+	}
+	return len(a) >= 7 && strings.HasSuffix(b, a)
+}
+
+// ApplyDeliveryReport records a status report and updates the matching
+// outbox part and message.
+func (sdb *SMSDatabase) ApplyDeliveryReport(report atserial.SMSDeliveryReport) (*DeliveryReport, error) {
+
+	tx, err := sdb.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	result := &DeliveryReport{SMSDeliveryReport: report}
+
+	rows, err := tx.Query(`SELECT p.outbox_id, p.seq, o.recipient, o.segments FROM outbox_parts p
+		JOIN outbox o ON o.id = p.outbox_id
+		WHERE p.reference = ? AND COALESCE(o.sent_at, o.updated_at) >= ?
+		ORDER BY COALESCE(o.sent_at, o.updated_at) DESC`, report.Reference, time.Now().Add(-reportMatchWindow))
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var outboxID int64
+		var seq, segments int
+		var recipient string
+		if err := rows.Scan(&outboxID, &seq, &recipient, &segments); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if sameNumber(recipient, report.Recipient) {
+			result.OutboxID, result.Seq, result.Segments = outboxID, seq, segments
+			break
+		}
+	}
+	rows.Close()
+
+	var outboxID sql.NullInt64
+	if result.OutboxID != 0 {
+		outboxID = sql.NullInt64{Int64: result.OutboxID, Valid: true}
+		if result.OutboxStatus, err = applyPartStatus(tx, result); err != nil {
+			return nil, err
+		}
+	}
+
+	_, err = tx.Exec(`INSERT INTO delivery_reports (outbox_id, seq, reference, recipient, status, status_text, submitted_at, discharged_at, received_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`, outboxID, result.Seq, report.Reference, report.Recipient,
+		int(report.Status), report.Status.String(), report.SubmitTime, report.DischargeTime, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	return result, tx.Commit()
+}
+
+// applyPartStatus updates one part and derives the message status from all
+// of its parts: delivered once every part is, failed as soon as one part
+// finally failed. A message still waiting to resume its remaining segments
+// keeps its status.
+func applyPartStatus(tx *sql.Tx, result *DeliveryReport) (string, error) {
+
+	switch {
+	case result.Status.Delivered():
+		_, err := tx.Exec("UPDATE outbox_parts SET status = ?, delivered_at = ? WHERE outbox_id = ? AND seq = ?",
+			OutboxDelivered, result.DischargeTime, result.OutboxID, result.Seq)
+		if err != nil {
+			return "", err
+		}
+	case result.Status.Final():
+		_, err := tx.Exec("UPDATE outbox_parts SET status = ? WHERE outbox_id = ? AND seq = ?",
+			OutboxFailed, result.OutboxID, result.Seq)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	var current string
+	if err := tx.QueryRow("SELECT status FROM outbox WHERE id = ?", result.OutboxID).Scan(&current); err != nil {
+		return "", err
+	}
+	if current == OutboxQueued || current == OutboxSending {
+		return current, nil
+	}
+
+	var delivered, failed int
+	err := tx.QueryRow(`SELECT
+		COALESCE(SUM(CASE WHEN status = ? THEN 1 ELSE 0 END), 0),
+		COALESCE(SUM(CASE WHEN status = ? THEN 1 ELSE 0 END), 0)
+		FROM outbox_parts WHERE outbox_id = ?`, OutboxDelivered, OutboxFailed, result.OutboxID).Scan(&delivered, &failed)
+	if err != nil {
+		return "", err
+	}
+
+	status := OutboxSent
+	lastError := ""
+	switch {
+	case failed > 0:
+		status = OutboxFailed
+		lastError = "delivery failed: " + result.Status.String()
+	case delivered >= result.Segments:
+		status = OutboxDelivered
+	}
+
+	_, err = tx.Exec("UPDATE outbox SET status = ?, last_error = CASE WHEN ? = '' THEN last_error ELSE ? END, updated_at = ? WHERE id = ?",
+		status, lastError, lastError, time.Now(), result.OutboxID)
+	return status, err
+}
+
+func (m *Manager) handleDeliveryReport(report atserial.SMSDeliveryReport) {
+
+	result, err := m.db.ApplyDeliveryReport(report)
+	if err != nil {
+		log.Println("[SMSManager] store delivery report failed,", err)
+		return
+	}
+
+	if result.OutboxID == 0 {
+		log.Println("[SMSManager] delivery report for reference", report.Reference, "to", report.Recipient, "matches no sent sms")
+	} else {
+		log.Printf("[SMSManager] outbox %d part %d/%d %s, now %s",
+			result.OutboxID, result.Seq, result.Segments, report.Status, result.OutboxStatus)
+	}
+
+	m.observerManager.NotifyDeliveryReport(*result)
+}
+
+func (m *Manager) processStatusReportEvent(ev atserial.URCEvent) {
+
+	if ev.Type == atserial.URCStatusReport {
+		report, err := atserial.DeliveryReportFromURC(ev)
+		if ackErr := m.nri.AckStatusReportContext(m.ctx); ackErr != nil {
+			log.Println("[SMSManager]", ackErr)
+		}
+		if err != nil {
+			log.Println("[SMSManager] invalid status report event,", err)
+			return
+		}
+		m.handleDeliveryReport(*report)
+		return
+	}
+
+	storage, index, err := ev.MessageIndex()
+	if err != nil {
+		log.Println("[SMSManager] invalid status report event,", err)
+		return
+	}
+
+	if storage == "" || storage == "ME" {
+		m.processNewSMSEvent(ev)
+		return
+	}
+
+	report, err := m.nri.ReadStatusReportContext(m.ctx, storage, index)
+	if err != nil {
+		log.Println("[SMSManager] read status report", storage, index, "failed,", err)
+		return
+	}
+	m.handleDeliveryReport(*report)
+}